@@ -0,0 +1,464 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Gopcregrep searches files for lines matching a PCRE pattern, using
+// package pcre, so that its results are the same as those of Go
+// programs built on that package.
+//
+// Usage:
+//
+//	gopcregrep [flags] pattern [file ...]
+//
+// Without files, standard input is searched.  Directories are searched
+// if -r is given; symbolic links inside them are skipped.  The exit
+// status is 0 if a line was selected, 1 if none was, and 2 if an error
+// occurred.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A repeatable string flag.
+type globs []string
+
+func (g *globs) String() string {
+	return strings.Join(*g, ",")
+}
+
+func (g *globs) Set(value string) error {
+	if _, err := filepath.Match(value, ""); err != nil {
+		return err
+	}
+	*g = append(*g, value)
+	return nil
+}
+
+const (
+	colorMatch = "\x1b[01;31m"
+	colorFile  = "\x1b[35m"
+	colorLine  = "\x1b[32m"
+	colorSep   = "\x1b[36m"
+	colorReset = "\x1b[m"
+)
+
+type grep struct {
+	re        pcre.Regexp
+	names     []string // named groups, by group number
+	invert    bool
+	only      bool
+	count     bool
+	list      bool
+	number    bool
+	filenames bool
+	named     bool
+	multiline bool
+	recursive bool
+	color     bool
+	before    int
+	after     int
+	include   globs
+	exclude   globs
+	stdout    *bufio.Writer
+	stderr    io.Writer
+	matched   bool
+	failed    bool
+}
+
+// Returns the exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("gopcregrep", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	g := &grep{stderr: stderr}
+	var (
+		caseless, utf, word, line, noFilenames bool
+		context                                int
+		color                                  string
+	)
+	fs.BoolVar(&caseless, "i", false, "ignore case (CASELESS)")
+	fs.BoolVar(&utf, "u", false, "UTF-8 mode (UTF8)")
+	fs.BoolVar(&word, "w", false, "match whole words only")
+	fs.BoolVar(&line, "x", false, "match whole lines only")
+	fs.BoolVar(&g.multiline, "M", false, "match the pattern against whole files, so that it can span lines (MULTILINE)")
+	fs.BoolVar(&g.invert, "v", false, "select non-matching lines")
+	fs.BoolVar(&g.only, "o", false, "print only the matching parts of lines")
+	fs.BoolVar(&g.count, "c", false, "print the number of selected lines per file")
+	fs.BoolVar(&g.list, "l", false, "print only the names of files with selected lines")
+	fs.BoolVar(&g.number, "n", false, "print line numbers")
+	fs.BoolVar(&g.filenames, "H", false, "print file names (default if there are several files)")
+	fs.BoolVar(&noFilenames, "h", false, "do not print file names")
+	fs.BoolVar(&g.named, "N", false, "print the named groups of each match as name=value")
+	fs.BoolVar(&g.recursive, "r", false, "search directories recursively")
+	fs.IntVar(&g.after, "A", 0, "print `num` lines of context after selected lines")
+	fs.IntVar(&g.before, "B", 0, "print `num` lines of context before selected lines")
+	fs.IntVar(&context, "C", 0, "print `num` lines of context around selected lines")
+	fs.Var(&g.include, "include", "search only files whose base name matches `glob` (repeatable)")
+	fs.Var(&g.exclude, "exclude", "skip files and directories whose base name matches `glob` (repeatable)")
+	fs.StringVar(&color, "color", "auto", "highlight matches: `when` is never, always or auto")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() < 1 {
+		fmt.Fprintln(stderr, "usage: gopcregrep [flags] pattern [file ...]")
+		fs.PrintDefaults()
+		return 2
+	}
+	if context > g.after {
+		g.after = context
+	}
+	if context > g.before {
+		g.before = context
+	}
+	switch color {
+	case "always":
+		g.color = true
+	case "never":
+	case "auto":
+		if f, ok := stdout.(*os.File); ok {
+			if fi, err := f.Stat(); err == nil {
+				g.color = fi.Mode()&os.ModeCharDevice != 0
+			}
+		}
+	default:
+		fmt.Fprintf(stderr, "gopcregrep: invalid -color value %q\n", color)
+		return 2
+	}
+
+	pattern := fs.Arg(0)
+	switch {
+	case line:
+		pattern = "^(?:" + pattern + ")$"
+	case word:
+		pattern = `\b(?:` + pattern + `)\b`
+	}
+	flags := 0
+	if caseless {
+		flags |= pcre.CASELESS
+	}
+	if utf {
+		flags |= pcre.UTF8
+	}
+	if g.multiline {
+		flags |= pcre.MULTILINE
+	}
+	re, cerr := pcre.Compile(pattern, flags)
+	if cerr != nil {
+		fmt.Fprintf(stderr, "gopcregrep: %s\n", cerr)
+		return 2
+	}
+	g.re = re
+	g.names = make([]string, re.Groups()+1)
+	for name, i := range re.NamedGroups() {
+		g.names[i] = name
+	}
+
+	g.stdout = bufio.NewWriter(stdout)
+	defer g.stdout.Flush()
+	files := fs.Args()[1:]
+	g.filenames = (g.filenames || len(files) > 1 || g.recursive) && !noFilenames
+	if len(files) == 0 {
+		data, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			g.error(err)
+		} else {
+			g.search("(standard input)", data)
+		}
+	}
+	for _, name := range files {
+		g.walk(name, true)
+	}
+	switch {
+	case g.failed:
+		return 2
+	case g.matched:
+		return 0
+	}
+	return 1
+}
+
+func (g *grep) error(err error) {
+	fmt.Fprintf(g.stderr, "gopcregrep: %s\n", err)
+	g.failed = true
+}
+
+func matchglobs(list globs, name string) bool {
+	for _, glob := range list {
+		if ok, _ := filepath.Match(glob, filepath.Base(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Search a file, or a directory if -r is given.  Files named on the
+// command line are searched regardless of -include; symbolic links are
+// followed only there, so that a recursive search cannot loop.
+func (g *grep) walk(name string, explicit bool) {
+	stat := os.Lstat
+	if explicit {
+		stat = os.Stat
+	}
+	fi, err := stat(name)
+	if err != nil {
+		g.error(err)
+		return
+	}
+	if !explicit && (fi.Mode()&os.ModeSymlink != 0 || matchglobs(g.exclude, name)) {
+		return
+	}
+	if fi.IsDir() {
+		if !g.recursive {
+			g.error(fmt.Errorf("%s: is a directory", name))
+			return
+		}
+		entries, err := os.ReadDir(name)
+		if err != nil {
+			g.error(err)
+			return
+		}
+		for _, e := range entries {
+			g.walk(filepath.Join(name, e.Name()), false)
+		}
+		return
+	}
+	if !explicit && len(g.include) > 0 && !matchglobs(g.include, name) {
+		return
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		g.error(err)
+		return
+	}
+	g.search(name, data)
+}
+
+// Search the contents of one file.
+func (g *grep) search(name string, data []byte) {
+	lines := bytes.SplitAfter(data, []byte{'\n'})
+	if n := len(lines); n > 0 && len(lines[n-1]) == 0 {
+		lines = lines[:n-1]
+	}
+	// Offsets of the line starts, for mapping matches to lines in
+	// multiline mode.
+	starts := make([]int, len(lines)+1)
+	for i, l := range lines {
+		starts[i+1] = starts[i] + len(l)
+	}
+	// Matches per line, as offsets into the line.
+	matches := make([][][]int, len(lines))
+	m := new(pcre.Matcher)
+	if g.multiline {
+		if err := m.Reset(g.re, data, 0); err != nil {
+			g.error(fmt.Errorf("%s: %s", name, err))
+			return
+		}
+		for ok := m.Matches(); ok; {
+			loc := m.GroupIndex(0)
+			first := sort.SearchInts(starts, loc[0]+1) - 1
+			last := first
+			if loc[1] > loc[0] {
+				last = sort.SearchInts(starts, loc[1]) - 1
+			}
+			for i := first; i <= last && i < len(lines); i++ {
+				s, e := loc[0]-starts[i], loc[1]-starts[i]
+				if s < 0 {
+					s = 0
+				}
+				// The newline is not part of the printed line.
+				if n := len(bytes.TrimSuffix(lines[i], []byte{'\n'})); e > n {
+					e = n
+				}
+				matches[i] = append(matches[i], []int{s, e})
+			}
+			g.printnamed(name, first, m)
+			var err error
+			if ok, err = m.Next(0); err != nil {
+				g.error(fmt.Errorf("%s: %s", name, err))
+				return
+			}
+		}
+	} else {
+		for i, l := range lines {
+			l = bytes.TrimSuffix(l, []byte{'\n'})
+			if err := m.Reset(g.re, l, 0); err != nil {
+				g.error(fmt.Errorf("%s: %s", name, err))
+				return
+			}
+			for ok := m.Matches(); ok; {
+				matches[i] = append(matches[i], m.GroupIndex(0))
+				g.printnamed(name, i, m)
+				var err error
+				if ok, err = m.Next(0); err != nil {
+					g.error(fmt.Errorf("%s: %s", name, err))
+					return
+				}
+			}
+		}
+	}
+	g.report(name, lines, matches)
+}
+
+// With -N, print the named groups of the current match.
+func (g *grep) printnamed(name string, line int, m *pcre.Matcher) {
+	if !g.named || g.invert || g.count || g.list {
+		return
+	}
+	g.matched = true
+	g.prefix(name, line, ':')
+	first := true
+	for i, n := range g.names {
+		if n == "" || !m.Present(i) {
+			continue
+		}
+		if !first {
+			g.stdout.WriteByte(' ')
+		}
+		first = false
+		g.stdout.WriteString(n + "=" + strconv.Quote(m.GroupString(i)))
+	}
+	g.stdout.WriteByte('\n')
+}
+
+func (g *grep) colored(color, s string) string {
+	if g.color {
+		return color + s + colorReset
+	}
+	return s
+}
+
+func (g *grep) prefix(name string, line int, sep byte) {
+	if g.filenames {
+		g.stdout.WriteString(g.colored(colorFile, name) + g.colored(colorSep, string(sep)))
+	}
+	if g.number {
+		g.stdout.WriteString(g.colored(colorLine, strconv.Itoa(line+1)) + g.colored(colorSep, string(sep)))
+	}
+}
+
+// Print the selected lines of a file, with context.
+func (g *grep) report(name string, lines [][]byte, matches [][][]int) {
+	selected := 0
+	for i := range lines {
+		if (matches[i] != nil) != g.invert {
+			selected++
+		}
+	}
+	if selected > 0 {
+		g.matched = true
+	}
+	switch {
+	case g.count:
+		if g.filenames {
+			g.stdout.WriteString(g.colored(colorFile, name) + g.colored(colorSep, ":"))
+		}
+		fmt.Fprintln(g.stdout, selected)
+		return
+	case g.list:
+		if selected > 0 {
+			fmt.Fprintln(g.stdout, g.colored(colorFile, name))
+		}
+		return
+	case g.named && !g.invert:
+		return
+	}
+	printed := -1 // last line printed
+	pending := 0  // context lines still to print after a selected line
+	for i, l := range lines {
+		l = bytes.TrimSuffix(l, []byte{'\n'})
+		if (matches[i] != nil) == g.invert {
+			if pending > 0 && !g.only {
+				g.prefix(name, i, '-')
+				g.stdout.Write(l)
+				g.stdout.WriteByte('\n')
+				printed = i
+				pending--
+			}
+			continue
+		}
+		if g.only {
+			for _, loc := range matches[i] {
+				if loc[0] == loc[1] {
+					continue
+				}
+				g.prefix(name, i, ':')
+				g.stdout.WriteString(g.colored(colorMatch, string(l[loc[0]:loc[1]])) + "\n")
+			}
+			continue
+		}
+		first := i - g.before
+		if first <= printed {
+			first = printed + 1
+		}
+		if first < 0 {
+			first = 0
+		}
+		if printed >= 0 && first > printed+1 && (g.before > 0 || g.after > 0) {
+			g.stdout.WriteString(g.colored(colorSep, "--") + "\n")
+		}
+		for j := first; j < i; j++ {
+			g.prefix(name, j, '-')
+			g.stdout.Write(bytes.TrimSuffix(lines[j], []byte{'\n'}))
+			g.stdout.WriteByte('\n')
+		}
+		g.prefix(name, i, ':')
+		g.highlight(l, matches[i])
+		printed = i
+		pending = g.after
+	}
+}
+
+// Print a selected line, highlighting the matches.
+func (g *grep) highlight(l []byte, matches [][]int) {
+	last := 0
+	if g.color {
+		for _, loc := range matches {
+			if loc[0] < last || loc[0] == loc[1] {
+				continue
+			}
+			g.stdout.Write(l[last:loc[0]])
+			g.stdout.WriteString(colorMatch)
+			g.stdout.Write(l[loc[0]:loc[1]])
+			g.stdout.WriteString(colorReset)
+			last = loc[1]
+		}
+	}
+	g.stdout.Write(l[last:])
+	g.stdout.WriteByte('\n')
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func grepstring(t *testing.T, input string, args ...string) (string, int) {
+	var stdout, stderr bytes.Buffer
+	status := run(args, strings.NewReader(input), &stdout, &stderr)
+	if stderr.Len() > 0 {
+		t.Log(stderr.String())
+	}
+	return stdout.String(), status
+}
+
+func TestGrep(t *testing.T) {
+	const input = "alpha 1\nbeta 22\ngamma\ndelta 333\nepsilon\n"
+	check := func(want string, status int, args ...string) {
+		out, s := grepstring(t, input, args...)
+		if out != want || s != status {
+			t.Errorf("%q: got %q (%d), want %q (%d)", args, out, s, want, status)
+		}
+	}
+	check("alpha 1\nbeta 22\ndelta 333\n", 0, `\d`)
+	check("1\n22\n333\n", 0, "-o", `\d+`)
+	check("2:beta 22\n", 0, "-n", `\b\d{2}\b`)
+	check("3\n", 0, "-c", `\d`)
+	check("gamma\nepsilon\n", 0, "-v", `\d`)
+	check("", 1, "zeta")
+	check("", 1, "BETA")
+	check("beta 22\n", 0, "-i", "BETA")
+	check("gamma\n", 0, "-x", "gam+a")
+	check("", 1, "-w", "gam")
+	check("beta 22\ngamma\ndelta 333\n", 0, "-M", `22\ng.*\nd`)
+	check("alpha 1\nbeta 22\n--\nepsilon\n", 0, "-A", "1", "alpha|epsilon")
+	check("1:alpha 1\n2-beta 22\n--\n4-delta 333\n5:epsilon\n", 0, "-n", "-C", "1", "alpha|eps")
+	check(`n="22"`+"\n", 0, "-N", `^\w+ (?<n>\d\d)$`)
+	check("b\x1b[01;31meta\x1b[m 22\n", 0, "-color=always", "eta")
+	check("a\nd\n", 0, "-M", "-o", `a\nd`)
+	check("gamm\x1b[01;31ma\x1b[m\n\x1b[01;31md\x1b[melta 333\n", 0, "-M", "-color=always", `a\nd`)
+	check("", 2, "(")
+}
+
+func TestGrepFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopcregrep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, data := range map[string]string{
+		"a.txt":      "needle\n",
+		"b.log":      "needle\n",
+		"sub/c.txt":  "hay\nneedle\n",
+		"skip/d.txt": "needle\n",
+	} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(dir, filepath.Join(dir, "sub", "loop")); err != nil {
+		t.Fatal(err)
+	}
+	out, status := grepstring(t, "", "-r", "-l", "-include=*.txt", "-exclude=skip", "needle", dir)
+	want := filepath.Join(dir, "a.txt") + "\n" + filepath.Join(dir, "sub", "c.txt") + "\n"
+	if out != want || status != 0 {
+		t.Errorf("got %q (%d), want %q", out, status, want)
+	}
+	out, _ = grepstring(t, "", "-n", "needle", filepath.Join(dir, "a.txt"), filepath.Join(dir, "sub", "c.txt"))
+	want = filepath.Join(dir, "a.txt") + ":1:needle\n" + filepath.Join(dir, "sub", "c.txt") + ":2:needle\n"
+	if out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+	bad, good := filepath.Join(dir, "bad.txt"), filepath.Join(dir, "a.txt")
+	if err := ioutil.WriteFile(bad, []byte("needle\xff\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, status = grepstring(t, "", "needle", dir); status != 2 {
+		t.Error("directory without -r", status)
+	}
+	out, status = grepstring(t, "", "-u", "needle", bad, good)
+	want = good + ":needle\n"
+	if out != want || status != 2 {
+		t.Errorf("got %q (%d), want %q (2)", out, status, want)
+	}
+}
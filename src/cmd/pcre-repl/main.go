@@ -0,0 +1,276 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Pcre-repl is an interactive tester for patterns of package pcre.
+// Enter a pattern as a Perl-style literal, then subjects, one per
+// line.  For every match, all groups are shown with their number,
+// name, offsets and value, followed by the (*MARK) name if any.
+//
+// Usage:
+//
+//	pcre-repl [-e literal] [file ...]
+//
+// With files, their lines are matched against the pattern given with
+// -e and the program exits.  Otherwise commands and subjects are read
+// from standard input:
+//
+//	/pattern/flags   compile a pattern; m{...} and qr/.../ work too
+//	:pattern text    compile text as the pattern, keeping the flags
+//	:flags letters   recompile the pattern with other flags
+//	:file path       match every line of a file
+//	:all             toggle showing all matches instead of the first
+//	:help            list the commands
+//	:quit            leave
+//
+// Any other line is a subject.  A line starting with m or qr is a
+// pattern only if it is a complete literal such as m{...}i.  A leading
+// backslash is removed, so that subjects starting with / or :, or
+// which look like such a literal, can be entered.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+const help = `/pattern/flags   compile a pattern; m{...} and qr/.../ work too
+:pattern text    compile text as the pattern, keeping the flags
+:flags letters   recompile the pattern with other flags (imsxADUXJnu)
+:file path       match every line of a file
+:all             toggle showing all matches instead of the first
+:help            list the commands
+:quit            leave
+anything else    match it as a subject (a leading \ is removed, for
+                 subjects starting with / or : or like m{...} or qr/.../)
+`
+
+type repl struct {
+	re    pcre.Regexp
+	names []string // group names, by group number
+	all   bool
+	out   io.Writer
+}
+
+// Compile a pattern and report errors with a caret under the offset
+// in source, which is what the user typed.
+func (r *repl) compile(source string, re pcre.Regexp, err *pcre.CompileError) bool {
+	if err != nil {
+		fmt.Fprintf(r.out, "%s\n%s^ %s at offset %d\n", source,
+			strings.Repeat(" ", err.Offset), err.Message, err.Offset)
+		return false
+	}
+	r.re = re
+	r.names = make([]string, re.Groups()+1)
+	for name, i := range re.NamedGroups() {
+		r.names[i] = name
+	}
+	text, merr := re.MarshalText()
+	if merr != nil {
+		text = []byte(re.String())
+	}
+	fmt.Fprintf(r.out, "%s: %d groups\n", text, re.Groups())
+	return true
+}
+
+// Parse a line of modifier letters into flags.
+func modifierflags(letters string) (int, *pcre.CompileError) {
+	_, flags, err := pcre.ParsePerlPattern("//" + letters)
+	if err != nil {
+		err.Pattern = letters
+		err.Offset -= 2
+	}
+	return flags, err
+}
+
+// Execute a command or match a subject.  Returns false on :quit.
+func (r *repl) line(line string) bool {
+	cmd, arg := line, ""
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		cmd, arg = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	switch {
+	case line == "":
+	case line[0] == '/', isliteral(line, "m"), isliteral(line, "qr"):
+		re, err := pcre.CompileLiteral(line)
+		r.compile(line, re, err)
+	case cmd == ":pattern":
+		re, err := pcre.Compile(arg, r.re.Flags())
+		r.compile(arg, re, err)
+	case cmd == ":flags":
+		flags, err := modifierflags(arg)
+		if err != nil {
+			r.compile(arg, pcre.Regexp{}, err)
+			break
+		}
+		re, err := pcre.Compile(r.re.String(), flags)
+		r.compile(r.re.String(), re, err)
+	case cmd == ":file":
+		if err := r.file(arg); err != nil {
+			fmt.Fprintln(r.out, err)
+		}
+	case cmd == ":all":
+		r.all = !r.all
+		fmt.Fprintln(r.out, "showing all matches:", r.all)
+	case cmd == ":help":
+		io.WriteString(r.out, help)
+	case cmd == ":quit":
+		return false
+	case line[0] == ':':
+		fmt.Fprintf(r.out, "unknown command %s, try :help\n", cmd)
+	default:
+		r.subject(strings.TrimPrefix(line, `\`))
+	}
+	return true
+}
+
+// Reports whether line is a complete m or qr pattern literal, with the
+// closing delimiter followed only by modifier letters, so that
+// subjects such as "m.example.com down" are not taken for patterns.
+func isliteral(line, prefix string) bool {
+	if !strings.HasPrefix(line, prefix) || len(line) <= len(prefix) || isword(line[len(prefix)]) {
+		return false
+	}
+	_, _, err := pcre.ParsePerlPattern(line)
+	return err == nil
+}
+
+func isword(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z'
+}
+
+// Match every line of a file.
+func (r *repl) file(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		r.subject(s.Text())
+	}
+	return s.Err()
+}
+
+// Match a subject and print the groups.
+func (r *repl) subject(subject string) {
+	if r.names == nil {
+		fmt.Fprintln(r.out, "no pattern, enter one as /pattern/flags")
+		return
+	}
+	m, err := r.re.MatcherString(subject, 0)
+	n := 0
+	for err == nil && m.Matches() {
+		n++
+		w := tabwriter.NewWriter(r.out, 0, 8, 2, ' ', 0)
+		loc := m.GroupIndex(0)
+		fmt.Fprintf(w, "match %d at [%d:%d]\n", n, loc[0], loc[1])
+		for i, name := range r.names {
+			if !m.Present(i) {
+				fmt.Fprintf(w, "  %d\t%s\t-\tunset\n", i, name)
+				continue
+			}
+			loc := m.GroupIndex(i)
+			fmt.Fprintf(w, "  %d\t%s\t[%d:%d]\t%s\n", i, name, loc[0], loc[1],
+				strconv.Quote(m.GroupString(i)))
+		}
+		w.Flush()
+		if mark := m.Mark(); mark != "" {
+			fmt.Fprintf(r.out, "  MARK: %s\n", mark)
+		}
+		if !r.all {
+			return
+		}
+		_, err = m.Next(0)
+	}
+	switch {
+	case err != nil:
+		fmt.Fprintln(r.out, "error:", err)
+	case n == 0:
+		fmt.Fprintln(r.out, "no match")
+		if mark := m.Mark(); mark != "" {
+			fmt.Fprintf(r.out, "  MARK: %s\n", mark)
+		}
+	}
+}
+
+// Returns the exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer, interactive bool) int {
+	fs := flag.NewFlagSet("pcre-repl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	literal := fs.String("e", "", "initial pattern, as a Perl-style `literal`")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	r := &repl{out: stdout}
+	if *literal != "" {
+		re, err := pcre.CompileLiteral(*literal)
+		if !r.compile(*literal, re, err) {
+			return 2
+		}
+	}
+	if fs.NArg() > 0 {
+		if *literal == "" {
+			fmt.Fprintln(stderr, "pcre-repl: files need a pattern given with -e")
+			return 2
+		}
+		for _, path := range fs.Args() {
+			if err := r.file(path); err != nil {
+				fmt.Fprintln(stderr, "pcre-repl:", err)
+				return 2
+			}
+		}
+		return 0
+	}
+	s := bufio.NewScanner(stdin)
+	for {
+		if interactive {
+			io.WriteString(stdout, "pcre> ")
+		}
+		if !s.Scan() || !r.line(s.Text()) {
+			break
+		}
+	}
+	if err := s.Err(); err != nil {
+		fmt.Fprintln(stderr, "pcre-repl:", err)
+		return 2
+	}
+	return 0
+}
+
+func main() {
+	interactive := false
+	if fi, err := os.Stdin.Stat(); err == nil {
+		interactive = fi.Mode()&os.ModeCharDevice != 0
+	}
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr, interactive))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestREPL(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	input := strings.Join([]string{
+		`/(?<key>\w+)=(x)?(?<val>\d+)/`,
+		"a=1 b=22",
+		":all",
+		"a=1 b=22",
+		"nothing",
+		`/(*MARK:one)a|(*MARK:two)b/`,
+		"b",
+		`/a(b/i`,
+		":flags iq",
+		`\:literal`,
+		`m.example.com down`,
+		`m-1 started`,
+		`m{a}i`,
+		`\m{a}i`,
+		":quit",
+		"never read",
+	}, "\n")
+	if status := run(nil, strings.NewReader(input), &stdout, &stderr, false); status != 0 {
+		t.Error("status", status, stderr.String())
+	}
+	want := `/(?<key>\w+)=(x)?(?<val>\d+)/: 3 groups
+match 1 at [0:3]
+  0       [0:3]  "a=1"
+  1  key  [0:1]  "a"
+  2       -      unset
+  3  val  [2:3]  "1"
+showing all matches: true
+match 1 at [0:3]
+  0       [0:3]  "a=1"
+  1  key  [0:1]  "a"
+  2       -      unset
+  3  val  [2:3]  "1"
+match 2 at [4:8]
+  0       [4:8]  "b=22"
+  1  key  [4:5]  "b"
+  2       -      unset
+  3  val  [6:8]  "22"
+no match
+/(*MARK:one)a|(*MARK:two)b/: 0 groups
+match 1 at [0:1]
+  0    [0:1]  "b"
+  MARK: two
+/a(b/i
+    ^ missing ) at offset 4
+iq
+ ^ unknown modifier 'q' at offset 1
+match 1 at [6:7]
+  0    [6:7]  "a"
+  MARK: one
+match 1 at [4:5]
+  0    [4:5]  "a"
+  MARK: one
+match 1 at [6:7]
+  0    [6:7]  "a"
+  MARK: one
+/a/i: 0 groups
+match 1 at [2:3]
+  0    [2:3]  "a"
+`
+	if got := stdout.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if status := run([]string{"x.txt"}, nil, &stdout, &stderr, false); status != 2 {
+		t.Error("files without -e", status)
+	}
+	if status := run([]string{"-e", "/(/"}, nil, &stdout, &stderr, false); status != 2 {
+		t.Error("bad -e", status)
+	}
+}
@@ -0,0 +1,356 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Pcregen generates typed matchers for patterns of package pcre.  It
+// is meant to be run by go generate:
+//
+//	//go:generate pcregen patterns.pcre
+//
+// The input declares one pattern per line, as a name followed by a
+// Perl-style pattern literal.  Each name may be declared only once,
+// ignoring the case of its first letter.  Indented lines after it give the Go
+// type of named groups, which default to string:
+//
+//	# Comments start with #.
+//	LogLine /^(?<host>\S+):(?<port>\d+)(?: (?<took>\S+))?$/
+//		port int
+//		took time.Duration
+//
+// The supported types are string, []byte, int, int64, uint, uint64,
+// float64, bool and time.Duration.  For each pattern, the output
+// declares a struct type with one field per named group and a
+// function
+//
+//	func ParseLogLine(s string) (v LogLine, ok bool, err error)
+//
+// which returns ok == false if s does not match, and an error if a
+// group cannot be converted.  Patterns are compiled while generating,
+// so invalid patterns fail the build, and the generated code accesses
+// groups by number.  Fields of groups which do not take part in the
+// match keep their zero value.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+)
+
+// How to convert a group to a field type.  Parse is a format for the
+// call which returns the value and an error, given the group text;
+// convert is a format for the conversion of its result x.
+type fieldtype struct {
+	parse   string
+	convert string
+	imports []string
+}
+
+var fieldtypes = map[string]fieldtype{
+	"string":        {},
+	"[]byte":        {},
+	"int":           {"strconv.ParseInt(%s, 10, 0)", "int(x)", []string{"strconv"}},
+	"int64":         {"strconv.ParseInt(%s, 10, 64)", "x", []string{"strconv"}},
+	"uint":          {"strconv.ParseUint(%s, 10, 0)", "uint(x)", []string{"strconv"}},
+	"uint64":        {"strconv.ParseUint(%s, 10, 64)", "x", []string{"strconv"}},
+	"float64":       {"strconv.ParseFloat(%s, 64)", "x", []string{"strconv"}},
+	"bool":          {"strconv.ParseBool(%s)", "x", []string{"strconv"}},
+	"time.Duration": {"time.ParseDuration(%s)", "x", []string{"time"}},
+}
+
+type field struct {
+	Name    string // Go name
+	Group   string // group name
+	Index   int
+	Type    string
+	Parse   string // empty for string and []byte
+	Convert string
+}
+
+type decl struct {
+	Name    string
+	Literal string
+	Fields  []field
+	line    int
+	types   map[string]string // group name to type, from the input
+}
+
+// Parse the declarations in the input.
+func parse(r io.Reader, filename string) ([]*decl, error) {
+	var decls []*decl
+	// Names which differ in the case of the first letter clash in
+	// the unexported regexp variables.
+	declared := map[string]int{}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || trimmed[0] == '#':
+		case line[0] == ' ' || line[0] == '\t':
+			f := strings.Fields(trimmed)
+			if len(decls) == 0 || len(f) != 2 {
+				return nil, fmt.Errorf("%s:%d: expected group name and type", filename, n)
+			}
+			if _, ok := fieldtypes[f[1]]; !ok {
+				return nil, fmt.Errorf("%s:%d: unsupported type %s", filename, n, f[1])
+			}
+			decls[len(decls)-1].types[f[0]] = f[1]
+		default:
+			i := strings.IndexAny(trimmed, " \t")
+			if i < 0 {
+				return nil, fmt.Errorf("%s:%d: expected name and pattern", filename, n)
+			}
+			d := &decl{
+				Name:    trimmed[:i],
+				Literal: strings.TrimSpace(trimmed[i:]),
+				line:    n,
+				types:   map[string]string{},
+			}
+			if !isidentifier(d.Name) {
+				return nil, fmt.Errorf("%s:%d: invalid name %q", filename, n, d.Name)
+			}
+			key := lower(d.Name)
+			if prev, ok := declared[key]; ok {
+				return nil, fmt.Errorf("%s:%d: %s redeclared, previous declaration at %s:%d",
+					filename, n, d.Name, filename, prev)
+			}
+			declared[key] = n
+			decls = append(decls, d)
+		}
+	}
+	return decls, s.Err()
+}
+
+func isidentifier(s string) bool {
+	for i, r := range s {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// Returns the exported Go name for a group name: source_msg becomes
+// SourceMsg.
+func fieldname(group string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range group {
+		switch {
+		case r == '_':
+			upper = true
+		case upper:
+			b.WriteRune(unicode.ToUpper(r))
+			upper = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() == 0 {
+		return "X" + group
+	}
+	return b.String()
+}
+
+// Compile the pattern of a declaration and work out its fields.
+func (d *decl) compile(filename string) error {
+	re, err := pcre.CompileLiteral(d.Literal)
+	if err != nil {
+		return fmt.Errorf("%s:%d: %s", filename, d.line, err)
+	}
+	names := re.NamedGroups()
+	seen := map[string]string{}
+	for group, index := range names {
+		name := fieldname(group)
+		if other, ok := seen[name]; ok {
+			return fmt.Errorf("%s:%d: groups %s and %s both map to field %s",
+				filename, d.line, other, group, name)
+		}
+		seen[name] = group
+		typ, ok := d.types[group]
+		if !ok {
+			typ = "string"
+		}
+		ft := fieldtypes[typ]
+		f := field{Name: name, Group: group, Index: index, Type: typ, Convert: ft.convert}
+		if ft.parse != "" {
+			f.Parse = fmt.Sprintf(ft.parse, fmt.Sprintf("m.GroupString(%d)", index))
+		}
+		d.Fields = append(d.Fields, f)
+	}
+	for group := range d.types {
+		if _, ok := names[group]; !ok {
+			return fmt.Errorf("%s:%d: no group named %q", filename, d.line, group)
+		}
+	}
+	sort.Slice(d.Fields, func(i, j int) bool { return d.Fields[i].Index < d.Fields[j].Index })
+	return nil
+}
+
+// Returns s with the first letter in lower case.
+func lower(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[size:]
+}
+
+var output = template.Must(template.New("output").Funcs(template.FuncMap{
+	"quote": strconv.Quote,
+	"lower": lower,
+}).Parse(`// Code generated by pcregen from {{.Source}}; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	{{quote .}}
+{{- end}}
+)
+{{range .Decls}}
+// {{.Name}} holds the named groups of {{.Literal}}.
+type {{.Name}} struct {
+{{- range .Fields}}
+	{{.Name}} {{.Type}} // group {{.Index}}, {{.Group}}
+{{- end}}
+}
+
+var {{lower .Name}}Regexp = pcre.MustCompileLiteral({{quote .Literal}})
+
+// Parse{{.Name}} matches s against the {{.Name}} pattern.  It returns
+// ok == false if s does not match, and an error if a group cannot be
+// converted.
+func Parse{{.Name}}(s string) (v {{.Name}}, ok bool, err error) {
+	m, err := {{lower .Name}}Regexp.MatcherString(s, 0)
+	if err != nil || !m.Matches() {
+		return v, false, err
+	}
+{{- $decl := .}}
+{{- range .Fields}}
+	if m.Present({{.Index}}) {
+{{- if .Parse}}
+		x, err := {{.Parse}}
+		if err != nil {
+			return v, true, fmt.Errorf("{{$decl.Name}}: group %q: %v", {{quote .Group}}, err)
+		}
+		v.{{.Name}} = {{.Convert}}
+{{- else if eq .Type "string"}}
+		v.{{.Name}} = m.GroupString({{.Index}})
+{{- else}}
+		v.{{.Name}} = m.Group({{.Index}})
+{{- end}}
+	}
+{{- end}}
+	return v, true, nil
+}
+{{end}}`))
+
+// Generate the Go source for the declarations.
+func generate(pkg, source string, decls []*decl) ([]byte, error) {
+	imports := map[string]bool{"github.com/athlum/golang-pkg-pcre/src/pkg/pcre": true}
+	for _, d := range decls {
+		if err := d.compile(source); err != nil {
+			return nil, err
+		}
+		for _, f := range d.Fields {
+			if f.Parse != "" {
+				imports["fmt"] = true
+			}
+			for _, imp := range fieldtypes[f.Type].imports {
+				imports[imp] = true
+			}
+		}
+	}
+	var list []string
+	for imp := range imports {
+		list = append(list, imp)
+	}
+	sort.Strings(list)
+	var b bytes.Buffer
+	err := output.Execute(&b, map[string]interface{}{
+		"Source":  filepath.Base(source),
+		"Package": pkg,
+		"Imports": list,
+		"Decls":   decls,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(b.Bytes())
+}
+
+// Returns the exit status.
+func run(args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("pcregen", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	pkg := fs.String("package", os.Getenv("GOPACKAGE"), "package `name` of the generated file (default $GOPACKAGE)")
+	out := fs.String("o", "", "output `file` (default: input name with _pcre.go)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 || *pkg == "" {
+		fmt.Fprintln(stderr, "usage: pcregen [-package name] [-o file] declarations")
+		return 2
+	}
+	source := fs.Arg(0)
+	if *out == "" {
+		*out = strings.TrimSuffix(source, filepath.Ext(source)) + "_pcre.go"
+	}
+	f, err := os.Open(source)
+	if err != nil {
+		fmt.Fprintln(stderr, "pcregen:", err)
+		return 1
+	}
+	defer f.Close()
+	decls, err := parse(f, source)
+	if err != nil {
+		fmt.Fprintln(stderr, "pcregen:", err)
+		return 1
+	}
+	code, err := generate(*pkg, source, decls)
+	if err == nil {
+		err = ioutil.WriteFile(*out, code, 0644)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "pcregen:", err)
+		return 1
+	}
+	return 0
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden file")
+
+func TestGenerate(t *testing.T) {
+	f, err := os.Open("testdata/logs.pcre")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	decls, err := parse(f, "testdata/logs.pcre")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := generate("logs", "testdata/logs.pcre", decls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *update {
+		ioutil.WriteFile("testdata/logs_pcre.go.golden", code, 0644)
+	}
+	golden, err := ioutil.ReadFile("testdata/logs_pcre.go.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(code, golden) {
+		t.Errorf("output differs from golden file:\n%s", code)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	check := func(input, msg string) {
+		decls, err := parse(strings.NewReader(input), "x.pcre")
+		if err == nil {
+			_, err = generate("x", "x.pcre", decls)
+		}
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%q: %v", input, err)
+		}
+	}
+	check("A /(/", "x.pcre:1: /(/ (2): missing )")
+	check("A /(?<n>x)/\n\tn complex128", "x.pcre:2: unsupported type complex128")
+	check("A /(?<n>x)/\n\tm int", `x.pcre:1: no group named "m"`)
+	check("\tn int", "x.pcre:1: expected group name and type")
+	check("1A /x/", `invalid name "1A"`)
+	check("A /(?<a_b>x)(?<aB>y)/", "both map to field AB")
+	check("A /x/\nB /y/\nA /z/", "x.pcre:3: A redeclared, previous declaration at x.pcre:1")
+	check("Ab /x/\nab /y/", "x.pcre:2: ab redeclared")
+}
+
+// Builds the golden file in a scratch package next to this one and
+// runs a test of it.
+func TestGeneratedCode(t *testing.T) {
+	gotool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go tool")
+	}
+	dir, err := ioutil.TempDir(".", "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	golden, err := ioutil.ReadFile("testdata/logs_pcre.go.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const test = `package logs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	v, ok, err := ParseLogLine("web1 10.0.0.1:8080 15ms hello world")
+	if !ok || err != nil || v.Host != "web1" || v.Port != 8080 || v.Took != 15*time.Millisecond || v.SourceMsg != "hello world" {
+		t.Error(v, ok, err)
+	}
+	if _, ok, err = ParseLogLine("web1 10.0.0.1:8080 soon hello"); !ok || err == nil {
+		t.Error("Took", ok, err)
+	}
+	if _, ok, _ = ParseLogLine("web1"); ok {
+		t.Error("no match")
+	}
+	if w, ok, _ := ParseWord("  HELLO "); !ok || w.Word != "HELLO" {
+		t.Error(w, ok)
+	}
+}
+`
+	for name, data := range map[string][]byte{"logs_pcre.go": golden, "logs_test.go": []byte(test)} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if out, err := exec.Command(gotool, "test", "./"+filepath.Base(dir)).CombinedOutput(); err != nil {
+		t.Errorf("%v\n%s", err, out)
+	}
+}
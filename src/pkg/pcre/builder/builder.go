@@ -0,0 +1,513 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package builder constructs PCRE patterns from Go expressions, which
+// are easier to review than long pattern strings:
+//
+//	host := builder.Named("host", builder.NotSpace.OneOrMore())
+//	port := builder.Group(builder.Digit.Repeat(1, 5))
+//	re, err := builder.Compile(builder.Seq(builder.Start, host,
+//		builder.Literal(":"), port, builder.End), 0)
+//	m, _ := re.MatcherString("example.com:80", 0)
+//	m.GroupString(port.Index()) // "80"
+//
+// Literals are escaped with pcre.QuoteMeta, and parentheses are added
+// where precedence requires them, so the pattern string produced by
+// String is canonical: equal expressions result in equal strings.
+// Groups are numbered when the pattern is produced, in the order
+// PCRE numbers them, and Index returns the number afterwards.
+package builder
+
+import (
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// An expression: a *Node or a *GroupRef.
+type Expr interface {
+	node() *Node
+}
+
+type kind int
+
+const (
+	kindText    kind = iota // a literal, class or escape, in pattern syntax
+	kindRaw                 // pattern syntax given by the user
+	kindSeq                 // a sequence of subexpressions
+	kindAlt                 // alternatives
+	kindRepeat              // a quantified subexpression
+	kindGroup               // a capture group
+	kindWrap                // a subexpression in prefix and ")"
+	kindBackref             // a reference to a group
+	kindInvalid             // an error, reported by String
+)
+
+// Operator precedence, for deciding where (?:...) is needed.
+const (
+	precAlt = iota
+	precSeq
+	precRepeat // a quantified atom, which cannot be quantified again
+	precAtom
+)
+
+// Quantifier modes.
+const (
+	greedy = iota
+	lazy
+	possessive
+)
+
+// A node of an expression.  Nodes are immutable; the methods return
+// new nodes.
+type Node struct {
+	kind     kind
+	text     string // pattern syntax for kindText and kindRaw, prefix for kindWrap, message for kindInvalid
+	atom     bool   // for kindText: a single atom
+	subs     []*Node
+	min, max int // for kindRepeat; max < 0 is unbounded
+	mode     int
+	group    *GroupRef // for kindGroup and kindBackref
+}
+
+func (n *Node) node() *Node {
+	return n
+}
+
+// A reference to a capture group, returned by Group and Named.  It
+// can be used wherever an Expr is expected, but only once in a
+// pattern.
+type GroupRef struct {
+	*Node
+	name  string
+	index int
+}
+
+func (g *GroupRef) node() *Node {
+	return g.Node
+}
+
+// Returns the number of the group in the pattern last produced by
+// String or Compile, for use with pcre.Matcher.Group and similar
+// functions.  Returns 0 before that.
+func (g *GroupRef) Index() int {
+	return g.index
+}
+
+// Returns the name of the group, or "" if it has none.
+func (g *GroupRef) Name() string {
+	return g.name
+}
+
+func nodes(exprs []Expr) []*Node {
+	n := make([]*Node, len(exprs))
+	for i, e := range exprs {
+		n[i] = e.node()
+	}
+	return n
+}
+
+func text(s string, atom bool) *Node {
+	return &Node{kind: kindText, text: s, atom: atom}
+}
+
+func invalid(format string, args ...interface{}) *Node {
+	return &Node{kind: kindInvalid, text: errors.Errorf(format, args...).Error()}
+}
+
+// Predefined expressions.
+var (
+	Any             = text(".", true)
+	Digit           = text(`\d`, true)
+	NotDigit        = text(`\D`, true)
+	Word            = text(`\w`, true)
+	NotWord         = text(`\W`, true)
+	Space           = text(`\s`, true)
+	NotSpace        = text(`\S`, true)
+	Start           = text("^", true)
+	End             = text("$", true)
+	StartText       = text(`\A`, true)
+	EndText         = text(`\z`, true)
+	WordBoundary    = text(`\b`, true)
+	NotWordBoundary = text(`\B`, true)
+)
+
+// Matches s literally.  Only a single byte quotes to a single atom:
+// without UTF8, a multibyte character is several atoms.
+func Literal(s string) *Node {
+	return text(pcre.QuoteMeta(s), len(s) == 1)
+}
+
+// Inserts pattern syntax unchanged.  Capture groups in it are counted
+// when numbering the groups of the pattern.
+func Raw(pattern string) *Node {
+	return &Node{kind: kindRaw, text: pattern}
+}
+
+// Matches the expressions one after the other.
+func Seq(exprs ...Expr) *Node {
+	return &Node{kind: kindSeq, subs: nodes(exprs)}
+}
+
+// Matches one of the expressions, trying them in order.
+func Alt(exprs ...Expr) *Node {
+	return &Node{kind: kindAlt, subs: nodes(exprs)}
+}
+
+// Returns a numbered capture group for the sequence of expressions.
+func Group(exprs ...Expr) *GroupRef {
+	g := &GroupRef{}
+	g.Node = &Node{kind: kindGroup, subs: []*Node{Seq(exprs...)}, group: g}
+	return g
+}
+
+// Returns a named capture group for the sequence of expressions.
+func Named(name string, exprs ...Expr) *GroupRef {
+	g := Group(exprs...)
+	g.name = name
+	if !validname(name) {
+		g.Node = invalid("invalid group name %q", name)
+	}
+	return g
+}
+
+func validname(name string) bool {
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c == '_' || 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' ||
+			i > 0 && '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return name != "" && len(name) <= 32
+}
+
+func wrap(prefix string, exprs []Expr) *Node {
+	return &Node{kind: kindWrap, text: prefix, subs: []*Node{Seq(exprs...)}}
+}
+
+// Asserts that the expressions match at this point.
+func Lookahead(exprs ...Expr) *Node { return wrap("(?=", exprs) }
+
+// Asserts that the expressions do not match at this point.
+func NegativeLookahead(exprs ...Expr) *Node { return wrap("(?!", exprs) }
+
+// Asserts that the expressions match before this point.  PCRE
+// requires each alternative to have a fixed length.
+func Lookbehind(exprs ...Expr) *Node { return wrap("(?<=", exprs) }
+
+// Asserts that the expressions do not match before this point.
+func NegativeLookbehind(exprs ...Expr) *Node { return wrap("(?<!", exprs) }
+
+// Matches the expressions without backtracking into them.
+func Atomic(exprs ...Expr) *Node { return wrap("(?>", exprs) }
+
+// Matches the same text as the group.
+func Backref(g *GroupRef) *Node {
+	return &Node{kind: kindBackref, group: g}
+}
+
+// Matches one character out of the items.  An item is a single
+// character, a range such as "a-z", or one of the escapes \d, \D,
+// \w, \W, \s, \S, \h, \H, \v and \V.
+func Class(items ...string) *Node {
+	return class("[", items)
+}
+
+// Matches one character which is not in the items, as for Class.
+func NotClass(items ...string) *Node {
+	return class("[^", items)
+}
+
+func class(open string, items []string) *Node {
+	if len(items) == 0 {
+		return invalid("empty character class")
+	}
+	var b strings.Builder
+	b.WriteString(open)
+	for _, item := range items {
+		switch n := utf8.RuneCountInString(item); {
+		case n == 1:
+			b.WriteString(pcre.QuoteMeta(item))
+		case len(item) == 2 && item[0] == '\\' && strings.IndexByte("dDwWsShHvV", item[1]) >= 0:
+			b.WriteString(item)
+		case n == 3 && strings.ContainsRune(item, '-'):
+			lo, size := utf8.DecodeRuneInString(item)
+			hi, _ := utf8.DecodeRuneInString(item[size+1:])
+			if item[size] != '-' || lo > hi {
+				return invalid("invalid class range %q", item)
+			}
+			b.WriteString(pcre.QuoteMeta(string(lo)) + "-" + pcre.QuoteMeta(string(hi)))
+		default:
+			return invalid("invalid class item %q", item)
+		}
+	}
+	b.WriteByte(']')
+	return text(b.String(), true)
+}
+
+// Matches the node between min and max times; max < 0 means no upper
+// limit.  The repetition is greedy; use Lazy or Possessive to change
+// that.
+func (n *Node) Repeat(min, max int) *Node {
+	if min < 0 || max >= 0 && max < min {
+		return invalid("invalid repetition {%d,%d}", min, max)
+	}
+	return &Node{kind: kindRepeat, subs: []*Node{n}, min: min, max: max}
+}
+
+// Matches the node any number of times.
+func (n *Node) ZeroOrMore() *Node { return n.Repeat(0, -1) }
+
+// Matches the node at least once.
+func (n *Node) OneOrMore() *Node { return n.Repeat(1, -1) }
+
+// Matches the node once or not at all.
+func (n *Node) Optional() *Node { return n.Repeat(0, 1) }
+
+// Matches the node exactly count times.
+func (n *Node) Times(count int) *Node { return n.Repeat(count, count) }
+
+func (n *Node) withmode(mode int) *Node {
+	if n.kind != kindRepeat {
+		return invalid("Lazy and Possessive apply to repetitions only")
+	}
+	r := *n
+	r.mode = mode
+	return &r
+}
+
+// Makes a repetition match as few times as possible.
+func (n *Node) Lazy() *Node { return n.withmode(lazy) }
+
+// Makes a repetition match as many times as possible, without giving
+// any back.
+func (n *Node) Possessive() *Node { return n.withmode(possessive) }
+
+// Returns the sequence of the node and the expressions.
+func (n *Node) Then(exprs ...Expr) *Node {
+	return Seq(append([]Expr{n}, exprs...)...)
+}
+
+// Returns the alternatives of the node and the expressions.
+func (n *Node) Or(exprs ...Expr) *Node {
+	return Alt(append([]Expr{n}, exprs...)...)
+}
+
+// State while producing a pattern.
+type writer struct {
+	b      strings.Builder
+	groups []*GroupRef // by index - 1; nil for groups in Raw nodes
+	seen   map[*GroupRef]bool
+}
+
+// Number the groups in the order of their opening parentheses.
+func (w *writer) number(n *Node) error {
+	switch n.kind {
+	case kindInvalid:
+		return errors.New(n.text)
+	case kindGroup:
+		if w.seen[n.group] {
+			return errors.Errorf("group %d used twice", n.group.index)
+		}
+		w.seen[n.group] = true
+		w.groups = append(w.groups, n.group)
+		n.group.index = len(w.groups)
+	case kindRaw:
+		re, err := pcre.Compile(n.text, 0)
+		if err != nil {
+			return errors.Wrap(err, "Raw")
+		}
+		for i := 0; i < re.Groups(); i++ {
+			w.groups = append(w.groups, nil)
+		}
+	}
+	for _, sub := range n.subs {
+		if err := w.number(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *Node) prec() int {
+	switch n.kind {
+	case kindText:
+		if n.atom {
+			return precAtom
+		}
+		return precSeq
+	case kindSeq, kindAlt:
+		if len(n.subs) == 1 {
+			return n.subs[0].prec()
+		}
+		if n.kind == kindSeq {
+			return precSeq
+		}
+		return precAlt
+	case kindRaw:
+		return precAlt
+	case kindRepeat:
+		return precRepeat
+	}
+	return precAtom
+}
+
+// Write n, in (?:...) if it binds less tightly than prec.
+func (w *writer) write(n *Node, prec int) error {
+	if (n.kind == kindSeq || n.kind == kindAlt) && len(n.subs) == 1 {
+		return w.write(n.subs[0], prec)
+	}
+	if n.prec() < prec {
+		w.b.WriteString("(?:")
+		defer w.b.WriteByte(')')
+	}
+	switch n.kind {
+	case kindText, kindRaw:
+		w.b.WriteString(n.text)
+	case kindSeq:
+		for _, sub := range n.subs {
+			if err := w.write(sub, precSeq); err != nil {
+				return err
+			}
+		}
+	case kindAlt:
+		for i, sub := range n.subs {
+			if i > 0 {
+				w.b.WriteByte('|')
+			}
+			if err := w.write(sub, precSeq); err != nil {
+				return err
+			}
+		}
+	case kindRepeat:
+		if err := w.write(n.subs[0], precAtom); err != nil {
+			return err
+		}
+		switch {
+		case n.min == 0 && n.max < 0:
+			w.b.WriteByte('*')
+		case n.min == 1 && n.max < 0:
+			w.b.WriteByte('+')
+		case n.min == 0 && n.max == 1:
+			w.b.WriteByte('?')
+		case n.min == n.max:
+			w.b.WriteString("{" + strconv.Itoa(n.min) + "}")
+		case n.max < 0:
+			w.b.WriteString("{" + strconv.Itoa(n.min) + ",}")
+		default:
+			w.b.WriteString("{" + strconv.Itoa(n.min) + "," + strconv.Itoa(n.max) + "}")
+		}
+		switch n.mode {
+		case lazy:
+			w.b.WriteByte('?')
+		case possessive:
+			w.b.WriteByte('+')
+		}
+	case kindGroup:
+		if n.group.name != "" {
+			w.b.WriteString("(?<" + n.group.name + ">")
+		} else {
+			w.b.WriteByte('(')
+		}
+		if err := w.write(n.subs[0], precAlt); err != nil {
+			return err
+		}
+		w.b.WriteByte(')')
+	case kindWrap:
+		w.b.WriteString(n.text)
+		if err := w.write(n.subs[0], precAlt); err != nil {
+			return err
+		}
+		w.b.WriteByte(')')
+	case kindBackref:
+		switch {
+		case !w.seen[n.group]:
+			return errors.New("back reference to a group which is not in the pattern")
+		case n.group.name != "":
+			w.b.WriteString(`\k<` + n.group.name + ">")
+		default:
+			w.b.WriteString(`\g{` + strconv.Itoa(n.group.index) + "}")
+		}
+	}
+	return nil
+}
+
+func (w *writer) pattern(e Expr) (string, error) {
+	w.seen = make(map[*GroupRef]bool)
+	if err := w.number(e.node()); err != nil {
+		return "", err
+	}
+	if err := w.write(e.node(), precAlt); err != nil {
+		return "", err
+	}
+	return w.b.String(), nil
+}
+
+// Returns the pattern for the expression and numbers its groups.
+// Errors in the expression, such as invalid class ranges or a group
+// used twice, are reported here.
+func String(e Expr) (string, error) {
+	var w writer
+	return w.pattern(e)
+}
+
+// Compiles the pattern for the expression with pcre.Compile, and
+// checks that the groups have the numbers which Index reports.
+// Compilation errors are returned as *pcre.CompileError.
+func Compile(e Expr, flags int) (pcre.Regexp, error) {
+	var w writer
+	pattern, err := w.pattern(e)
+	if err != nil {
+		return pcre.Regexp{}, err
+	}
+	re, cerr := pcre.Compile(pattern, flags)
+	if cerr != nil {
+		return pcre.Regexp{}, cerr
+	}
+	if re.Groups() != len(w.groups) {
+		return pcre.Regexp{}, errors.Errorf("%s: expected %d groups, PCRE found %d",
+			pattern, len(w.groups), re.Groups())
+	}
+	names := re.NamedGroups()
+	for _, g := range w.groups {
+		if g != nil && g.name != "" && names[g.name] != g.index {
+			return pcre.Regexp{}, errors.Errorf("%s: group %q is not number %d",
+				pattern, g.name, g.index)
+		}
+	}
+	return re, nil
+}
+
+// Compiles the pattern for the expression.  If that fails, panic.
+func MustCompile(e Expr, flags int) pcre.Regexp {
+	re, err := Compile(e, flags)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
@@ -0,0 +1,90 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	check := func(e Expr, want string) {
+		got, err := String(e)
+		if err != nil {
+			t.Error(want, err)
+		} else if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	check(Literal("a.b"), `a\.b`)
+	check(Literal("ab").OneOrMore(), `(?:ab)+`)
+	check(Literal("a").ZeroOrMore().Lazy(), `a*?`)
+	check(Literal("\n").Optional(), `\x0a?`)
+	check(Literal("\u00e9").OneOrMore(), "(?:\u00e9)+")
+	check(Literal("\u2028").Optional(), "(?:\\Q\u2028\\E)?")
+	check(Digit.Repeat(2, 4).Possessive(), `\d{2,4}+`)
+	check(Digit.Repeat(2, -1), `\d{2,}`)
+	check(Word.Times(3).Optional(), `(?:\w{3})?`)
+	check(Seq(Literal("a"), Alt(Literal("b"), Literal("cd")), End), `a(?:b|cd)$`)
+	check(Alt(Seq(Literal("a"), Literal("b")), Literal("c")), `ab|c`)
+	check(Seq(Alt(Literal("x"), Literal("y"))).OneOrMore(), `(?:x|y)+`)
+	check(Class("a-z", "_", "-", "]", `\d`), `[a-z_\-\]\d]`)
+	check(NotClass(" "), `[^\ ]`)
+	check(Seq(Lookbehind(Literal("$")), Digit.OneOrMore(), NegativeLookahead(Literal("%"))),
+		`(?<=\$)\d+(?!\%)`)
+	check(Atomic(Alt(Literal("a"), Literal("b"))), `(?>a|b)`)
+	check(Raw("x|y").Then(Literal("z")), `(?:x|y)z`)
+	q := Group(Class(`"`, "'"))
+	check(Seq(q, NotClass(`"`, "'").ZeroOrMore(), Backref(q)), `([\"\'])[^\"\']*\g{1}`)
+	n := Named("n", Digit)
+	check(Seq(n, Backref(n)), `(?<n>\d)\k<n>`)
+}
+
+func TestErrors(t *testing.T) {
+	check := func(e Expr, msg string) {
+		_, err := String(e)
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Error(msg, err)
+		}
+	}
+	check(Class("z-a"), `invalid class range "z-a"`)
+	check(Class("abc"), `invalid class item "abc"`)
+	check(Digit.Repeat(3, 2), "invalid repetition")
+	check(Digit.Lazy(), "repetitions only")
+	check(Named("1x", Digit), `invalid group name "1x"`)
+	g := Group(Digit)
+	check(Seq(g, g), "group 1 used twice")
+	check(Backref(Group(Digit)), "not in the pattern")
+	_, err := Compile(Raw("("), 0)
+	if err == nil {
+		t.Error("Raw compile error")
+	}
+}
+
+// The pattern from TestNamedGroup in package pcre.
+func TestCompile(t *testing.T) {
+	field := func(name string) *GroupRef {
+		return Named(name, Any.ZeroOrMore())
+	}
+	hostname, ip, topic, msg := field("hostname"), field("ip"), field("topic"), field("source_msg")
+	raw := Raw("(x)?")
+	re := MustCompile(Seq(
+		Literal("{hostname: "), hostname,
+		Literal(", ip: "), ip,
+		raw,
+		Literal(", topic: "), topic,
+		Literal("} "), msg), 0)
+	if re.String() != `\{hostname\:\ (?<hostname>.*)\,\ ip\:\ (?<ip>.*)(?:(x)?)\,\ topic\:\ (?<topic>.*)\}\ (?<source_msg>.*)` {
+		t.Error(re.String())
+	}
+	if hostname.Index() != 1 || ip.Index() != 2 || topic.Index() != 4 || msg.Index() != 5 {
+		t.Error("Index", hostname.Index(), ip.Index(), topic.Index(), msg.Index())
+	}
+	m, _ := MustCompile(Literal("\u00e9").OneOrMore(), 0).MatcherString("\u00e9\u00e9", 0)
+	if m.GroupString(0) != "\u00e9\u00e9" {
+		t.Errorf("multibyte literal without UTF8: %q", m.GroupString(0))
+	}
+	m, _ = re.MatcherString("{hostname: h.example, ip: 10.0.0.1, topic: a.b} {}", 0)
+	if m.GroupString(ip.Index()) != "10.0.0.1" || m.GroupString(topic.Index()) != "a.b" ||
+		m.GroupString(msg.Index()) != "{}" {
+		t.Error("groups", m.NamedStringMap())
+	}
+}
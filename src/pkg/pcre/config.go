@@ -0,0 +1,162 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package pcre
+
+/*
+#cgo LDFLAGS: -lpcre
+#cgo CFLAGS: -I/opt/local/include
+#include <pcre.h>
+*/
+import "C"
+
+import (
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// Build-time configuration of the libpcre library in use, as reported
+// by pcre_version and pcre_config.
+type Configuration struct {
+	Version             string  // pcre_version()
+	UTF8                bool    // UTF-8 support
+	UCP                 bool    // Unicode property support (\p, UCP)
+	JIT                 bool    // just-in-time compiler support
+	JITTarget           string  // JIT target architecture, or ""
+	Newline             Newline // default newline convention
+	BSR                 BSR     // default meaning of \R
+	LinkSize            int     // internal link size in bytes
+	MatchLimit          uint64  // default match limit
+	MatchLimitRecursion uint64  // default recursion limit
+}
+
+func configint(what C.int) int {
+	var value C.int
+	C.pcre_config(what, unsafe.Pointer(&value))
+	return int(value)
+}
+
+func configulong(what C.int) uint64 {
+	var value C.ulong
+	C.pcre_config(what, unsafe.Pointer(&value))
+	return uint64(value)
+}
+
+// Returns the configuration of the libpcre library in use.
+func Config() (c Configuration) {
+	c.Version = C.GoString(C.pcre_version())
+	c.UTF8 = configint(C.PCRE_CONFIG_UTF8) != 0
+	c.UCP = configint(C.PCRE_CONFIG_UNICODE_PROPERTIES) != 0
+	c.JIT = configint(C.PCRE_CONFIG_JIT) != 0
+	if c.JIT {
+		var target *C.char
+		C.pcre_config(C.PCRE_CONFIG_JITTARGET, unsafe.Pointer(&target))
+		if target != nil {
+			c.JITTarget = C.GoString(target)
+		}
+	}
+	switch configint(C.PCRE_CONFIG_NEWLINE) {
+	case 13:
+		c.Newline = NewlineCR
+	case 10:
+		c.Newline = NewlineLF
+	case 3338:
+		c.Newline = NewlineCRLF
+	case -1:
+		c.Newline = NewlineAny
+	case -2:
+		c.Newline = NewlineAnyCRLF
+	}
+	if configint(C.PCRE_CONFIG_BSR) != 0 {
+		c.BSR = BSRAnyCRLF
+	} else {
+		c.BSR = BSRUnicode
+	}
+	c.LinkSize = configint(C.PCRE_CONFIG_LINK_SIZE)
+	c.MatchLimit = configulong(C.PCRE_CONFIG_MATCH_LIMIT)
+	c.MatchLimitRecursion = configulong(C.PCRE_CONFIG_MATCH_LIMIT_RECURSION)
+	return
+}
+
+// A library capability which can be checked with RequireFeatures.
+type Feature int
+
+const (
+	FeatureUTF8 Feature = iota // UTF8 flag
+	FeatureUCP                 // UCP flag and \p escapes
+	FeatureJIT                 // just-in-time compilation
+)
+
+func (f Feature) String() string {
+	switch f {
+	case FeatureUTF8:
+		return "UTF-8"
+	case FeatureUCP:
+		return "Unicode properties"
+	case FeatureJIT:
+		return "JIT"
+	}
+	return "Feature(" + strconv.Itoa(int(f)) + ")"
+}
+
+func (c Configuration) has(f Feature) bool {
+	switch f {
+	case FeatureUTF8:
+		return c.UTF8
+	case FeatureUCP:
+		return c.UCP
+	case FeatureJIT:
+		return c.JIT
+	}
+	return false
+}
+
+// Returns an error naming every feature which the libpcre library in
+// use lacks.  Call it during program initialization, so that a build
+// of libpcre without, say, UTF-8 support is detected before it
+// produces wrong match results.
+func RequireFeatures(features ...Feature) error {
+	c := Config()
+	var missing []string
+	for _, f := range features {
+		if !c.has(f) {
+			missing = append(missing, f.String())
+		}
+	}
+	if missing != nil {
+		return errors.Errorf("libpcre %s lacks support for %s",
+			c.Version, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Like RequireFeatures, but panics if a feature is missing.
+func MustRequireFeatures(features ...Feature) {
+	if err := RequireFeatures(features...); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,43 @@
+package pcre
+
+import (
+	"testing"
+)
+
+func TestConfig(t *testing.T) {
+	c := Config()
+	if c.Version == "" {
+		t.Error("Version")
+	}
+	if c.LinkSize < 2 || c.LinkSize > 4 {
+		t.Error("LinkSize", c.LinkSize)
+	}
+	if c.MatchLimit == 0 || c.MatchLimitRecursion == 0 {
+		t.Error("MatchLimit", c.MatchLimit, c.MatchLimitRecursion)
+	}
+	if !c.Newline.valid() || c.Newline == NewlineDefault {
+		t.Error("Newline", c.Newline)
+	}
+	if c.BSR != BSRUnicode && c.BSR != BSRAnyCRLF {
+		t.Error("BSR", c.BSR)
+	}
+	if c.JIT != (c.JITTarget != "") {
+		t.Error("JITTarget", c.JIT, c.JITTarget)
+	}
+}
+
+func TestRequireFeatures(t *testing.T) {
+	if err := RequireFeatures(); err != nil {
+		t.Error(err)
+	}
+	c := Config()
+	for _, f := range []Feature{FeatureUTF8, FeatureUCP, FeatureJIT} {
+		err := RequireFeatures(f)
+		if c.has(f) != (err == nil) {
+			t.Error(f, err)
+		}
+	}
+	if err := RequireFeatures(Feature(-1)); err == nil {
+		t.Error("unknown feature accepted")
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package cover reports which alternatives and optional groups of a
+// pattern a corpus exercises.
+//
+// Run inserts a callout (?C) at the end of each alternative and of the
+// body of each optional group, matches the corpus with
+// Matcher.TraceCallouts, and counts how often each callout was
+// reached in the attempt which produced a match.  An alternative which
+// is never reached is dead for that corpus.  The report can be written
+// as text or, like go tool cover -html, as an HTML page with the
+// pattern source highlighted.
+package cover
+
+import (
+	"fmt"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre/syntax"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// The kind of a part of the pattern which is covered.
+type Kind int
+
+const (
+	Branch   Kind = iota + 1 // an alternative of | or of a conditional
+	Optional                 // a group quantified with minimum 0, such as (...)?
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Branch:
+		return "branch"
+	case Optional:
+		return "optional"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// A part of the pattern and how often matching got to its end.
+type Item struct {
+	Kind     Kind
+	Span     syntax.Span // the alternative, or the quantified group
+	Text     string
+	Count    int // times reached, over all subjects
+	Subjects int // subjects in which it was reached
+}
+
+// Reports whether the item was reached at all.
+func (it Item) Covered() bool {
+	return it.Count > 0
+}
+
+// The coverage of a pattern over a corpus.  Items are in the order of
+// their start in the pattern.
+type Report struct {
+	Pattern   string
+	Flags     int // compile flags
+	Subjects  int // subjects matched against
+	Matched   int // subjects which matched
+	Truncated int // subjects with more than pcre.MaxTraceSteps steps
+	Items     []Item
+}
+
+// Matches re against each subject of the corpus with the exec flags
+// and returns the coverage of its alternatives and optional groups.
+// Only the matching attempt which succeeded counts; subjects which do
+// not match add nothing.  An item is reached even if matching
+// backtracks into it afterwards and takes another way.  Items reached
+// only after the step limit of a truncated subject are missed.
+func Run(re pcre.Regexp, corpus []string, flags int) (*Report, error) {
+	r := &Report{Pattern: re.String(), Flags: re.Flags()}
+	parsed, cerr := syntax.Parse(r.Pattern, r.Flags)
+	if cerr != nil {
+		return nil, cerr
+	}
+	points := r.items(parsed)
+	instrumented, callouts := instrument(r.Pattern, points)
+	c, cerr := pcre.Compile(instrumented, r.Flags)
+	if cerr != nil {
+		return nil, cerr
+	}
+	m, err := c.MatcherString("", 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, subject := range corpus {
+		t, err := m.TraceCalloutsString(subject, flags)
+		if err != nil {
+			return nil, err
+		}
+		r.Subjects++
+		if t.Truncated {
+			r.Truncated++
+		}
+		if t.Match == nil {
+			continue
+		}
+		r.Matched++
+		seen := make(map[int]bool)
+		for _, s := range t.Steps {
+			if s.Callout != 0 || s.Start != t.Match[0] {
+				continue
+			}
+			for _, i := range callouts[s.Pattern] {
+				r.Items[i].Count++
+				if !seen[i] {
+					seen[i] = true
+					r.Items[i].Subjects++
+				}
+			}
+		}
+	}
+	return r, nil
+}
+
+// Collects the items of the pattern and returns, for each, the offset
+// at which its callout goes.
+func (r *Report) items(re *syntax.Regexp) []int {
+	var points []int
+	add := func(kind Kind, span syntax.Span, body syntax.Node) {
+		r.Items = append(r.Items, Item{Kind: kind, Span: span, Text: r.Pattern[span.Start:span.End]})
+		points = append(points, end(body))
+	}
+	syntax.Walk(re.Root, func(n syntax.Node) bool {
+		switch n := n.(type) {
+		case *syntax.Alternation:
+			for _, alt := range n.Alts {
+				add(Branch, alt.Span(), alt)
+			}
+		case *syntax.Conditional:
+			if n.Cond == syntax.CondDefine {
+				// Only called as a subroutine.
+				break
+			}
+			add(Branch, n.Yes.Span(), n.Yes)
+			if n.No != nil {
+				add(Branch, n.No.Span(), n.No)
+			}
+		case *syntax.Repeat:
+			if g, ok := n.Sub.(*syntax.Group); ok && n.Min == 0 {
+				add(Optional, n.Span(), g.Sub)
+			}
+		}
+		return true
+	})
+	// Walk visits both branches of a conditional before the
+	// alternatives inside the first one.
+	order := make([]int, len(r.Items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return r.Items[order[i]].Span.Start < r.Items[order[j]].Span.Start
+	})
+	items := make([]Item, len(order))
+	sorted := make([]int, len(order))
+	for i, j := range order {
+		items[i], sorted[i] = r.Items[j], points[j]
+	}
+	r.Items = items
+	return sorted
+}
+
+// Returns the offset after the last item of n which is not a comment,
+// so that a callout there is not part of a # comment.
+func end(n syntax.Node) int {
+	if c, ok := n.(*syntax.Concat); ok {
+		for i := len(c.Items) - 1; i >= 0; i-- {
+			if _, ok := c.Items[i].(*syntax.Comment); !ok {
+				return c.Items[i].Span().End
+			}
+		}
+		return n.Span().Start
+	}
+	return n.Span().End
+}
+
+// Returns the pattern with a callout (?C) inserted at each point, and
+// the items of each callout by the offset of the item after it in the
+// new pattern, which the callout reports.
+func instrument(pattern string, points []int) (string, map[int][]int) {
+	byoffset := make(map[int][]int)
+	var offsets []int
+	for i, p := range points {
+		if byoffset[p] == nil {
+			offsets = append(offsets, p)
+		}
+		byoffset[p] = append(byoffset[p], i)
+	}
+	sort.Ints(offsets)
+	var b strings.Builder
+	callouts := make(map[int][]int)
+	last := 0
+	for _, p := range offsets {
+		b.WriteString(pattern[last:p])
+		b.WriteString("(?C)")
+		callouts[b.Len()] = byoffset[p]
+		last = p
+	}
+	b.WriteString(pattern[last:])
+	return b.String(), callouts
+}
+
+// Returns the fraction of the items which were reached, or 1 if the
+// pattern has none.
+func (r *Report) Coverage() float64 {
+	if len(r.Items) == 0 {
+		return 1
+	}
+	n := 0
+	for _, it := range r.Items {
+		if it.Covered() {
+			n++
+		}
+	}
+	return float64(n) / float64(len(r.Items))
+}
+
+// Returns the items which were never reached.
+func (r *Report) Uncovered() []Item {
+	var items []Item
+	for _, it := range r.Items {
+		if !it.Covered() {
+			items = append(items, it)
+		}
+	}
+	return items
+}
+
+// Returns a summary line in the style of go test -cover and a table of
+// the items.
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "coverage: %.1f%% of %d branches and optional groups (%d of %d subjects matched",
+		100*r.Coverage(), len(r.Items), r.Matched, r.Subjects)
+	if r.Truncated > 0 {
+		fmt.Fprintf(&b, ", %d truncated", r.Truncated)
+	}
+	b.WriteString(")\n")
+	w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "offset\tkind\tcount\tsubjects\titem")
+	for _, it := range r.Items {
+		text := strings.Replace(it.Text, "\n", " ", -1)
+		if !it.Covered() {
+			text += "  (never taken)"
+		}
+		fmt.Fprintf(w, "%d-%d\t%s\t%d\t%d\t%s\n", it.Span.Start, it.Span.End, it.Kind, it.Count, it.Subjects, text)
+	}
+	w.Flush()
+	return b.String()
+}
@@ -0,0 +1,90 @@
+package cover
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"strings"
+	"testing"
+)
+
+func counts(r *Report) string {
+	var s []string
+	for _, it := range r.Items {
+		s = append(s, fmt.Sprintf("%s:%d/%d", it.Text, it.Count, it.Subjects))
+	}
+	return strings.Join(s, " ")
+}
+
+func TestRun(t *testing.T) {
+	check := func(pattern string, flags int, corpus []string, want string) {
+		r, err := Run(pcre.MustCompile(pattern, flags), corpus, 0)
+		if err != nil {
+			t.Error(pattern, err)
+			return
+		}
+		if got := counts(r); got != want {
+			t.Errorf("%q: got %s, want %s", pattern, got, want)
+		}
+	}
+	check(`^(?:cat|dog|bird)s?( \d+)?(?(1)x|y)$`, 0, []string{"cats", "dog 1x", "dogy", "cow"},
+		`cat:0/0 dog:2/2 bird:0/0 ( \d+)?:1/1 x:1/1 y:1/1`)
+	check(`(?:a|b)+`, 0, []string{"abab", "c"}, `a:2/1 b:2/1`)
+	check(`(?:ab|a)c`, 0, []string{"ac"}, `ab:0/0 a:1/1`)
+	// Reached, even though matching backtracks to the other branch.
+	check(`(a|ab)c`, 0, []string{"abc"}, `a:1/1 ab:1/1`)
+	// Only the attempt which matched counts.
+	check(`(?:x|y)z`, 0, []string{"xyz"}, `x:0/0 y:1/1`)
+	check(`(?:a(b|c)?)?d`, 0, []string{"ad", "acd"}, `(?:a(b|c)?)?:2/2 (b|c)?:1/1 b:0/0 c:1/1`)
+	check(`(?(DEFINE)(?<n>\d))(?&n)|x`, 0, []string{"1"}, `(?(DEFINE)(?<n>\d))(?&n):1/1 x:0/0`)
+	check("a # first\n| b # second", pcre.EXTENDED, []string{"b"}, "a # first\n:0/0  b # second:1/1")
+}
+
+func TestReport(t *testing.T) {
+	r, _ := Run(pcre.MustCompile(`(?:on|off|auto)`, 0), []string{"on", "off", "on"}, 0)
+	if c := r.Coverage(); c < 0.66 || c > 0.67 {
+		t.Error(c)
+	}
+	if u := r.Uncovered(); len(u) != 1 || u[0].Text != "auto" || u[0].Span.Start != 10 || u[0].Kind != Branch {
+		t.Error(u)
+	}
+	s := r.String()
+	if !strings.HasPrefix(s, "coverage: 66.7% of 3 branches and optional groups (3 of 3 subjects matched)\n") ||
+		!strings.Contains(s, "auto  (never taken)") {
+		t.Error(s)
+	}
+	empty, _ := Run(pcre.MustCompile(`abc`, 0), nil, 0)
+	if empty.Coverage() != 1 || len(empty.Items) != 0 {
+		t.Error(empty)
+	}
+}
+
+func TestReportTruncated(t *testing.T) {
+	defer func(n int) { pcre.MaxTraceSteps = n }(pcre.MaxTraceSteps)
+	pcre.MaxTraceSteps = 5
+	r, _ := Run(pcre.MustCompile(`(?:a|b)*\d`, 0), []string{"ababababab1", "1"}, 0)
+	if r.Truncated != 1 || !strings.Contains(r.String(), "(2 of 2 subjects matched, 1 truncated)\n") {
+		t.Error(r)
+	}
+	var b bytes.Buffer
+	if err := WriteHTML(&b, r); err != nil || !strings.Contains(b.String(), "subjects matched, 1 truncated</h2>") {
+		t.Error(b.String(), err)
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	r, _ := Run(pcre.MustCompile(`<(?:b|i)>`, 0), []string{"<b>"}, 0)
+	var b bytes.Buffer
+	if err := WriteHTML(&b, r); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`&lt;(?:<span class="cov10" title="branch 4-5: 1 times in 1 subjects">b</span>|`,
+		`<span class="cov0" title="branch 6-7: 0 times in 0 subjects">i</span>)&gt;`,
+		`50.0% of 2 branches`,
+	} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("no %q in %s", s, b.String())
+		}
+	}
+}
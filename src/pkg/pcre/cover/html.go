@@ -0,0 +1,131 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package cover
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+)
+
+// A run of the pattern source which is innermost in the same item.
+type segment struct {
+	Text  string
+	Class string // cov0 to cov10, or "" outside any item
+	Title string
+}
+
+type section struct {
+	*Report
+	Percent  float64
+	Segments []segment
+}
+
+// Splits the pattern into segments, each highlighted by the innermost
+// item containing it: red if it was never reached, and brighter green
+// the more often it was reached.
+func (r *Report) segments() []segment {
+	max := 0
+	for _, it := range r.Items {
+		if it.Count > max {
+			max = it.Count
+		}
+	}
+	innermost := make([]int, len(r.Pattern))
+	for i := range innermost {
+		innermost[i] = -1
+		for j, it := range r.Items {
+			if it.Span.Start <= i && i < it.Span.End {
+				if k := innermost[i]; k < 0 || it.Span.End-it.Span.Start <= r.Items[k].Span.End-r.Items[k].Span.Start {
+					innermost[i] = j
+				}
+			}
+		}
+	}
+	var segments []segment
+	for start := 0; start < len(r.Pattern); {
+		end := start + 1
+		for end < len(r.Pattern) && innermost[end] == innermost[start] {
+			end++
+		}
+		s := segment{Text: r.Pattern[start:end]}
+		if j := innermost[start]; j >= 0 {
+			it := r.Items[j]
+			s.Class = "cov0"
+			if it.Covered() {
+				s.Class = "cov" + strconv.Itoa(1+9*it.Count/max)
+			}
+			s.Title = fmt.Sprintf("%s %d-%d: %d times in %d subjects", it.Kind, it.Span.Start, it.Span.End, it.Count, it.Subjects)
+		}
+		segments = append(segments, s)
+		start = end
+	}
+	return segments
+}
+
+// Writes an HTML page with the source of each pattern, in which the
+// branches and optional groups are colored as by go tool cover -html,
+// and hovering over one shows its counts.
+func WriteHTML(w io.Writer, reports ...*Report) error {
+	var sections []section
+	for _, r := range reports {
+		sections = append(sections, section{r, 100 * r.Coverage(), r.segments()})
+	}
+	return page.Execute(w, sections)
+}
+
+var page = template.Must(template.New("cover").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta http-equiv="Content-Type" content="text/html; charset=utf-8">
+<title>pattern coverage</title>
+<style>
+body { background: black; color: rgb(80, 80, 80); font-family: Menlo, monospace; }
+h2 { color: rgb(192, 192, 192); font-size: 100%; font-weight: normal; }
+pre { white-space: pre-wrap; word-break: break-all; font-size: 120%; }
+.cov0 { color: rgb(192, 0, 0) }
+.cov1 { color: rgb(128, 128, 128) }
+.cov2 { color: rgb(116, 140, 131) }
+.cov3 { color: rgb(104, 152, 134) }
+.cov4 { color: rgb(92, 164, 137) }
+.cov5 { color: rgb(80, 176, 140) }
+.cov6 { color: rgb(68, 188, 143) }
+.cov7 { color: rgb(56, 200, 146) }
+.cov8 { color: rgb(44, 212, 149) }
+.cov9 { color: rgb(32, 224, 152) }
+.cov10 { color: rgb(20, 236, 155) }
+</style>
+</head>
+<body>
+<p><span class="cov0">never taken</span> <span class="cov1">low count</span> <span class="cov10">high count</span> <span>outside branches</span></p>
+{{range .}}
+<h2>{{printf "%.1f" .Percent}}% of {{len .Items}} branches and optional groups, {{.Matched}} of {{.Subjects}} subjects matched{{if .Truncated}}, {{.Truncated}} truncated{{end}}</h2>
+<pre>{{range .Segments}}{{if .Class}}<span class="{{.Class}}" title="{{.Title}}">{{.Text}}</span>{{else}}{{.Text}}{{end}}{{end}}</pre>
+{{end}}
+</body>
+</html>
+`))
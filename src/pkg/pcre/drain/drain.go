@@ -0,0 +1,264 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package drain groups log lines into templates, in the manner of the
+// Drain algorithm, and turns each template into a pattern.
+//
+// Lines are split at white space.  Numbers, IP addresses and long hex
+// strings are variable from the start, also as the value of key=value
+// tokens.  A fixed-depth tree, keyed by the number of tokens and the
+// first tokens of a line, leads to a few clusters, and the line joins
+// the one whose template shares the most tokens with it, if enough.
+// Tokens in which a line and its cluster differ become variables of
+// the template.
+//
+//	m := drain.New()
+//	for scanner.Scan() {
+//		m.Add(scanner.Text())
+//	}
+//	m.WritePatterns(os.Stdout)
+//
+// Each variable becomes a named group whose pattern is the narrowest
+// of integer, number, IP address, hex string, word and any non-space
+// text which fits all values seen.
+package drain
+
+import (
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"strings"
+)
+
+// A template token for a variable.  A key=value token whose values
+// vary is key=<*>.
+const Wildcard = "<*>"
+
+// Clusters lines online.  It is not safe for concurrent use.  The
+// fields can be changed before the first line is added.
+type Miner struct {
+	Depth       int     // levels of the tree including the root and the clusters, at least 3
+	Similarity  float64 // the least fraction of shared tokens to join a cluster
+	MaxChildren int     // the most children of a node of the tree
+
+	root     *node
+	clusters []*Cluster
+}
+
+// A node of the tree.  Inner nodes have children by token, leaves have
+// clusters.
+type node struct {
+	children map[string]*node
+	clusters []*Cluster
+}
+
+// A template and the lines which were added to it.
+type Cluster struct {
+	ID     int      // from 1, in the order of creation
+	Tokens []string // the template
+	Size   int      // lines added
+	vars   map[int]*variable
+}
+
+// Returns a miner with Depth 4, Similarity 0.4 and MaxChildren 100.
+func New() *Miner {
+	return &Miner{Depth: 4, Similarity: 0.4, MaxChildren: 100, root: &node{children: make(map[string]*node)}}
+}
+
+// Returns the template with its tokens separated by spaces.
+func (c *Cluster) Template() string {
+	return strings.Join(c.Tokens, " ")
+}
+
+// Returns the clusters, in the order of creation.
+func (m *Miner) Clusters() []*Cluster {
+	return m.clusters
+}
+
+// Splits key=value into key and value, if key is a valid group name
+// and value is not empty.
+func keyvalue(token string) (string, string, bool) {
+	i := strings.IndexByte(token, '=')
+	if i <= 0 || i == len(token)-1 || !validname(token[:i]) {
+		return "", "", false
+	}
+	return token[:i], token[i+1:], true
+}
+
+func validname(s string) bool {
+	if s == "" || len(s) > 32 || '0' <= s[0] && s[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !(c == '_' || '0' <= c && c <= '9' || 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the token with a value which is a number, an IP address or
+// a hex string replaced by Wildcard, and the value replaced, if any.
+func mask(token string) (string, string) {
+	if types(token)&(integer|number|ipv4|hex) != 0 {
+		return Wildcard, token
+	}
+	if key, value, ok := keyvalue(token); ok && types(value)&(integer|number|ipv4|hex) != 0 {
+		return key + "=" + Wildcard, value
+	}
+	return token, ""
+}
+
+func hasdigit(s string) bool {
+	return strings.IndexAny(s, "0123456789") >= 0
+}
+
+// Adds a line and returns its cluster.
+func (m *Miner) Add(line string) *Cluster {
+	tokens := strings.Fields(line)
+	masked := make([]string, len(tokens))
+	for i, t := range tokens {
+		masked[i], _ = mask(t)
+	}
+	leaf := m.leaf(masked)
+	var best *Cluster
+	bestsim, bestvars := -1.0, -1
+	for _, c := range leaf.clusters {
+		sim, vars := c.similarity(masked)
+		if sim > bestsim || sim == bestsim && vars > bestvars {
+			best, bestsim, bestvars = c, sim, vars
+		}
+	}
+	if best == nil || bestsim < m.Similarity {
+		best = &Cluster{ID: len(m.clusters) + 1, vars: make(map[int]*variable)}
+		best.Tokens = append(best.Tokens, masked...)
+		leaf.clusters = append(leaf.clusters, best)
+		m.clusters = append(m.clusters, best)
+	}
+	best.add(tokens, masked)
+	return best
+}
+
+// Returns the leaf for a line, creating the nodes on the way.  The
+// first level is keyed by the number of tokens, the next ones by the
+// tokens in turn, where tokens with digits and tokens beyond
+// MaxChildren share the key Wildcard.
+func (m *Miner) leaf(tokens []string) *node {
+	n := m.root.child(strings.Repeat(" ", len(tokens)))
+	for i := 0; i < m.Depth-2 && i < len(tokens); i++ {
+		key := tokens[i]
+		if hasdigit(key) || strings.Contains(key, Wildcard) {
+			key = Wildcard
+		}
+		if _, ok := n.children[key]; !ok && len(n.children) >= m.MaxChildren-1 {
+			key = Wildcard
+		}
+		n = n.child(key)
+	}
+	return n
+}
+
+func (n *node) child(key string) *node {
+	c, ok := n.children[key]
+	if !ok {
+		c = &node{children: make(map[string]*node)}
+		n.children[key] = c
+	}
+	return c
+}
+
+// Returns the fraction of tokens the same in the template and the
+// masked line, and the number of variables in the template.
+func (c *Cluster) similarity(tokens []string) (float64, int) {
+	if len(tokens) == 0 {
+		return 1, 0
+	}
+	same, vars := 0, 0
+	for i, t := range c.Tokens {
+		if t == tokens[i] {
+			same++
+		}
+		if strings.HasSuffix(t, Wildcard) {
+			vars++
+		}
+	}
+	return float64(same) / float64(len(tokens)), vars
+}
+
+// Adds a line to the cluster, turning the tokens in which it differs
+// into variables.
+func (c *Cluster) add(tokens, masked []string) {
+	c.Size++
+	for i, t := range c.Tokens {
+		prefix := strings.TrimSuffix(t, Wildcard)
+		switch {
+		case t == Wildcard:
+			c.variable(i).add(tokens[i])
+		case prefix != t && strings.HasPrefix(tokens[i], prefix):
+			c.variable(i).add(tokens[i][len(prefix):])
+		case prefix != t:
+			// A key=<*> which now sees another key.
+			c.Tokens[i] = Wildcard
+			c.variable(i).types &= nonspace
+			c.variable(i).add(tokens[i])
+		case t != masked[i]:
+			key, value, ok := keyvalue(t)
+			if k, v, ok2 := keyvalue(tokens[i]); ok && ok2 && k == key {
+				c.Tokens[i] = key + "=" + Wildcard
+				c.variable(i).add(value)
+				c.variable(i).add(v)
+			} else {
+				c.Tokens[i] = Wildcard
+				c.variable(i).add(t)
+				c.variable(i).add(tokens[i])
+			}
+		}
+	}
+}
+
+func (c *Cluster) variable(i int) *variable {
+	v, ok := c.vars[i]
+	if !ok {
+		v = &variable{types: all}
+		c.vars[i] = v
+	}
+	return v
+}
+
+// Quotes the characters of a literal token which are special in a
+// pattern, and % so that grok does not take it for a reference.
+func quote(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case strings.ContainsRune(`\^$.|?*+()[{%`, r):
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < ' ' || r == 0x7f:
+			b.WriteString(pcre.QuoteMeta(string(r)))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,144 @@
+package drain
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var lines = []string{
+	"Accepted password for root from 10.0.0.1 port 22",
+	"Accepted password for alice from 10.0.0.2 port 2222",
+	"Failed password for bob from 192.168.1.5 port 22",
+	"connection closed took=12 status=ok",
+	"connection closed took=7.5 status=timeout",
+	"session 0badc0de1234 opened for user=carol",
+	"session 0badc0de5678 opened for user=dave",
+	"   Accepted password for eve from 10.0.0.3 port 22  ",
+}
+
+func TestMiner(t *testing.T) {
+	m := New()
+	clusters := make([]*Cluster, len(lines))
+	for i, l := range lines {
+		clusters[i] = m.Add(l)
+	}
+	var templates []string
+	for _, c := range m.Clusters() {
+		templates = append(templates, fmt.Sprintf("%d %s", c.Size, c.Template()))
+	}
+	want := []string{
+		"3 Accepted password for <*> from <*> port <*>",
+		"1 Failed password for bob from <*> port <*>",
+		"2 connection closed took=<*> status=<*>",
+		"2 session <*> opened for user=<*>",
+	}
+	if strings.Join(templates, "\n") != strings.Join(want, "\n") {
+		t.Error(templates)
+	}
+	if p := m.Clusters()[2].Pattern(); p != `^\s*connection\s+closed\s+took=(?<took>[+-]?\d+(?:\.\d+)?)\s+status=(?<status>\w+)\s*$` {
+		t.Error(p)
+	}
+	if p := m.Clusters()[0].Grok(); p != `^\s*Accepted\s+password\s+for\s+%{WORD:word}\s+from\s+%{IPV4:ip}\s+port\s+%{INT:num:int}\s*$` {
+		t.Error(p)
+	}
+	for i, l := range lines {
+		re, err := clusters[i].Regexp()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, _ := re.MatcherString(l, 0)
+		if !m.Matches() {
+			t.Errorf("%q does not match %s", l, re)
+		}
+		if i == 5 && (m.NamedString("id") != "0badc0de1234" || m.NamedString("user") != "carol") {
+			t.Error(m.NamedStringMap())
+		}
+	}
+}
+
+func TestMinerVariables(t *testing.T) {
+	m := New()
+	m.Add("job 1 state=done")
+	m.Add("job 2 state=done")
+	c := m.Add("job x3 state=done")
+	// A key=<*> token which sees another key becomes <*>.
+	m.Add("job 4 mode=fast")
+	if c.Template() != "job <*> <*>" || c.Size != 4 || len(m.Clusters()) != 1 {
+		t.Error(c.Template(), c.Size, len(m.Clusters()))
+	}
+	if p := c.Pattern(); p != `^\s*job\s+(?<word>\w+)\s+(?<var>\S+)\s*$` {
+		t.Error(p)
+	}
+
+	// Lines with too little in common stay apart.
+	m = New()
+	a := m.Add("disk full on sda")
+	b := m.Add("disk ok after sdb")
+	if a == b || a.Template() != "disk full on sda" {
+		t.Error(a.Template(), b.Template())
+	}
+	m.Similarity = 0.2
+	if c := m.Add("disk full after sdc"); c != a || c.Template() != "disk full <*> <*>" {
+		t.Error(c.Template())
+	}
+}
+
+func TestGroupNames(t *testing.T) {
+	long := strings.Repeat("k", 32)
+	m := New()
+	m.Add("got num2=1 1 2 " + long + "=a " + long + "=b")
+	c := m.Add("got num2=3 4 5 " + long + "=c " + long + "=d")
+	want := `^\s*got\s+num2=(?<num2>[+-]?\d+)\s+(?<num>[+-]?\d+)\s+(?<num3>[+-]?\d+)\s+` +
+		long + `=(?<` + long + `>\w+)\s+` + long + `=(?<` + long[:30] + `2>\w+)\s*$`
+	if p := c.Pattern(); p != want {
+		t.Error(p)
+	}
+	if _, err := c.Regexp(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMaxChildren(t *testing.T) {
+	m := New()
+	m.MaxChildren = 3
+	for _, w := range []string{"alpha", "beta", "gamma", "delta"} {
+		m.Add(w + " started")
+	}
+	// The first two keep their own node; the others share Wildcard,
+	// and their cluster merges them.
+	var templates []string
+	for _, c := range m.Clusters() {
+		templates = append(templates, c.Template())
+	}
+	if fmt.Sprint(templates) != "[alpha started beta started <*> started]" || m.Clusters()[2].Size != 2 {
+		t.Error(templates)
+	}
+}
+
+func TestWritePatterns(t *testing.T) {
+	m := New()
+	for _, l := range lines {
+		m.Add(l)
+	}
+	var b bytes.Buffer
+	if err := m.WritePatterns(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(b.String(), "# Accepted password for <*> from <*> port <*> (3 lines)\nTEMPLATE_1 ^\\s*Accepted") {
+		t.Error(b.String())
+	}
+	g, err := m.Grok()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := g.Compile("%{TEMPLATE_3}", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, ok, err := p.Parse("connection closed took=3.25 status=ok")
+	if !ok || err != nil || values["took"] != 3.25 || values["status"] != "ok" {
+		t.Error(values, ok, err)
+	}
+}
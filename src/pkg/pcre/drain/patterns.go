@@ -0,0 +1,213 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package drain
+
+import (
+	"fmt"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre/grok"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Sets of the kinds of text which all values of a variable are.
+const (
+	integer = 1 << iota
+	number
+	ipv4
+	hex
+	word
+	nonspace
+
+	all = integer | number | ipv4 | hex | word | nonspace
+)
+
+// The kinds of text, narrowest first, with their pattern, the grok
+// pattern and type for them, and the prefix of group names.
+var kinds = []struct {
+	kind    int
+	pattern string
+	grok    string
+	name    string
+}{
+	{integer, `[+-]?\d+`, "INT:%s:int", "num"},
+	{number, `[+-]?\d+(?:\.\d+)?`, "NUMBER:%s:float", "num"},
+	{ipv4, `(?:\d{1,3}\.){3}\d{1,3}`, "IPV4:%s", "ip"},
+	{hex, `[0-9A-Fa-f]+`, "BASE16NUM:%s", "id"},
+	{word, `\w+`, "WORD:%s", "word"},
+	{nonspace, `\S+`, "NOTSPACE:%s", "var"},
+}
+
+var (
+	integerpattern = pcre.MustCompile(`^[+-]?\d+$`, 0)
+	numberpattern  = pcre.MustCompile(`^[+-]?\d+(?:\.\d+)?$`, 0)
+	ipv4pattern    = pcre.MustCompile(`^(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)$`, 0)
+	// Hex strings need a digit and eight characters, so that words
+	// such as "added" stay literal.
+	hexpattern  = pcre.MustCompile(`^(?=.*\d)[0-9A-Fa-f]{8,}$`, 0)
+	wordpattern = pcre.MustCompile(`^\w+$`, 0)
+)
+
+// Returns the kinds of text which s is.
+func types(s string) int {
+	t := nonspace
+	for _, k := range []struct {
+		kind int
+		re   pcre.Regexp
+	}{{integer, integerpattern}, {number, numberpattern}, {ipv4, ipv4pattern}, {hex, hexpattern}, {word, wordpattern}} {
+		if m, err := k.re.MatcherString(s, 0); err == nil && m.Matches() {
+			t |= k.kind
+		}
+	}
+	return t
+}
+
+// What is known about the values of a variable.
+type variable struct {
+	types int // kinds which all values are
+}
+
+func (v *variable) add(value string) {
+	v.types &= types(value)
+}
+
+// Returns the narrowest kind of the variable.
+func (v *variable) kind() int {
+	for i, k := range kinds {
+		if v.types&k.kind != 0 {
+			return i
+		}
+	}
+	return len(kinds) - 1
+}
+
+// Calls f for each token of the template with its literal text, or
+// the key of a key=<*> token, and the kind of a variable, or -1.
+// Group names are the key or the prefix of the kind, numbered from 2
+// when they repeat.
+func (c *Cluster) each(f func(literal, name string, kind int)) {
+	used := make(map[string]bool)
+	for i, t := range c.Tokens {
+		if !strings.HasSuffix(t, Wildcard) {
+			f(t, "", -1)
+			continue
+		}
+		k := c.variable(i).kind()
+		name := kinds[k].name
+		key := strings.TrimSuffix(t, Wildcard)
+		if key != "" {
+			name = strings.TrimSuffix(key, "=")
+		}
+		f(key, unique(name, used), k)
+	}
+}
+
+// Returns name, or if it is taken, name with the lowest free number
+// appended, and marks the result as taken.  A name which ends in a
+// digit is separated from the number by an underscore, and long names
+// are shortened to keep within the 32 characters PCRE allows.
+func unique(name string, used map[string]bool) string {
+	s := name
+	for n := 2; used[s]; n++ {
+		base, suffix := name, strconv.Itoa(n)
+		if len(base)+len(suffix)+1 > 32 {
+			base = base[:32-len(suffix)-1]
+		}
+		if c := base[len(base)-1]; '0' <= c && c <= '9' {
+			suffix = "_" + suffix
+		}
+		s = base + suffix
+	}
+	used[s] = true
+	return s
+}
+
+// Returns a pattern for the lines of the template, with a named group
+// for each variable.
+func (c *Cluster) Pattern() string {
+	parts := []string{}
+	c.each(func(literal, name string, kind int) {
+		p := quote(literal)
+		if kind >= 0 {
+			p += "(?<" + name + ">" + kinds[kind].pattern + ")"
+		}
+		parts = append(parts, p)
+	})
+	return `^\s*` + strings.Join(parts, `\s+`) + `\s*$`
+}
+
+// Compiles Pattern.
+func (c *Cluster) Regexp() (pcre.Regexp, error) {
+	re, cerr := pcre.Compile(c.Pattern(), 0)
+	if cerr != nil {
+		return pcre.Regexp{}, cerr
+	}
+	return re, nil
+}
+
+// Returns the template as a grok pattern, in which variables refer to
+// the base patterns of package grok, with a type for numbers.
+func (c *Cluster) Grok() string {
+	parts := []string{}
+	c.each(func(literal, name string, kind int) {
+		p := quote(literal)
+		if kind >= 0 {
+			p += "%{" + fmt.Sprintf(kinds[kind].grok, name) + "}"
+		}
+		parts = append(parts, p)
+	})
+	return `^\s*` + strings.Join(parts, `\s+`) + `\s*$`
+}
+
+// Returns the name of the cluster in the pattern dictionary.
+func (c *Cluster) Name() string {
+	return "TEMPLATE_" + strconv.Itoa(c.ID)
+}
+
+// Writes the templates as a grok pattern file, which grok.AddPatterns
+// reads: a comment with the template and the number of lines, and a
+// line with the name and the grok pattern.  The patterns refer to
+// grok.BasePatterns.
+func (m *Miner) WritePatterns(w io.Writer) error {
+	for _, c := range m.clusters {
+		if _, err := fmt.Fprintf(w, "# %s (%d lines)\n%s %s\n", c.Template(), c.Size, c.Name(), c.Grok()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns a grok dictionary of the base patterns and the templates.
+func (m *Miner) Grok() (*grok.Grok, error) {
+	var b strings.Builder
+	m.WritePatterns(&b)
+	g := grok.New()
+	if err := g.AddPatterns(strings.NewReader(b.String())); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
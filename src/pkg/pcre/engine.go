@@ -0,0 +1,354 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package pcre
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The matching engine behind a Regexp.
+type Engine int
+
+const (
+	// Use the Go regexp package if the pattern allows it, and
+	// PCRE otherwise.
+	EngineAuto Engine = iota
+	// Always use PCRE.
+	EnginePCRE
+	// Always use the Go regexp package.  Compilation fails for
+	// patterns which need PCRE.
+	EngineGo
+)
+
+func (e Engine) String() string {
+	switch e {
+	case EngineAuto:
+		return "auto"
+	case EnginePCRE:
+		return "pcre"
+	case EngineGo:
+		return "go"
+	}
+	return "Engine(" + strconv.Itoa(int(e)) + ")"
+}
+
+// Compile flags with identical meaning in the Go regexp package.
+// Everything else (EXTENDED, the NEWLINE_* conventions, and so on)
+// keeps the pattern on PCRE.
+const re2flags = CASELESS | DOTALL | MULTILINE | UNGREEDY | UTF8 |
+	ANCHORED | DOLLAR_ENDONLY | DUPNAMES | NO_UTF8_CHECK |
+	BSR_ANYCRLF | BSR_UNICODE
+
+// Like Compile, but uses the Go regexp package for matching if the
+// pattern and flags fall into the subset where it behaves exactly
+// like PCRE.  Such patterns are matched in linear time.
+func CompileAuto(pattern string, flags int) (Regexp, *CompileError) {
+	return CompileEngine(pattern, flags, EngineAuto)
+}
+
+// Compile the pattern for the specified engine.  The pattern is
+// always compiled by PCRE as well, so compilation errors and group
+// numbers are the same as with Compile.  Match flags which the Go
+// regexp package does not implement, and subjects which are not
+// valid UTF-8, are handled by PCRE for that match.
+func CompileEngine(pattern string, flags int, engine Engine) (Regexp, *CompileError) {
+	re, err := Compile(pattern, flags)
+	if err != nil || engine == EnginePCRE {
+		return re, err
+	}
+	re2, offset, reason := compilere2(pattern, flags)
+	if re2 != nil {
+		reason = re2groups(re, re2)
+	}
+	if reason != "" {
+		if engine == EngineGo {
+			return Regexp{}, &CompileError{
+				Pattern: pattern,
+				Message: "not supported by the Go engine: " + reason,
+				Offset:  offset,
+			}
+		}
+		return re, nil
+	}
+	re.re2 = re2
+	return re, nil
+}
+
+// Returns the engine used for matching: EnginePCRE or EngineGo.
+func (re Regexp) Engine() Engine {
+	if re.re2 != nil {
+		return EngineGo
+	}
+	return EnginePCRE
+}
+
+// Translate the pattern into Go syntax and compile it.  On failure,
+// returns the offset of the offending construct in the original
+// pattern (if known) and the reason.
+func compilere2(pattern string, flags int) (*regexp.Regexp, int, string) {
+	if flags&^re2flags != 0 {
+		return nil, 0, "unsupported compile flags"
+	}
+	expr, offset, reason := re2expr(pattern, flags)
+	if reason != "" {
+		return nil, offset, reason
+	}
+	tree, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, 0, err.(*syntax.Error).Code.String()
+	}
+	if reason := re2check(tree, flags&UTF8 != 0); reason != "" {
+		return nil, 0, reason
+	}
+	re2, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, 0, err.Error()
+	}
+	return re2, 0, ""
+}
+
+// Check that both engines number the groups in the same way.
+func re2groups(re Regexp, re2 *regexp.Regexp) string {
+	if re2.NumSubexp() != re.Groups() {
+		return "group count differs"
+	}
+	names := re.NamedGroups()
+	n := 0
+	for i, name := range re2.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		if group, ok := names[name]; !ok || group != i {
+			return "group names differ"
+		}
+		n++
+	}
+	if n != len(names) {
+		return "group names differ"
+	}
+	return ""
+}
+
+// Rewrite the lexical constructs which differ between PCRE and Go,
+// and reject those which cannot be rewritten.
+func re2expr(pattern string, flags int) (string, int, string) {
+	var b strings.Builder
+	inline := ""
+	for _, f := range []struct {
+		flag   int
+		letter string
+	}{{CASELESS, "i"}, {DOTALL, "s"}, {MULTILINE, "m"}, {UNGREEDY, "U"}} {
+		if flags&f.flag != 0 {
+			inline += f.letter
+		}
+	}
+	if inline != "" {
+		b.WriteString("(?" + inline + ")")
+	}
+	if flags&ANCHORED != 0 {
+		b.WriteString(`\A(?:`)
+	}
+	class := false // inside a character class
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\':
+			e := pattern[i+1]
+			i++
+			switch {
+			case e == 'Q':
+				lit := pattern[i+1:]
+				if end := strings.Index(lit, `\E`); end >= 0 {
+					lit = lit[:end]
+					i += 2
+				}
+				i += len(lit)
+				if class {
+					for j := 0; j < len(lit); j++ {
+						if !isalnum(lit[j]) && lit[j] < utf8.RuneSelf {
+							b.WriteByte('\\')
+						}
+						b.WriteByte(lit[j])
+					}
+				} else {
+					b.WriteString(regexp.QuoteMeta(lit))
+				}
+			case e == 's' && class:
+				// PCRE includes VT in \s, Go does not.
+				b.WriteString(`\t\n\v\f\r `)
+			case e == 's':
+				b.WriteString(`[\t\n\v\f\r ]`)
+			case e == 'S' && !class:
+				b.WriteString(`[^\t\n\v\f\r ]`)
+			case strings.IndexByte("dDwWtnrfax0", e) >= 0,
+				strings.IndexByte("bBAz", e) >= 0 && !class,
+				e < utf8.RuneSelf && !isalnum(e):
+				b.WriteByte('\\')
+				b.WriteByte(e)
+			default:
+				return "", i - 1, `escape \` + string(e)
+			}
+		case class:
+			if c == ']' {
+				class = false
+			} else if c == '[' && i+1 < len(pattern) && pattern[i+1] == ':' {
+				if end := strings.Index(pattern[i:], ":]"); end >= 0 {
+					b.WriteString(pattern[i : i+end+1])
+					i += end + 1
+					c = ']'
+				}
+			}
+			b.WriteByte(c)
+		case c == '[':
+			class = true
+			b.WriteByte(c)
+			if i+1 < len(pattern) && pattern[i+1] == '^' {
+				i++
+				b.WriteByte('^')
+			}
+			if i+1 < len(pattern) && pattern[i+1] == ']' {
+				i++
+				b.WriteString(`\]`)
+			}
+		case c == '$' && flags&(MULTILINE|DOLLAR_ENDONLY) == 0:
+			// PCRE also matches before a trailing newline.
+			return "", i, "$ without MULTILINE or DOLLAR_ENDONLY"
+		case c == '^' && flags&MULTILINE != 0:
+			// Go also matches after a trailing newline.
+			return "", i, "^ with MULTILINE"
+		case c == '(' && strings.HasPrefix(pattern[i:], "(?"):
+			j := i + 2
+			for j < len(pattern) && strings.IndexByte("imsxJUX-", pattern[j]) >= 0 {
+				if pattern[j] == 'm' {
+					return "", i, "inline multiline option"
+				}
+				j++
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	if flags&ANCHORED != 0 {
+		b.WriteByte(')')
+	}
+	return b.String(), 0, ""
+}
+
+func isalnum(c byte) bool {
+	return '0' <= c && c <= '9' || 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z'
+}
+
+// Reject syntax trees which Go matches differently from PCRE.
+// Without UTF8, PCRE matches bytes where Go matches characters, so
+// nothing may match outside ASCII.
+func re2check(re *syntax.Regexp, utf bool) string {
+	switch re.Op {
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		if !utf {
+			return "dot without UTF8"
+		}
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			if utf {
+				break
+			}
+			if r >= utf8.RuneSelf {
+				return "non-ASCII literal without UTF8"
+			}
+			if re.Flags&syntax.FoldCase != 0 {
+				for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+					if f >= utf8.RuneSelf {
+						return "non-ASCII case folding without UTF8"
+					}
+				}
+			}
+		}
+	case syntax.OpCharClass:
+		for i := 1; i < len(re.Rune) && !utf; i += 2 {
+			if re.Rune[i] >= utf8.RuneSelf {
+				return "non-ASCII class without UTF8"
+			}
+		}
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		// Captures in empty iterations are set differently.
+		if re2captures(re.Sub[0]) && re2empty(re.Sub[0]) {
+			return "repeated group can match the empty string"
+		}
+	}
+	for _, sub := range re.Sub {
+		if reason := re2check(sub, utf); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+func re2captures(re *syntax.Regexp) bool {
+	if re.Op == syntax.OpCapture {
+		return true
+	}
+	for _, sub := range re.Sub {
+		if re2captures(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if re can match the empty string.
+func re2empty(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine,
+		syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary,
+		syntax.OpStar, syntax.OpQuest:
+		return true
+	case syntax.OpRepeat:
+		return re.Min == 0 || re2empty(re.Sub[0])
+	case syntax.OpPlus, syntax.OpCapture:
+		return re2empty(re.Sub[0])
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if !re2empty(sub) {
+				return false
+			}
+		}
+		return true
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if re2empty(sub) {
+				return true
+			}
+		}
+	}
+	return false
+}
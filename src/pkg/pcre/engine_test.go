@@ -0,0 +1,117 @@
+package pcre
+
+import (
+	"testing"
+)
+
+func TestCompileAuto(t *testing.T) {
+	check := func(p string, flags int, engine Engine) {
+		re, err := CompileAuto(p, flags)
+		if err != nil {
+			t.Error(p, err)
+			return
+		}
+		if e := re.Engine(); e != engine {
+			t.Error(p, flags, "Engine", e)
+		}
+	}
+	check(`abc`, 0, EngineGo)
+	check(`^(\d+)\s(?<word>\w*)`, 0, EngineGo)
+	check(`a[^b]c`, UTF8, EngineGo)
+	check(`a.c`, UTF8|DOTALL, EngineGo)
+	check(`x$`, MULTILINE, EngineGo)
+	check(`x$`, DOLLAR_ENDONLY, EngineGo)
+	check(`\Qa.b\E+`, 0, EngineGo)
+	check(`a.c`, 0, EnginePCRE)
+	check(`a[^b]c`, 0, EnginePCRE)
+	check(`x$`, 0, EnginePCRE)
+	check(`^x`, MULTILINE, EnginePCRE)
+	check(`(a)\1`, 0, EnginePCRE)
+	check(`a(?=b)`, 0, EnginePCRE)
+	check(`a++`, 0, EnginePCRE)
+	check(`(?>a)`, 0, EnginePCRE)
+	check(`\pL`, UTF8, EnginePCRE)
+	check(`\v`, 0, EnginePCRE)
+	check(`(a*)*`, 0, EnginePCRE)
+	check(`abc`, EXTENDED, EnginePCRE)
+	check(`k`, CASELESS, EnginePCRE)
+	check(`k`, CASELESS|UTF8, EngineGo)
+	check(`\w`, CASELESS, EnginePCRE)
+}
+
+func TestCompileEngine(t *testing.T) {
+	re, err := CompileEngine("abc", 0, EnginePCRE)
+	if err != nil {
+		t.Error(err)
+	}
+	if re.Engine() != EnginePCRE {
+		t.Error("EnginePCRE", re.Engine())
+	}
+	_, err = CompileEngine("(a)\\1", 0, EngineGo)
+	if err == nil {
+		t.Error("EngineGo accepted back reference")
+	}
+	_, err = CompileEngine("a$", 0, EngineGo)
+	switch {
+	case err == nil:
+		t.Error("EngineGo accepted $")
+	case err.Offset != 1:
+		t.Error("Offset", err.Offset)
+	}
+	_, err = CompileEngine("(", 0, EngineGo)
+	if err == nil || err.Message != "missing )" {
+		t.Error("compile error", err)
+	}
+}
+
+func TestEngineMatch(t *testing.T) {
+	check := func(p string, flags int, subjects ...string) {
+		pre := MustCompile(p, flags)
+		gre, err := CompileEngine(p, flags, EngineGo)
+		if err != nil {
+			t.Error(p, err)
+			return
+		}
+		for _, s := range subjects {
+			pm, _ := pre.MatcherString(s, 0)
+			gm, _ := gre.Matcher([]byte(s), 0)
+			if pm.Matches() != gm.Matches() {
+				t.Error(p, s, "Matches", gm.Matches())
+				continue
+			}
+			for i := 0; pm.Matches() && i <= pm.Groups(); i++ {
+				if pm.Present(i) != gm.Present(i) ||
+					pm.GroupString(i) != gm.GroupString(i) {
+					t.Error(p, s, "Group", i, gm.GroupString(i))
+				}
+			}
+		}
+	}
+	check(`(a|ab)(c|bcd)(d*)`, 0, "abcd", "acd", "xyz")
+	check(`(\w+)@(\w+)\.com`, CASELESS|UTF8, "Mail: joe@Example.COM!", "joe@example")
+	check(`^(\d+)\s+(\S+)`, UTF8, "12 \v x", "12\tabc", "x")
+	check(`(?<k>[a-z]+)=(?<v>.*?);`, UTF8, "k=v;a=b;", "ä=ö;", "")
+	check(`(X)?ab(c)?`, UNGREEDY, "abc", "Xabc")
+	check(`.+$`, UTF8|MULTILINE, "line\nnext\n")
+	check(`b`, ANCHORED, "abc", "bc")
+}
+
+func TestEngineFallback(t *testing.T) {
+	re := MustCompile("b", 0)
+	if re.Engine() != EnginePCRE {
+		t.Error("Compile", re.Engine())
+	}
+	re, _ = CompileAuto("^b", 0)
+	m, err := re.MatcherString("b", NOTBOL)
+	if err != nil {
+		t.Error(err)
+	}
+	if m.Matches() {
+		t.Error("NOTBOL")
+	}
+	re, _ = CompileAuto("(.)", UTF8)
+	m, _ = re.Matcher([]byte("\xffa"), NO_UTF8_CHECK)
+	if !m.Matches() || m.GroupString(1) != "\xff" {
+		t.Error("invalid UTF-8", m.GroupString(1))
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package grok composes PCRE patterns from named building blocks, in
+// the style of Logstash's grok filter.
+//
+// A grok pattern is a PCRE pattern which may contain references of
+// the form %{NAME}, %{NAME:field} or %{NAME:field:type}.  Each
+// reference is replaced by the pattern called NAME in the dictionary,
+// which may contain references itself.  With a field, the replacement
+// becomes a capture group whose value is reported under the field
+// name; the type (int, float, bool or string, the default) selects
+// the conversion of the value.
+//
+//	g := grok.New()
+//	p, err := g.Compile(`%{IP:client} %{WORD:method} %{NUMBER:bytes:int}`, 0)
+//	values, ok, err := p.Parse("10.0.0.1 GET 512")
+//
+// New returns a dictionary holding BasePatterns.  More patterns are
+// added with AddPattern or, in the format of grok pattern files,
+// AddPatterns.
+package grok
+
+import (
+	"bufio"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"github.com/pkg/errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A dictionary of named patterns.
+type Grok struct {
+	patterns map[string]string
+}
+
+// Returns a dictionary holding BasePatterns.
+func New() *Grok {
+	g := NewEmpty()
+	if err := g.AddPatterns(strings.NewReader(BasePatterns)); err != nil {
+		panic(err)
+	}
+	return g
+}
+
+// Returns an empty dictionary.
+func NewEmpty() *Grok {
+	return &Grok{patterns: make(map[string]string)}
+}
+
+func validname(name string) bool {
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c == '_' || '0' <= c && c <= '9' ||
+			'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// Adds a pattern to the dictionary, replacing any pattern with the
+// same name.  References in the pattern are resolved when a pattern
+// using it is compiled, so they may refer to patterns added later.
+func (g *Grok) AddPattern(name, pattern string) error {
+	if !validname(name) {
+		return errors.Errorf("grok: invalid pattern name %q", name)
+	}
+	g.patterns[name] = pattern
+	return nil
+}
+
+// Adds the patterns from r, which is in the format of grok pattern
+// files: one pattern per line, as a name, white space and the
+// pattern.  Empty lines and lines starting with # are ignored.
+func (g *Grok) AddPatterns(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		i := strings.IndexAny(line, " \t")
+		if i < 0 {
+			return errors.Errorf("grok: line %d: missing pattern", n)
+		}
+		if err := g.AddPattern(line[:i], strings.TrimSpace(line[i:])); err != nil {
+			return errors.Wrapf(err, "line %d", n)
+		}
+	}
+	return s.Err()
+}
+
+// Returns the pattern called name, and whether it exists.
+func (g *Grok) Pattern(name string) (string, bool) {
+	p, ok := g.patterns[name]
+	return p, ok
+}
+
+// A field of a compiled pattern.
+type field struct {
+	name string
+	typ  string
+}
+
+var types = map[string]bool{"": true, "string": true, "int": true, "float": true, "bool": true}
+
+// State of an expansion.
+type expansion struct {
+	g      *Grok
+	stack  []string // names being expanded, for cycle detection
+	fields []field  // by field number - 1
+	b      strings.Builder
+}
+
+// Expand the references in pattern into e.b.
+func (e *expansion) expand(pattern string) error {
+	for {
+		i := strings.Index(pattern, "%{")
+		if i < 0 {
+			e.b.WriteString(pattern)
+			return nil
+		}
+		e.b.WriteString(pattern[:i])
+		end := strings.IndexByte(pattern[i:], '}')
+		if end < 0 {
+			return errors.Errorf("grok: unterminated reference %q", pattern[i:])
+		}
+		ref := pattern[i+2 : i+end]
+		pattern = pattern[i+end+1:]
+		parts := strings.SplitN(ref, ":", 3)
+		name := parts[0]
+		sub, ok := e.g.patterns[name]
+		if !ok {
+			return errors.Errorf("grok: unknown pattern %q", name)
+		}
+		for j, s := range e.stack {
+			if s == name {
+				return errors.Errorf("grok: cycle: %s -> %s",
+					strings.Join(e.stack[j:], " -> "), name)
+			}
+		}
+		if len(parts) == 1 || parts[1] == "" {
+			e.b.WriteString("(?:")
+		} else {
+			f := field{name: parts[1]}
+			if len(parts) == 3 {
+				f.typ = parts[2]
+			}
+			if !types[f.typ] {
+				return errors.Errorf("grok: %%{%s}: unknown type %q", ref, f.typ)
+			}
+			e.fields = append(e.fields, f)
+			e.b.WriteString("(?<" + groupname(len(e.fields)) + ">")
+		}
+		e.stack = append(e.stack, name)
+		if err := e.expand(sub); err != nil {
+			return err
+		}
+		e.stack = e.stack[:len(e.stack)-1]
+		e.b.WriteByte(')')
+	}
+}
+
+// Field names need not be valid group names, so the groups are
+// numbered instead.
+func groupname(n int) string {
+	return "_grok" + strconv.Itoa(n)
+}
+
+// Returns the PCRE pattern for a grok pattern, with a named group
+// for every reference with a field.
+func (g *Grok) Expand(pattern string) (string, error) {
+	e := expansion{g: g}
+	if err := e.expand(pattern); err != nil {
+		return "", err
+	}
+	return e.b.String(), nil
+}
+
+// A compiled grok pattern.
+type Pattern struct {
+	re     pcre.Regexp
+	fields []field
+	groups []int // group numbers of the fields
+}
+
+// Expands the pattern and compiles it with pcre.Compile.  Patterns
+// which cannot be expanded are reported with an error; compilation
+// errors are returned as *pcre.CompileError, for the expanded
+// pattern.
+func (g *Grok) Compile(pattern string, flags int) (*Pattern, error) {
+	e := expansion{g: g}
+	if err := e.expand(pattern); err != nil {
+		return nil, err
+	}
+	re, cerr := pcre.Compile(e.b.String(), flags)
+	if cerr != nil {
+		return nil, cerr
+	}
+	p := &Pattern{re: re, fields: e.fields, groups: make([]int, len(e.fields))}
+	names := re.NamedGroups()
+	for i := range e.fields {
+		p.groups[i] = names[groupname(i+1)]
+	}
+	return p, nil
+}
+
+// Compiles the pattern.  If expansion or compilation fails, panic.
+func (g *Grok) MustCompile(pattern string, flags int) *Pattern {
+	p, err := g.Compile(pattern, flags)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Returns the compiled regular expression.
+func (p *Pattern) Regexp() pcre.Regexp {
+	return p.re
+}
+
+// Returns the field names, in the order of their references.  A name
+// occurs more than once if several references use it.
+func (p *Pattern) Fields() []string {
+	names := make([]string, len(p.fields))
+	for i, f := range p.fields {
+		names[i] = f.name
+	}
+	return names
+}
+
+// Matches the subject and returns the values of the fields, as
+// strings.  Fields whose groups do not take part in the match are
+// omitted; if several references of a field match, the first one
+// counts.  Returns false if the subject does not match.
+func (p *Pattern) ParseString(subject string) (map[string]string, bool, error) {
+	m, err := p.re.MatcherString(subject, 0)
+	if err != nil || !m.Matches() {
+		return nil, false, err
+	}
+	values := make(map[string]string)
+	for i, f := range p.fields {
+		if _, ok := values[f.name]; !ok && m.Present(p.groups[i]) {
+			values[f.name] = m.GroupString(p.groups[i])
+		}
+	}
+	return values, true, nil
+}
+
+// Like ParseString, but converts the values according to the types
+// of the fields: int to int64, float to float64, bool to bool, and
+// string to string.  Conversion errors name the field.
+func (p *Pattern) Parse(subject string) (map[string]interface{}, bool, error) {
+	m, err := p.re.MatcherString(subject, 0)
+	if err != nil || !m.Matches() {
+		return nil, false, err
+	}
+	values := make(map[string]interface{})
+	for i, f := range p.fields {
+		if _, ok := values[f.name]; ok || !m.Present(p.groups[i]) {
+			continue
+		}
+		s := m.GroupString(p.groups[i])
+		var v interface{}
+		switch f.typ {
+		case "int":
+			v, err = strconv.ParseInt(s, 10, 64)
+		case "float":
+			v, err = strconv.ParseFloat(s, 64)
+		case "bool":
+			v, err = strconv.ParseBool(s)
+		default:
+			v = s
+		}
+		if err != nil {
+			return nil, true, errors.Wrapf(err, "grok: field %q", f.name)
+		}
+		values[f.name] = v
+	}
+	return values, true, nil
+}
@@ -0,0 +1,122 @@
+package grok
+
+import (
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"strings"
+	"testing"
+)
+
+func TestBasePatterns(t *testing.T) {
+	g := New()
+	for name := range g.patterns {
+		if _, err := g.Compile("%{"+name+"}", 0); err != nil {
+			t.Error(name, err)
+		}
+	}
+	check := func(name, subject string, match bool) {
+		p := g.MustCompile(`^%{`+name+`}$`, 0)
+		if _, ok, _ := p.ParseString(subject); ok != match {
+			t.Error(name, subject, ok)
+		}
+	}
+	check("IPV4", "10.101.64.117", true)
+	check("IPV4", "10.101.64.256", false)
+	check("IPV6", "fe80::1", true)
+	check("IPV6", "2001:db8::ffff:192.0.2.1", true)
+	check("IPV6", "1:2:3", false)
+	check("IP", "::1", true)
+	check("HOSTNAME", "adca-mesos-32.vm.elenet.me", true)
+	check("IPORHOST", "127.0.0.1", true)
+	check("NUMBER", "-1.5", true)
+	check("NUMBER", "1.", false)
+	check("POSINT", "0", false)
+	check("TIMESTAMP_ISO8601", "2018-07-10T11:38:42.963+08:00", true)
+	check("TIMESTAMP_ISO8601", "2018-07-10 11:38", true)
+	check("HTTPDATE", "10/Oct/2000:13:55:36 -0700", true)
+	check("SYSLOGTIMESTAMP", "Jul  4 09:01:02", true)
+	check("QUOTEDSTRING", `"a \" b"`, true)
+	check("UUID", "123e4567-e89b-12d3-a456-426614174000", true)
+	check("MAC", "00:1a:2b:3c:4d:5e", true)
+	check("URI", "http://127.0.0.1:1988/metrics?key=docker", true)
+	check("LOGLEVEL", "WARNING", true)
+	check("DATE", "07/10/2018", true)
+}
+
+func TestApacheLog(t *testing.T) {
+	p := New().MustCompile(`^%{COMBINEDAPACHELOG}$`, 0)
+	values, ok, err := p.Parse(`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] ` +
+		`"GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08"`)
+	if !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	for field, want := range map[string]interface{}{
+		"clientip":    "127.0.0.1",
+		"auth":        "frank",
+		"timestamp":   "10/Oct/2000:13:55:36 -0700",
+		"verb":        "GET",
+		"request":     "/apache_pb.gif",
+		"httpversion": "1.0",
+		"response":    int64(200),
+		"bytes":       int64(2326),
+		"agent":       `"Mozilla/4.08"`,
+	} {
+		if values[field] != want {
+			t.Errorf("%s: %#v", field, values[field])
+		}
+	}
+	if _, ok := values["rawrequest"]; ok {
+		t.Error("rawrequest present")
+	}
+}
+
+func TestComposition(t *testing.T) {
+	g := New()
+	err := g.AddPatterns(strings.NewReader(`
+# The log from TestNamedGroup in package pcre.
+TOPIC [\w.]+
+ORIGIN \{hostname: %{HOSTNAME:hostname}, ip: %{IP:ip}, topic: %{TOPIC:topic}\}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := g.MustCompile(`message=%{ORIGIN} %{GREEDYDATA:msg}`, 0)
+	values, ok, _ := p.ParseString(`{@timestamp=2018-07-10T11:38:42.963+08:00, message={hostname: adca-mesos-32.vm.elenet.me, ip: 10.101.64.117, topic: arch.appos_agent} {"level":"error"}}`)
+	if !ok || values["hostname"] != "adca-mesos-32.vm.elenet.me" ||
+		values["ip"] != "10.101.64.117" || values["topic"] != "arch.appos_agent" ||
+		values["msg"] != `{"level":"error"}}` {
+		t.Error(values)
+	}
+	if f := p.Fields(); strings.Join(f, ",") != "hostname,ip,topic,msg" {
+		t.Error("Fields", f)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	g := NewEmpty()
+	g.AddPattern("A", "a%{B}")
+	g.AddPattern("B", "b%{C}")
+	g.AddPattern("C", "c%{A}")
+	g.AddPattern("D", "(")
+	check := func(pattern, msg string) {
+		_, err := g.Compile(pattern, 0)
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Error(pattern, err)
+		}
+	}
+	check("%{A}", "cycle: A -> B -> C -> A")
+	check("%{X}", `unknown pattern "X"`)
+	check("%{D", "unterminated reference")
+	check("%{C:c:complex}", `unknown type "complex"`)
+	_, err := g.Compile("%{D}", 0)
+	if _, ok := err.(*pcre.CompileError); !ok {
+		t.Error("CompileError", err)
+	}
+	if err := g.AddPattern("A-B", "x"); err == nil {
+		t.Error("invalid name accepted")
+	}
+	g.AddPattern("N", `\d+`)
+	_, _, err = g.MustCompile("%{N:n:int}", 0).Parse("99999999999999999999")
+	if err == nil || !strings.Contains(err.Error(), `field "n"`) {
+		t.Error("conversion", err)
+	}
+}
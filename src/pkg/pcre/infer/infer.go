@@ -0,0 +1,441 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package infer proposes patterns for a set of example strings, such
+// as the lines of a log format.
+//
+// Each example is split into fields which look like timestamps, IP
+// addresses, UUIDs, quoted strings, host names or numbers, and into
+// literal words and punctuation.  The token sequences are aligned on
+// what they have in common; fields become named groups, and where the
+// examples differ otherwise, the text in between becomes a group as
+// well, described by its values or by the characters it consists of.
+// Infer returns the candidates at several levels of generality which
+// compile and match all positive and no negative examples, the most
+// specific first.
+//
+//	c, err := infer.Infer([]string{
+//		"GET /index.html 200 12ms",
+//		"POST /login 302 7ms",
+//	}, nil)
+//	// c[0].Pattern is ^(?<field>POST|GET) /(?<field2>index\.html|login) (?<number>[+-]?\d+(?:\.\d+)?) (?<field3>12ms|7ms)$
+//	// c[1].Pattern is ^(?<field>[A-Z]+) /(?<field2>[\w.-]+) (?<number>[+-]?\d+(?:\.\d+)?) (?<field3>\w+)$
+package infer
+
+import (
+	"fmt"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+)
+
+// A proposed pattern.
+type Candidate struct {
+	Pattern     string
+	Fields      []string // names of the groups, in order
+	Specificity int      // higher for patterns which match less
+}
+
+func (c Candidate) String() string {
+	return fmt.Sprintf("%d %s", c.Specificity, c.Pattern)
+}
+
+// A part of the template which the examples are aligned to: literal
+// text which all of them share, a field of the same name in all of
+// them, or a gap where they differ.
+type slot struct {
+	literal bool
+	text    string       // the literal text
+	name    string       // the name of the kinds of a field, "" for a gap
+	kinds   map[int]bool // the kinds seen in a field
+	values  []string     // the text of each example
+	group   string       // the group name, if the values vary
+}
+
+func (s *slot) equal(t token) bool {
+	switch {
+	case s.literal:
+		return t.kind < 0 && t.text == s.text
+	case s.name != "":
+		return t.kind >= 0 && kinds[t.kind].name == s.name
+	}
+	return false
+}
+
+func (s *slot) add(t token) {
+	s.values = append(s.values, t.text)
+	if t.kind >= 0 {
+		s.kinds[t.kind] = true
+	}
+}
+
+func newslot(t token) *slot {
+	if t.kind < 0 {
+		return &slot{literal: true, text: t.text, values: []string{t.text}}
+	}
+	return &slot{name: kinds[t.kind].name, kinds: map[int]bool{t.kind: true}, values: []string{t.text}}
+}
+
+// Aligns the tokens of another example with the template by their
+// longest common subsequence and returns the new template, in which
+// the parts between the aligned slots are gaps.  n is the number of
+// examples in the template.
+func merge(template []*slot, tokens []token, n int) []*slot {
+	// lcs[i][j] is the length of the common subsequence of
+	// template[i:] and tokens[j:].
+	lcs := make([][]int, len(template)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(tokens)+1)
+	}
+	for i := len(template) - 1; i >= 0; i-- {
+		for j := len(tokens) - 1; j >= 0; j-- {
+			switch {
+			case template[i].equal(tokens[j]):
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var out []*slot
+	gapi, gapj := 0, 0
+	gap := func(i, j int) {
+		if gapi == i && gapj == j {
+			return
+		}
+		g := &slot{values: make([]string, n+1)}
+		for _, s := range template[gapi:i] {
+			for k, v := range s.values {
+				g.values[k] += v
+			}
+		}
+		for _, t := range tokens[gapj:j] {
+			g.values[n] += t.text
+		}
+		out = append(out, g)
+	}
+	i, j := 0, 0
+	for i < len(template) && j < len(tokens) {
+		switch {
+		case template[i].equal(tokens[j]):
+			gap(i, j)
+			template[i].add(tokens[j])
+			out = append(out, template[i])
+			i, j = i+1, j+1
+			gapi, gapj = i, j
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	gap(len(template), len(tokens))
+	return out
+}
+
+// Returns a name for the group of each slot whose values vary: the
+// word before an = or : in front of it, or the kind of field.
+func name(template []*slot) {
+	used := make(map[string]bool)
+	for i, s := range template {
+		if s.literal || constant(s.values) {
+			continue
+		}
+		name := s.name
+		if name == "" {
+			name = "field"
+		}
+		j := i - 1
+		if j >= 0 && template[j].literal && strings.TrimSpace(template[j].text) == "" {
+			j--
+		}
+		if j >= 1 && template[j].literal && (template[j].text == "=" || template[j].text == ":") &&
+			template[j-1].literal && validname(template[j-1].text) {
+			name = strings.ToLower(template[j-1].text)
+		}
+		s.group = unique(name, used)
+	}
+}
+
+// Returns name, or if it is taken, name with the lowest free number
+// appended, and marks the result as taken.  A name which ends in a
+// digit is separated from the number by an underscore.
+func unique(name string, used map[string]bool) string {
+	sep := ""
+	if c := name[len(name)-1]; '0' <= c && c <= '9' {
+		sep = "_"
+	}
+	s := name
+	for n := 2; used[s]; n++ {
+		s = name + sep + fmt.Sprint(n)
+	}
+	used[s] = true
+	return s
+}
+
+func validname(s string) bool {
+	if s == "" || len(s) > 32 || '0' <= s[0] && s[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isword(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func constant(values []string) bool {
+	for _, v := range values {
+		if v != values[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// Character classes from narrow to wide, with their specificity.
+var classes = []struct {
+	pattern string
+	score   int
+	match   func(c byte) bool
+}{
+	{`\d`, 6, func(c byte) bool { return '0' <= c && c <= '9' }},
+	{`[a-z]`, 5, func(c byte) bool { return 'a' <= c && c <= 'z' }},
+	{`[A-Z]`, 5, func(c byte) bool { return 'A' <= c && c <= 'Z' }},
+	{`[A-Za-z]`, 4, func(c byte) bool { return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' }},
+	{`\w`, 3, isword},
+	{`[\w.-]`, 2, func(c byte) bool { return isword(c) || c == '.' || c == '-' }},
+	{`\S`, 1, func(c byte) bool { return !isspace(c) && c != '\n' && c != '\r' && c != '\f' && c != '\v' }},
+	{`.`, 0, func(c byte) bool { return c != '\n' }},
+}
+
+// Returns the narrowest class of all characters of the values and a
+// quantifier for their lengths: exact if exact is set and the lengths
+// are the same.
+func class(values []string, exact bool) (string, int) {
+	min, max := len(values[0]), len(values[0])
+	for _, v := range values {
+		if len(v) < min {
+			min = len(v)
+		}
+		if len(v) > max {
+			max = len(v)
+		}
+	}
+	for _, c := range classes {
+		ok := true
+		for _, v := range values {
+			for i := 0; i < len(v) && ok; i++ {
+				ok = c.match(v[i])
+			}
+		}
+		if !ok {
+			continue
+		}
+		lazy := ""
+		if c.pattern == "." {
+			lazy = "?"
+		}
+		switch {
+		case exact && min == max && min == 1:
+			return c.pattern, c.score + 3
+		case exact && min == max:
+			return fmt.Sprintf("%s{%d}", c.pattern, min), c.score + 3
+		case min == 0:
+			return c.pattern + "*" + lazy, c.score
+		}
+		return c.pattern + "+" + lazy, c.score
+	}
+	panic("infer: no class")
+}
+
+// The levels of generality of the candidates.
+const (
+	specific = iota // constant fields as literals, gaps as alternations
+	typed           // fields by kind, gaps by class
+	general         // fields and gaps as \S+ or .*?
+)
+
+// Returns the pattern for the template at a level of generality.
+func render(template []*slot, level int) Candidate {
+	var b strings.Builder
+	var c Candidate
+	b.WriteByte('^')
+	for _, s := range template {
+		if s.literal || s.group == "" || level == specific && constant(s.values) {
+			b.WriteString(quote(s.values[0]))
+			c.Specificity += 4 * len(s.values[0])
+			continue
+		}
+		var p string
+		var score int
+		switch {
+		case level < general && s.name != "":
+			var alts []string
+			for k := range kinds {
+				if s.kinds[k] {
+					alts = append(alts, kinds[k].pattern)
+				}
+			}
+			p, score = strings.Join(alts, "|"), 8-len(alts)
+		case level == specific && distinct(s.values) <= 4 && !strings.ContainsAny(strings.Join(s.values, ""), " \t"):
+			alts := uniq(s.values)
+			for i, v := range alts {
+				alts[i] = quote(v)
+			}
+			p, score = strings.Join(alts, "|"), 9
+		case level == general:
+			p, score = class(s.values, false)
+			if score > 1 {
+				// Keep * for gaps which some examples leave empty.
+				p, score = `\S`+p[len(p)-1:], 1
+			}
+		default:
+			p, score = class(s.values, level == specific)
+		}
+		b.WriteString("(?<" + s.group + ">" + p + ")")
+		c.Fields = append(c.Fields, s.group)
+		c.Specificity += score
+	}
+	b.WriteByte('$')
+	c.Pattern = b.String()
+	return c
+}
+
+// Like pcre.QuoteMeta, but leaves alone the characters which are not
+// special outside of classes, for readability.
+func quote(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case strings.ContainsRune(`\^$.|?*+()[{`, r):
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < ' ' || r == 0x7f:
+			b.WriteString(pcre.QuoteMeta(string(r)))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func uniq(values []string) []string {
+	seen := make(map[string]bool)
+	var u []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			u = append(u, v)
+		}
+	}
+	// Longer values first, so that none is cut short by a prefix.
+	sort.SliceStable(u, func(i, j int) bool { return len(u[i]) > len(u[j]) })
+	return u
+}
+
+func distinct(values []string) int {
+	return len(uniq(values))
+}
+
+// Proposes patterns which match each positive example as a whole and
+// none of the negative ones.  The candidates are checked with
+// pcre.Compile and Matcher.Match and sorted by Specificity, highest
+// first.
+func Infer(positive, negative []string) ([]Candidate, error) {
+	if len(positive) == 0 {
+		return nil, errors.New("infer: no examples")
+	}
+	var template []*slot
+	for i, example := range positive {
+		tokens, err := tokenize(example)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			for _, t := range tokens {
+				template = append(template, newslot(t))
+			}
+		} else {
+			template = merge(template, tokens, i)
+		}
+	}
+	name(template)
+	var candidates []Candidate
+	seen := make(map[string]bool)
+	for level := specific; level <= general; level++ {
+		c := render(template, level)
+		if seen[c.Pattern] {
+			continue
+		}
+		seen[c.Pattern] = true
+		ok, err := check(c.Pattern, positive, negative)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			candidates = append(candidates, c)
+		}
+	}
+	if candidates == nil {
+		return nil, errors.Errorf("infer: no pattern matches all %d positive and none of the %d negative examples",
+			len(positive), len(negative))
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Specificity > candidates[j].Specificity
+	})
+	return candidates, nil
+}
+
+// Reports whether pattern matches all positive and no negative
+// examples.  Patterns which fail to compile are rejected without an
+// error.
+func check(pattern string, positive, negative []string) (bool, error) {
+	re, cerr := pcre.Compile(pattern, 0)
+	if cerr != nil {
+		// Such as a pattern over the group or length limits;
+		// the other candidates may still do.
+		return false, nil
+	}
+	m, err := re.MatcherString("", 0)
+	if err != nil {
+		return false, err
+	}
+	for _, s := range positive {
+		if ok, err := m.MatchString(s, 0); err != nil || !ok {
+			return false, err
+		}
+	}
+	for _, s := range negative {
+		if ok, err := m.MatchString(s, 0); err != nil || ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,108 @@
+package infer
+
+import (
+	"fmt"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	check := func(s, want string) {
+		tokens, err := tokenize(s)
+		var got []string
+		for _, tok := range tokens {
+			if tok.kind < 0 {
+				got = append(got, fmt.Sprintf("%q", tok.text))
+			} else {
+				got = append(got, kinds[tok.kind].name+":"+tok.text)
+			}
+		}
+		if err != nil || strings.Join(got, " ") != want {
+			t.Errorf("%q: got %s, want %s (%v)", s, strings.Join(got, " "), want, err)
+		}
+	}
+	check("a=1.5 b=x1", `"a" "=" number:1.5 " " "b" "=" "x1"`)
+	check("from 10.0.0.1:8080", `"from" " " ip:10.0.0.1 ":" number:8080`)
+	check("at 2024-01-02T10:00:00+02:00.", `"at" " " timestamp:2024-01-02T10:00:00+02:00 "."`)
+	check(`say "a \" b" to www.example.com`, `"say" " " quoted:"a \" b" " " "to" " " host:www.example.com`)
+	check("1.2.3 fe80::1", `"1" "." "2" "." "3" " " ip:fe80::1`)
+}
+
+func TestInfer(t *testing.T) {
+	c, err := Infer([]string{"GET /index.html 200 12ms", "POST /login 302 7ms"}, nil)
+	if err != nil || len(c) != 3 {
+		t.Fatal(c, err)
+	}
+	want := []string{
+		`^(?<field>POST|GET) /(?<field2>index\.html|login) (?<number>[+-]?\d+(?:\.\d+)?) (?<field3>12ms|7ms)$`,
+		`^(?<field>[A-Z]+) /(?<field2>[\w.-]+) (?<number>[+-]?\d+(?:\.\d+)?) (?<field3>\w+)$`,
+		`^(?<field>\S+) /(?<field2>\S+) (?<number>\S+) (?<field3>\S+)$`,
+	}
+	for i := range c {
+		if c[i].Pattern != want[i] || fmt.Sprint(c[i].Fields) != "[field field2 number field3]" {
+			t.Errorf("%d: %s %v", i, c[i].Pattern, c[i].Fields)
+		}
+		if i > 0 && c[i].Specificity >= c[i-1].Specificity {
+			t.Error(c)
+		}
+	}
+
+	// Names come from key=value pairs, and constant fields stay
+	// literal.
+	c, err = Infer([]string{
+		`2024-01-02T10:00:00Z host=web1.example.com ip=10.0.0.1 user="alice" v=2`,
+		`2024-01-03T11:30:10Z host=db.example.org ip=192.168.1.20 user="bob smith" v=2`,
+	}, nil)
+	if err != nil || fmt.Sprint(c[0].Fields) != "[timestamp host ip user]" || !strings.HasSuffix(c[0].Pattern, " v=2$") {
+		t.Error(c, err)
+	}
+	re := pcre.MustCompile(c[0].Pattern, 0)
+	m, _ := re.MatcherString(`2025-12-31T23:59:59Z host=x.y ip=1.2.3.4 user="" v=2`, 0)
+	if !m.Matches() || m.NamedString("host") != "x.y" || m.NamedString("user") != `""` {
+		t.Error(c[0])
+	}
+
+	// Lines of different shapes leave gaps.
+	c, err = Infer([]string{
+		"Jan  2 10:00:00 web1 sshd[123]: Accepted password for root",
+		"Feb 12 01:02:03 web2 cron[9]: session opened",
+	}, nil)
+	if err != nil || !strings.HasPrefix(c[0].Pattern, `^(?<timestamp>[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}) (?<field>web1|web2) (?<field2>sshd|cron)\[`) {
+		t.Error(c, err)
+	}
+}
+
+func TestInferEmptyGap(t *testing.T) {
+	c, err := Infer([]string{"id=42 tag=abc;", "id=7 tag=;"}, nil)
+	if err != nil || len(c) != 3 || c[2].Pattern != `^id=(?<id>\S+) tag=(?<tag>\S*);$` {
+		t.Error(c, err)
+	}
+}
+
+func TestInferNames(t *testing.T) {
+	// A key which looks like a generated name.
+	c, err := Infer([]string{"a z field2=p", "b w field2=q"}, nil)
+	if err != nil || fmt.Sprint(c[0].Fields) != "[field field2 field2_2]" {
+		t.Error(c, err)
+	}
+	// The most specific candidate is too large to compile.
+	c, err = Infer([]string{strings.Repeat("a", 40000), strings.Repeat("b", 40000)}, nil)
+	if err != nil || len(c) == 0 || len(c[0].Pattern) > 1000 {
+		t.Error(len(c), err)
+	}
+}
+
+func TestInferNegative(t *testing.T) {
+	positive := []string{"GET /a 200", "POST /b 404"}
+	c, err := Infer(positive, []string{"DELETE /c 200"})
+	if err != nil || len(c) != 1 || !strings.HasPrefix(c[0].Pattern, "^(?<field>POST|GET) ") {
+		t.Error(c, err)
+	}
+	if c, err := Infer(positive, []string{"GET /a 200"}); err == nil {
+		t.Error(c)
+	}
+	if c, err := Infer(nil, nil); err == nil {
+		t.Error(c)
+	}
+}
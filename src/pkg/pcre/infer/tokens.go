@@ -0,0 +1,125 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package infer
+
+import (
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"strings"
+)
+
+// A kind of field which the tokenizer recognizes.  Several kinds may
+// share a name, such as the formats of timestamps; a field is written
+// as the alternation of the kinds seen in it.
+type kind struct {
+	name    string
+	pattern string
+	bounded bool // not inside a word or a dotted name
+}
+
+var kinds = []kind{
+	{"timestamp", `\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?`, true},
+	{"timestamp", `\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}`, true},
+	{"timestamp", `[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}`, true},
+	{"date", `\d{4}-\d{2}-\d{2}`, true},
+	{"time", `\d{2}:\d{2}:\d{2}(?:[.,]\d+)?`, true},
+	{"uuid", `[0-9a-fA-F]{8}-(?:[0-9a-fA-F]{4}-){3}[0-9a-fA-F]{12}`, true},
+	{"ip", `(?:\d{1,3}\.){3}\d{1,3}`, true},
+	{"ip", `(?:[0-9a-fA-F]{1,4}:){7}[0-9a-fA-F]{1,4}|(?:[0-9a-fA-F]{1,4}(?::[0-9a-fA-F]{1,4})*)?::(?:[0-9a-fA-F]{1,4}(?::[0-9a-fA-F]{1,4})*)?`, true},
+	{"quoted", `"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`, false},
+	{"host", `(?=[\w.-]*[A-Za-z])[A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?(?:\.[A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?)+`, true},
+	{"number", `[+-]?\d+(?:\.\d+)?`, true},
+}
+
+// Matches the first field at or after a position; group i+1 is set
+// for kinds[i].
+var tokenizer = func() pcre.Regexp {
+	alts := make([]string, len(kinds))
+	for i, k := range kinds {
+		alts[i] = "(" + k.pattern + ")"
+		if k.bounded {
+			alts[i] = `(?<![\w.])` + alts[i] + `(?!\w|\.\w)`
+		}
+	}
+	return pcre.MustCompile(strings.Join(alts, "|"), 0)
+}()
+
+// A token of an example: a field of kinds[kind], or literal text if
+// kind is -1.
+type token struct {
+	kind int
+	text string
+}
+
+// Splits s into fields and, between them, literal words, runs of
+// white space and single other characters.
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	last := 0
+	m, err := tokenizer.MatcherString(s, 0)
+	for ok := m != nil && m.Matches(); ok && err == nil; ok, err = m.Next(0) {
+		match := m.GroupIndex(0)
+		tokens = append(tokens, literals(s[last:match[0]])...)
+		for i := range kinds {
+			if m.Present(i + 1) {
+				tokens = append(tokens, token{i, s[match[0]:match[1]]})
+				break
+			}
+		}
+		last = match[1]
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(tokens, literals(s[last:])...), nil
+}
+
+func isword(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z'
+}
+
+func isspace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+func literals(s string) []token {
+	var tokens []token
+	for len(s) > 0 {
+		n := 1
+		switch {
+		case isword(s[0]):
+			for n < len(s) && isword(s[n]) {
+				n++
+			}
+		case isspace(s[0]):
+			for n < len(s) && isspace(s[n]) {
+				n++
+			}
+		}
+		tokens = append(tokens, token{-1, s[:n]})
+		s = s[n:]
+	}
+	return tokens
+}
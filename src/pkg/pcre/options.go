@@ -0,0 +1,252 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package pcre
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Newline convention for CompileOptions and MatchOptions.  The zero
+// value keeps the default which libpcre was built with.
+type Newline int
+
+const (
+	NewlineDefault Newline = 0
+	NewlineCR      Newline = NEWLINE_CR
+	NewlineLF      Newline = NEWLINE_LF
+	NewlineCRLF    Newline = NEWLINE_CRLF
+	NewlineAny     Newline = NEWLINE_ANY
+	NewlineAnyCRLF Newline = NEWLINE_ANYCRLF
+)
+
+func (n Newline) valid() bool {
+	switch n {
+	case NewlineDefault, NewlineCR, NewlineLF, NewlineCRLF,
+		NewlineAny, NewlineAnyCRLF:
+		return true
+	}
+	return false
+}
+
+// What \R matches, for CompileOptions and MatchOptions.  The zero
+// value keeps the default which libpcre was built with.
+type BSR int
+
+const (
+	BSRDefault BSR = 0
+	BSRAnyCRLF BSR = BSR_ANYCRLF
+	BSRUnicode BSR = BSR_UNICODE
+)
+
+func (b BSR) valid() bool {
+	return b == BSRDefault || b == BSRAnyCRLF || b == BSRUnicode
+}
+
+// Options for CompileWith.  Each field corresponds to the compile
+// flag of the same name, so only flags which make sense at compile
+// time can be expressed.
+type CompileOptions struct {
+	Anchored         bool
+	AutoCallout      bool
+	Caseless         bool
+	DollarEndOnly    bool
+	Dotall           bool
+	DupNames         bool
+	Extended         bool
+	Extra            bool
+	Firstline        bool
+	JavaScriptCompat bool
+	Multiline        bool
+	NeverUTF         bool
+	NoAutoCapture    bool
+	NoAutoPossess    bool
+	NoStartOptimize  bool
+	NoUTF8Check      bool
+	UCP              bool
+	Ungreedy         bool
+	UTF8             bool
+	Newline          Newline
+	BSR              BSR
+}
+
+// Returns the equivalent flags for Compile, or an error if the
+// options contradict each other.
+func (o CompileOptions) Flags() (int, error) {
+	switch {
+	case o.UTF8 && o.NeverUTF:
+		return 0, errors.New("UTF8 and NeverUTF are mutually exclusive")
+	case o.NoUTF8Check && o.NeverUTF:
+		// Without NeverUTF, (*UTF8) may turn on UTF-8 in the pattern.
+		return 0, errors.New("NoUTF8Check and NeverUTF are mutually exclusive")
+	case !o.Newline.valid():
+		return 0, errors.Errorf("invalid Newline value %#x", int(o.Newline))
+	case !o.BSR.valid():
+		return 0, errors.Errorf("invalid BSR value %#x", int(o.BSR))
+	}
+	flags := int(o.Newline) | int(o.BSR)
+	for _, f := range []struct {
+		set  bool
+		flag int
+	}{
+		{o.Anchored, ANCHORED},
+		{o.AutoCallout, AUTO_CALLOUT},
+		{o.Caseless, CASELESS},
+		{o.DollarEndOnly, DOLLAR_ENDONLY},
+		{o.Dotall, DOTALL},
+		{o.DupNames, DUPNAMES},
+		{o.Extended, EXTENDED},
+		{o.Extra, EXTRA},
+		{o.Firstline, FIRSTLINE},
+		{o.JavaScriptCompat, JAVASCRIPT_COMPAT},
+		{o.Multiline, MULTILINE},
+		{o.NeverUTF, NEVER_UTF},
+		{o.NoAutoCapture, NO_AUTO_CAPTURE},
+		{o.NoAutoPossess, NO_AUTO_POSSESS},
+		{o.NoStartOptimize, NO_START_OPTIMIZE},
+		{o.NoUTF8Check, NO_UTF8_CHECK},
+		{o.UCP, UCP},
+		{o.Ungreedy, UNGREEDY},
+		{o.UTF8, UTF8},
+	} {
+		if f.set {
+			flags |= f.flag
+		}
+	}
+	return flags, nil
+}
+
+// Options for the MatchWith functions.  Each field corresponds to the
+// match flag of the same name.  With PartialHard, or with PartialSoft
+// and no complete match, a subject which matches only partly results
+// in PCRE_ERROR_PARTIAL.
+type MatchOptions struct {
+	Anchored        bool
+	NoStartOptimize bool
+	NoUTF8Check     bool
+	NotBOL          bool
+	NotEOL          bool
+	NotEmpty        bool
+	NotEmptyAtStart bool
+	PartialHard     bool
+	PartialSoft     bool
+	Newline         Newline
+	BSR             BSR
+}
+
+// Returns the equivalent flags for Match, or an error if the options
+// contradict each other.
+func (o MatchOptions) Flags() (int, error) {
+	switch {
+	case o.PartialHard && o.PartialSoft:
+		return 0, errors.New("PartialHard and PartialSoft are mutually exclusive")
+	case !o.Newline.valid():
+		return 0, errors.Errorf("invalid Newline value %#x", int(o.Newline))
+	case !o.BSR.valid():
+		return 0, errors.Errorf("invalid BSR value %#x", int(o.BSR))
+	}
+	flags := int(o.Newline) | int(o.BSR)
+	for _, f := range []struct {
+		set  bool
+		flag int
+	}{
+		{o.Anchored, ANCHORED},
+		{o.NoStartOptimize, NO_START_OPTIMIZE},
+		{o.NoUTF8Check, NO_UTF8_CHECK},
+		{o.NotBOL, NOTBOL},
+		{o.NotEOL, NOTEOL},
+		{o.NotEmpty, NOTEMPTY},
+		{o.NotEmptyAtStart, NOTEMPTY_ATSTART},
+		{o.PartialHard, PARTIAL_HARD},
+		{o.PartialSoft, PARTIAL_SOFT},
+	} {
+		if f.set {
+			flags |= f.flag
+		}
+	}
+	return flags, nil
+}
+
+// Like Compile, but takes the flags as a CompileOptions struct.
+// Contradictory options are reported as a CompileError at offset 0,
+// without calling into PCRE.
+func CompileWith(pattern string, opts CompileOptions) (Regexp, *CompileError) {
+	flags, err := opts.Flags()
+	if err != nil {
+		return Regexp{}, &CompileError{
+			Pattern: pattern,
+			Message: err.Error(),
+		}
+	}
+	return Compile(pattern, flags)
+}
+
+// Compile the pattern with the specified options.  If compilation
+// fails, panic.
+func MustCompileWith(pattern string, opts CompileOptions) (re Regexp) {
+	re, err := CompileWith(pattern, opts)
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+
+// Like Match, but takes the flags as a MatchOptions struct.
+// Contradictory options result in an error wrapping
+// PCRE_ERROR_BADOPTION, without calling into PCRE.
+func (m *Matcher) MatchWith(subject []byte, opts MatchOptions) (bool, error) {
+	flags, err := opts.Flags()
+	if err != nil {
+		return false, errors.Wrap(PCRE_ERROR_BADOPTION, err.Error())
+	}
+	return m.Match(subject, flags)
+}
+
+// Like MatchString, but takes the flags as a MatchOptions struct.
+func (m *Matcher) MatchStringWith(subject string, opts MatchOptions) (bool, error) {
+	flags, err := opts.Flags()
+	if err != nil {
+		return false, errors.Wrap(PCRE_ERROR_BADOPTION, err.Error())
+	}
+	return m.MatchString(subject, flags)
+}
+
+// Like Matcher, but takes the flags as a MatchOptions struct.
+func (re Regexp) MatcherWith(subject []byte, opts MatchOptions) (*Matcher, error) {
+	flags, err := opts.Flags()
+	if err != nil {
+		return nil, errors.Wrap(PCRE_ERROR_BADOPTION, err.Error())
+	}
+	return re.Matcher(subject, flags)
+}
+
+// Like MatcherString, but takes the flags as a MatchOptions struct.
+func (re Regexp) MatcherStringWith(subject string, opts MatchOptions) (*Matcher, error) {
+	flags, err := opts.Flags()
+	if err != nil {
+		return nil, errors.Wrap(PCRE_ERROR_BADOPTION, err.Error())
+	}
+	return re.MatcherString(subject, flags)
+}
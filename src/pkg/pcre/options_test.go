@@ -0,0 +1,104 @@
+package pcre
+
+import (
+	"github.com/pkg/errors"
+	"testing"
+)
+
+func TestCompileOptions(t *testing.T) {
+	check := func(opts CompileOptions, flags int) {
+		f, err := opts.Flags()
+		if err != nil {
+			t.Error(opts, err)
+		}
+		if f != flags {
+			t.Errorf("%+v: %#x != %#x", opts, f, flags)
+		}
+	}
+	check(CompileOptions{}, 0)
+	check(CompileOptions{Caseless: true, UTF8: true}, CASELESS|UTF8)
+	check(CompileOptions{UCP: true, NoAutoPossess: true, AutoCallout: true},
+		UCP|NO_AUTO_POSSESS|AUTO_CALLOUT)
+	check(CompileOptions{Newline: NewlineCRLF, BSR: BSRAnyCRLF},
+		NEWLINE_CRLF|BSR_ANYCRLF)
+	check(CompileOptions{UTF8: true, NoUTF8Check: true}, UTF8|NO_UTF8_CHECK)
+	check(CompileOptions{NoUTF8Check: true}, NO_UTF8_CHECK)
+
+	for _, opts := range []CompileOptions{
+		{UTF8: true, NeverUTF: true},
+		{NoUTF8Check: true, NeverUTF: true},
+		{Newline: Newline(NOTBOL)},
+		{BSR: BSRAnyCRLF | BSRUnicode},
+	} {
+		if _, err := opts.Flags(); err == nil {
+			t.Errorf("%+v accepted", opts)
+		}
+		if _, err := CompileWith("a", opts); err == nil {
+			t.Errorf("CompileWith %+v accepted", opts)
+		} else if err.Offset != 0 {
+			t.Error("Offset", err.Offset)
+		}
+	}
+}
+
+func TestCompileWith(t *testing.T) {
+	m, err := MustCompileWith("abc", CompileOptions{Caseless: true}).
+		MatcherStringWith("ABC", MatchOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+	if !m.Matches() {
+		t.Error("Caseless")
+	}
+	re, cerr := CompileWith("(?<a>x)(?<a>y)", CompileOptions{DupNames: true})
+	if cerr != nil {
+		t.Error(cerr)
+	}
+	if re.Groups() != 2 {
+		t.Error("DupNames", re.Groups())
+	}
+	if _, cerr = CompileWith("(*UTF8)\u00e9", CompileOptions{NoUTF8Check: true}); cerr != nil {
+		t.Error(cerr)
+	}
+	if _, cerr = CompileWith("a\\Rb", CompileOptions{BSR: BSRAnyCRLF}); cerr != nil {
+		t.Error(cerr)
+	}
+}
+
+func TestMatchWith(t *testing.T) {
+	re := MustCompile("^b", 0)
+	m, err := re.MatcherStringWith("b", MatchOptions{NotBOL: true})
+	if err != nil {
+		t.Error(err)
+	}
+	if m.Matches() {
+		t.Error("NotBOL")
+	}
+	ok, err := m.MatchWith([]byte("b"), MatchOptions{})
+	if err != nil || !ok {
+		t.Error("MatchWith", ok, err)
+	}
+	_, err = m.MatchStringWith("b",
+		MatchOptions{PartialHard: true, PartialSoft: true})
+	if errors.Cause(err) != PCRE_ERROR_BADOPTION {
+		t.Error("Partial", err)
+	}
+	abc := MustCompile("abc", 0)
+	for _, opts := range []MatchOptions{{PartialHard: true}, {PartialSoft: true}} {
+		m, err = abc.MatcherStringWith("ab", opts)
+		if err != PCRE_ERROR_PARTIAL || m.Matches() {
+			t.Errorf("%+v: %v", opts, err)
+		}
+		if ok, err := m.MatchStringWith("xabc", opts); !ok || err != nil {
+			t.Errorf("%+v: %v %v", opts, ok, err)
+		}
+	}
+	u := MustCompile("a", UTF8)
+	if _, err = u.MatcherStringWith("\xffa", MatchOptions{}); err != PCRE_ERROR_BADUTF8 {
+		t.Error("BADUTF8", err)
+	}
+	_, err = re.MatcherWith([]byte("b"), MatchOptions{Newline: 1})
+	if errors.Cause(err) != PCRE_ERROR_BADOPTION {
+		t.Error("Newline", err)
+	}
+}
@@ -42,6 +42,10 @@
 // subject.  They are mutable and can be reused (using Match,
 // MatchString, Reset or ResetString).
 //
+// CompileAuto hands patterns which use nothing PCRE-specific to the Go
+// regexp package, which guarantees matching in linear time.  The
+// resulting Regexp objects are used in the same way.
+//
 // For details on the regular expression language implemented by this
 // package and the flags defined below, see the PCRE documentation.
 package pcre
@@ -50,16 +54,51 @@ package pcre
 #cgo LDFLAGS: -lpcre
 #cgo CFLAGS: -I/opt/local/include
 #include <pcre.h>
+#include <stdint.h>
 #include <string.h>
+
+int tracestep(pcre_callout_block *block); // in trace.go
+
+// Installs tracestep as the callout function of the process, once
+// before any match, since pcre_exec reads it unsynchronized.
+static void setcallout(void) {
+	pcre_callout = tracestep;
+}
+
+// Calls pcre_exec, reporting the mark, and with callouts going to the
+// Trace with the given id if it is not 0.
+static int execmark(const pcre *code, const char *subject, int length,
+		int start, int options, int *ovector, int ovecsize,
+		unsigned char **mark, uintptr_t trace) {
+	pcre_extra extra;
+	memset(&extra, 0, sizeof(extra));
+	extra.flags = PCRE_EXTRA_MARK;
+	extra.mark = mark;
+	if (trace != 0) {
+		extra.flags |= PCRE_EXTRA_CALLOUT_DATA;
+		extra.callout_data = (void *)trace;
+	}
+	return pcre_exec(code, &extra, subject, length, start, options,
+		ovector, ovecsize);
+}
 */
 import "C"
 
 import (
+	"encoding/binary"
 	"github.com/pkg/errors"
+	"hash/fnv"
+	"regexp"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 	"unsafe"
 )
 
+func init() {
+	C.setcallout()
+}
+
 // Flags for Compile and Match functions.
 const (
 	ANCHORED        = C.PCRE_ANCHORED
@@ -75,6 +114,7 @@ const (
 
 // Flags for Compile functions
 const (
+	AUTO_CALLOUT      = C.PCRE_AUTO_CALLOUT
 	CASELESS          = C.PCRE_CASELESS
 	DOLLAR_ENDONLY    = C.PCRE_DOLLAR_ENDONLY
 	DOTALL            = C.PCRE_DOTALL
@@ -84,12 +124,16 @@ const (
 	FIRSTLINE         = C.PCRE_FIRSTLINE
 	JAVASCRIPT_COMPAT = C.PCRE_JAVASCRIPT_COMPAT
 	MULTILINE         = C.PCRE_MULTILINE
+	NEVER_UTF         = C.PCRE_NEVER_UTF
 	NO_AUTO_CAPTURE   = C.PCRE_NO_AUTO_CAPTURE
+	NO_AUTO_POSSESS   = C.PCRE_NO_AUTO_POSSESS
+	UCP               = C.PCRE_UCP
 	UNGREEDY          = C.PCRE_UNGREEDY
 	UTF8              = C.PCRE_UTF8
 )
 
-// Flags for Match functions
+// Flags for Match functions.  NO_START_OPTIMIZE can be passed to
+// Compile as well.
 const (
 	NOTBOL            = C.PCRE_NOTBOL
 	NOTEOL            = C.PCRE_NOTEOL
@@ -101,15 +145,22 @@ const (
 )
 
 var (
-	PCRE_ERROR_NOMATCH    = errors.New("PCRE_ERROR_NOMATCH")
-	PCRE_ERROR_MATCHLIMIT = errors.New("PCRE_ERROR_MATCHLIMIT")
-	PCRE_ERROR_BADOPTION  = errors.New("PCRE_ERROR_BADOPTION")
+	PCRE_ERROR_NOMATCH        = errors.New("PCRE_ERROR_NOMATCH")
+	PCRE_ERROR_MATCHLIMIT     = errors.New("PCRE_ERROR_MATCHLIMIT")
+	PCRE_ERROR_RECURSIONLIMIT = errors.New("PCRE_ERROR_RECURSIONLIMIT")
+	PCRE_ERROR_BADOPTION      = errors.New("PCRE_ERROR_BADOPTION")
+	PCRE_ERROR_PARTIAL        = errors.New("PCRE_ERROR_PARTIAL")
+	PCRE_ERROR_BADUTF8        = errors.New("PCRE_ERROR_BADUTF8")
+	PCRE_ERROR_BADUTF8_OFFSET = errors.New("PCRE_ERROR_BADUTF8_OFFSET")
 )
 
 // A reference to a compiled regular expression.
 // Use Compile or MustCompile to create such objects.
 type Regexp struct {
-	ptr []byte
+	ptr     []byte
+	re2     *regexp.Regexp // non-nil if matching uses the Go engine
+	pattern string         // source, as passed to Compile, but see String
+	flags   int
 }
 
 // Number of bytes in the compiled pattern
@@ -176,7 +227,43 @@ func Compile(pattern string, flags int) (Regexp, *CompileError) {
 			Offset:  int(erroffset),
 		}
 	}
-	return toheap(ptr), nil
+	re := toheap(ptr)
+	re.pattern = unescapeslashes(pattern)
+	re.flags = flags
+	return re, nil
+}
+
+// Returns the pattern with \/ written as /, which means the same
+// outside \Q...\E.  Pattern literals such as those of MarshalText
+// cannot tell the two apart, so recording the pattern this way lets it
+// survive a round trip through them.
+func unescapeslashes(pattern string) string {
+	if !strings.Contains(pattern, `\/`) {
+		return pattern
+	}
+	b := make([]byte, 0, len(pattern))
+	quoted := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c != '\\' || i+1 == len(pattern) {
+			b = append(b, c)
+			continue
+		}
+		switch next := pattern[i+1]; {
+		case quoted && next != 'E':
+			// A literal backslash; the next byte is looked at
+			// on its own.
+			b = append(b, c)
+			continue
+		case next == '/':
+			b = append(b, next)
+		default:
+			quoted = next == 'Q' || quoted && next != 'E'
+			b = append(b, c, next)
+		}
+		i++
+	}
+	return string(b)
 }
 
 // Compile the pattern.  If compilation fails, panic.
@@ -188,6 +275,47 @@ func MustCompile(pattern string, flags int) (re Regexp) {
 	return
 }
 
+// Returns the source of the pattern, with \/ written as / outside
+// \Q...\E.
+func (re Regexp) String() string {
+	return re.pattern
+}
+
+// Returns the flags the pattern was compiled with.
+func (re Regexp) Flags() int {
+	return re.flags
+}
+
+// Compile the source of the pattern again, with extraFlags added to
+// its flags.  The Go engine is used where possible if re uses it.
+func (re Regexp) Recompile(extraFlags int) (Regexp, *CompileError) {
+	if re.ptr == nil {
+		panic("Regexp.Recompile: uninitialized")
+	}
+	if re.re2 != nil {
+		return CompileAuto(re.pattern, re.flags|extraFlags)
+	}
+	return Compile(re.pattern, re.flags|extraFlags)
+}
+
+// Returns true if both objects were compiled from the same pattern
+// with the same flags.
+func (re Regexp) Equal(other Regexp) bool {
+	return re.pattern == other.pattern && re.flags == other.flags
+}
+
+// Returns a hash of the pattern and flags, consistent with Equal.
+// Regexp values cannot be map keys themselves, but the hash can, for
+// example to deduplicate patterns.
+func (re Regexp) Hash() uint64 {
+	h := fnv.New64a()
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(re.flags))
+	h.Write(b[:])
+	h.Write([]byte(re.pattern))
+	return h.Sum64()
+}
+
 // Returns the number of capture groups in the compiled pattern.
 func (re Regexp) Groups() int {
 	if re.ptr == nil {
@@ -216,16 +344,74 @@ func (re Regexp) NamedGroups() map[string]int {
 	return groups
 }
 
+// Information about a compiled pattern, as reported by pcre_fullinfo.
+type Info struct {
+	Options       int  // compile flags, with changes at the start of the pattern
+	Size          int  // size of the compiled pattern in bytes
+	Groups        int  // number of capture groups
+	BackrefMax    int  // highest back reference, or 0
+	Names         int  // number of named groups
+	MinLength     int  // lower bound for the length of a match, or -1
+	MaxLookbehind int  // longest lookbehind, in characters
+	FirstChar     int  // character which starts every match, or -1
+	StartOfLine   bool // matches only start at the start of a line
+	RequiredChar  int  // character which every match contains, or -1
+	HasCROrLF     bool // the pattern contains an explicit CR or LF
+	JChanged      bool // (?J) or (?-J) is used
+	MatchEmpty    bool // the pattern can match the empty string
+}
+
+func infoint(ptr *C.pcre, what C.int) int {
+	var value C.int
+	C.pcre_fullinfo(ptr, nil, what, unsafe.Pointer(&value))
+	return int(value)
+}
+
+// Returns information about the compiled pattern.
+func (re Regexp) Info() (info Info) {
+	if re.ptr == nil {
+		panic("Regexp.Info: uninitialized")
+	}
+	ptr := (*C.pcre)(unsafe.Pointer(&re.ptr[0]))
+	var options C.ulong
+	C.pcre_fullinfo(ptr, nil, C.PCRE_INFO_OPTIONS, unsafe.Pointer(&options))
+	info.Options = int(options)
+	info.Size = int(pcresize(ptr))
+	info.Groups = infoint(ptr, C.PCRE_INFO_CAPTURECOUNT)
+	info.BackrefMax = infoint(ptr, C.PCRE_INFO_BACKREFMAX)
+	info.Names = infoint(ptr, C.PCRE_INFO_NAMECOUNT)
+	info.MinLength = infoint(ptr, C.PCRE_INFO_MINLENGTH)
+	info.MaxLookbehind = infoint(ptr, C.PCRE_INFO_MAXLOOKBEHIND)
+	info.FirstChar = -1
+	switch infoint(ptr, C.PCRE_INFO_FIRSTCHARACTERFLAGS) {
+	case 1:
+		info.FirstChar = infoint(ptr, C.PCRE_INFO_FIRSTCHARACTER)
+	case 2:
+		info.StartOfLine = true
+	}
+	info.RequiredChar = -1
+	if infoint(ptr, C.PCRE_INFO_REQUIREDCHARFLAGS) != 0 {
+		info.RequiredChar = infoint(ptr, C.PCRE_INFO_REQUIREDCHAR)
+	}
+	info.HasCROrLF = infoint(ptr, C.PCRE_INFO_HASCRORLF) != 0
+	info.JChanged = infoint(ptr, C.PCRE_INFO_JCHANGED) != 0
+	info.MatchEmpty = infoint(ptr, C.PCRE_INFO_MATCH_EMPTY) != 0
+	return
+}
+
 // Matcher objects provide a place for storing match results.
 // They can be created by the Matcher and MatcherString functions,
 // or they can be initialized with Reset or ResetString.
 type Matcher struct {
 	re       Regexp
 	groups   int
+	utf8     bool    // pattern is in UTF-8 mode, perhaps through (*UTF8)
 	ovector  []C.int // scratch space for capture offsets
 	matches  bool    // last match was successful
+	mark     string  // (*MARK) name from the last match attempt
 	subjects string  // one of these fields is set to record the subject,
 	subjectb []byte  // so that Group/GroupString can return slices
+	trace    uintptr // id of the Trace being recorded, or 0
 }
 
 // Returns a new matcher object, with the byte array slice as a
@@ -274,6 +460,7 @@ func (m *Matcher) init(re Regexp) {
 	}
 	m.re = re
 	m.groups = re.Groups()
+	m.utf8 = re.Info().Options&UTF8 != 0
 	if ovectorlen := 3 * (1 + m.groups); len(m.ovector) < ovectorlen {
 		m.ovector = make([]C.int, ovectorlen)
 	}
@@ -315,9 +502,39 @@ func (m *Matcher) MatchString(subject string, flags int) (bool, error) {
 }
 
 func (m *Matcher) match(subjectptr *C.char, length, flags int) (bool, error) {
-	rc := C.pcre_exec((*C.pcre)(unsafe.Pointer(&m.re.ptr[0])), nil,
+	if m.re.re2 != nil && flags&^NO_UTF8_CHECK == 0 && m.matchre2() {
+		return m.matches, nil
+	}
+	return m.exec(subjectptr, length, 0, flags)
+}
+
+// Tries to match the current subject again, starting at the byte
+// offset start.  Unlike matching a slice of the subject, this keeps
+// the text before start visible to lookbehind assertions and \b.
+// Always uses PCRE.
+func (m *Matcher) matchfrom(start, flags int) (bool, error) {
+	subjectptr := (*C.char)(unsafe.Pointer(&nullbyte[0]))
+	length := len(m.subjectb)
+	switch {
+	case length > 0:
+		subjectptr = (*C.char)(unsafe.Pointer(&m.subjectb[0]))
+	case m.subjects != "":
+		length = len(m.subjects)
+		subjectptr = *(**C.char)(unsafe.Pointer(&m.subjects))
+	}
+	return m.exec(subjectptr, length, start, flags)
+}
+
+func (m *Matcher) exec(subjectptr *C.char, length, start, flags int) (bool, error) {
+	var mark *C.uchar
+	rc := C.execmark((*C.pcre)(unsafe.Pointer(&m.re.ptr[0])),
 		subjectptr, C.int(length),
-		0, C.int(flags), &m.ovector[0], C.int(len(m.ovector)))
+		C.int(start), C.int(flags), &m.ovector[0], C.int(len(m.ovector)),
+		&mark, C.uintptr_t(m.trace))
+	m.mark = ""
+	if mark != nil {
+		m.mark = C.GoString((*C.char)(unsafe.Pointer(mark)))
+	}
 	switch {
 	case rc >= 0:
 		m.matches = true
@@ -328,6 +545,20 @@ func (m *Matcher) match(subjectptr *C.char, length, flags int) (bool, error) {
 	case rc == C.PCRE_ERROR_MATCHLIMIT:
 		m.matches = false
 		return false, PCRE_ERROR_MATCHLIMIT
+	case rc == C.PCRE_ERROR_RECURSIONLIMIT:
+		m.matches = false
+		return false, PCRE_ERROR_RECURSIONLIMIT
+	case rc == C.PCRE_ERROR_PARTIAL:
+		// Only with PARTIAL_SOFT or PARTIAL_HARD.
+		m.matches = false
+		return false, PCRE_ERROR_PARTIAL
+	case rc == C.PCRE_ERROR_BADUTF8:
+		// Only in UTF-8 mode without NO_UTF8_CHECK.
+		m.matches = false
+		return false, PCRE_ERROR_BADUTF8
+	case rc == C.PCRE_ERROR_BADUTF8_OFFSET:
+		m.matches = false
+		return false, PCRE_ERROR_BADUTF8_OFFSET
 	case rc == C.PCRE_ERROR_BADOPTION:
 		// panic("PCRE.Match: invalid option flag")
 		m.matches = false
@@ -337,12 +568,78 @@ func (m *Matcher) match(subjectptr *C.char, length, flags int) (bool, error) {
 		strconv.Itoa(int(rc)))
 }
 
+// Searches the subject of the last successful match again, for the
+// next match after it.  Matches are found in the same way as with the
+// g modifier in Perl: after an empty match, a non-empty match at the
+// same position is tried before moving on by one character.  Returns
+// false when there are no more matches.
+func (m *Matcher) Next(flags int) (bool, error) {
+	if !m.matches {
+		return false, nil
+	}
+	start, end := int(m.ovector[0]), int(m.ovector[1])
+	if start == end {
+		matched, err := m.matchfrom(end, flags|NOTEMPTY_ATSTART|ANCHORED)
+		if matched || err != nil {
+			return matched, err
+		}
+		length := len(m.subjectb) + len(m.subjects)
+		if end >= length {
+			return false, nil
+		}
+		end++
+		if m.utf8 {
+			for end < length && !utf8.RuneStart(m.byteat(end)) {
+				end++
+			}
+		}
+	}
+	return m.matchfrom(end, flags)
+}
+
+func (m *Matcher) byteat(i int) byte {
+	if m.subjectb != nil {
+		return m.subjectb[i]
+	}
+	return m.subjects[i]
+}
+
+// Match the current subject with the Go engine.  Returns false if
+// PCRE has to handle the subject because it is not valid UTF-8.
+func (m *Matcher) matchre2() bool {
+	var loc []int
+	if m.subjectb != nil {
+		if !utf8.Valid(m.subjectb) {
+			return false
+		}
+		loc = m.re.re2.FindSubmatchIndex(m.subjectb)
+	} else {
+		if !utf8.ValidString(m.subjects) {
+			return false
+		}
+		loc = m.re.re2.FindStringSubmatchIndex(m.subjects)
+	}
+	m.matches = loc != nil
+	m.mark = ""
+	for i, v := range loc {
+		m.ovector[i] = C.int(v)
+	}
+	return true
+}
+
 // Returns true if a previous call to Matcher, MatcherString, Reset,
 // ResetString, Match or MatchString succeeded.
 func (m *Matcher) Matches() bool {
 	return m.matches
 }
 
+// Returns the name of the last (*MARK) passed by the last match
+// attempt, or "" if there was none.  PCRE also records the mark for
+// failed matches.
+func (m *Matcher) Mark() string {
+	return m.mark
+}
+
 // Returns the number of groups in the current pattern.
 func (m *Matcher) Groups() int {
 	return m.groups
@@ -373,6 +670,15 @@ func (m *Matcher) Group(group int) []byte {
 	return nil
 }
 
+// Returns the start and end offset of the numbered capture group in
+// the subject, or nil if the group is not present.
+func (m *Matcher) GroupIndex(group int) []int {
+	if start := m.ovector[2*group]; start >= 0 {
+		return []int{int(start), int(m.ovector[2*group+1])}
+	}
+	return nil
+}
+
 // Returns the numbered capture group as a string.  Group 0 is the
 // part of the subject which matches the whole pattern; the first
 // actual capture group is numbered 1.  Capture groups which are not
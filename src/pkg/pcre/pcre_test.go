@@ -43,7 +43,7 @@ func TestCompileFail(t *testing.T) {
 	check("a\000bc", "NUL byte in pattern", 1)
 }
 
-func strings(b [][]byte) (r []string) {
+func tostrings(b [][]byte) (r []string) {
 	r = make([]string, len(b))
 	for i, v := range b {
 		r[i] = string(v)
@@ -170,6 +170,26 @@ func checkSubstring(t *testing.T, k, i, ii string) {
 	}
 }
 
+func TestInfo(t *testing.T) {
+	info := MustCompile(`^(?<a>x)b+(c)\2?`, CASELESS).Info()
+	if info.Groups != 2 || info.Names != 1 || info.BackrefMax != 2 ||
+		info.MinLength != 3 || info.Options&CASELESS == 0 || info.MatchEmpty {
+		t.Errorf("%+v", info)
+	}
+	info = MustCompile(`ab*c`, 0).Info()
+	if info.FirstChar != 'a' || info.RequiredChar != 'c' || info.StartOfLine {
+		t.Errorf("%+v", info)
+	}
+	info = MustCompile(`(?m)^x|^y`, 0).Info()
+	if info.FirstChar != -1 || !info.StartOfLine {
+		t.Errorf("%+v", info)
+	}
+	info = MustCompile(`(?<=ab)\n?`, 0).Info()
+	if info.MaxLookbehind != 2 || !info.HasCROrLF || !info.MatchEmpty {
+		t.Errorf("%+v", info)
+	}
+}
+
 func TestNamedGroup(t *testing.T) {
 	re := MustCompile(`{hostname: (?<hostname>.*), ip: (?<ip>.*), topic: (?<topic>.*)} (?<source_msg>.*)`, 0)
 	for k, i := range re.NamedGroups() {
@@ -266,3 +286,91 @@ func TestReplaceAll(t *testing.T) {
 		t.Error("ReplaceAll2", result)
 	}
 }
+
+func TestSource(t *testing.T) {
+	re := MustCompile("a(b)c", CASELESS)
+	if re.String() != "a(b)c" {
+		t.Error("String", re.String())
+	}
+	if re.Flags() != CASELESS {
+		t.Error("Flags", re.Flags())
+	}
+	re2, err := re.Recompile(UTF8)
+	if err != nil {
+		t.Error(err)
+	}
+	if re2.String() != re.String() || re2.Flags() != CASELESS|UTF8 {
+		t.Error("Recompile", re2.String(), re2.Flags())
+	}
+	if re.Equal(re2) || re.Hash() == re2.Hash() {
+		t.Error("Equal", re2.Flags())
+	}
+	re3 := MustCompile("a(b)c", CASELESS)
+	if !re.Equal(re3) || re.Hash() != re3.Hash() {
+		t.Error("Equal")
+	}
+	seen := map[uint64]Regexp{}
+	for _, r := range []Regexp{re, re2, re3} {
+		seen[r.Hash()] = r
+	}
+	if len(seen) != 2 {
+		t.Error("Hash", len(seen))
+	}
+	re4, _ := CompileAuto("abc", 0)
+	if re4, _ = re4.Recompile(CASELESS); re4.Engine() != EngineGo {
+		t.Error("Recompile Engine", re4.Engine())
+	}
+}
+
+func TestNext(t *testing.T) {
+	check := func(pattern string, flags int, subject string, matches ...string) {
+		m, err := MustCompile(pattern, flags).MatcherString(subject, 0)
+		if err != nil {
+			t.Error(err)
+		}
+		var found []string
+		for ok := m.Matches(); ok; ok, err = m.Next(0) {
+			loc := m.GroupIndex(0)
+			found = append(found, subject[loc[0]:loc[1]])
+		}
+		if err != nil {
+			t.Error(err)
+		}
+		if !equal(found, matches) {
+			t.Error(pattern, subject, found)
+		}
+	}
+	check(`\d+`, 0, "a1b22c333", "1", "22", "333")
+	check(`x*`, 0, "axb", "", "x", "", "")
+	check(`(?<=a)b`, 0, "abab", "b", "b")
+	check(`\b\w`, 0, "ab cd", "a", "c")
+	check(``, UTF8, "äb", "", "", "")
+	check(`(*UTF8)`, 0, "äb", "", "", "")
+	check(`z`, 0, "abc")
+}
+
+func TestGroupIndex(t *testing.T) {
+	m, _ := MustCompile(`a(x)?(b)`, 0).MatcherString("cab", 0)
+	if loc := m.GroupIndex(2); loc == nil || loc[0] != 2 || loc[1] != 3 {
+		t.Error("GroupIndex(2)", loc)
+	}
+	if loc := m.GroupIndex(1); loc != nil {
+		t.Error("GroupIndex(1)", loc)
+	}
+}
+
+func TestMark(t *testing.T) {
+	re := MustCompile(`(*MARK:A)x|(*MARK:B)y`, 0)
+	m, _ := re.MatcherString("ay", 0)
+	if !m.Matches() || m.Mark() != "B" {
+		t.Error("Mark", m.Mark())
+	}
+	m.MatchString("x", 0)
+	if m.Mark() != "A" {
+		t.Error("Mark", m.Mark())
+	}
+	m, _ = MustCompile("x", 0).MatcherString("x", 0)
+	if m.Mark() != "" {
+		t.Error("Mark", m.Mark())
+	}
+}
@@ -0,0 +1,461 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package pcretest checks package pcre against test files in the
+// format of the pcretest program, which the PCRE project uses for its
+// own test suite.
+//
+// A pcretest output file (testoutput1, testoutput2, ...) repeats
+// every pattern and subject line of the corresponding input file,
+// followed by the results pcretest printed for it.  Run reads such a
+// file, compiles each pattern with pcre.Compile, matches each subject
+// with a pcre.Matcher, formats the groups as pcretest does, and
+// compares the result with the expected lines.  Compilation errors
+// ("Failed: ... at offset N") are compared as well.  Only output files
+// are read: the input files carry no expected results.
+//
+// Only a subset of the pcretest modifiers and subject escapes can be
+// expressed with the pcre package.  Patterns and subjects which use
+// others are counted as skipped rather than failed.
+package pcretest
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A subject whose output differs from the expected output.
+type Failure struct {
+	File     string
+	Line     int // line of the subject, or of the pattern
+	Pattern  string
+	Subject  string
+	Expected []string
+	Actual   []string
+}
+
+// Returns the expected and actual output in unified diff style.
+func (f *Failure) Diff() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s:%d: %s\n", f.File, f.Line, f.Pattern)
+	if f.Subject != "" {
+		fmt.Fprintf(&b, "    %s\n", f.Subject)
+	}
+	for _, l := range f.Expected {
+		fmt.Fprintf(&b, "-%s\n", l)
+	}
+	for _, l := range f.Actual {
+		fmt.Fprintf(&b, "+%s\n", l)
+	}
+	return b.String()
+}
+
+func (f *Failure) Error() string {
+	return f.Diff()
+}
+
+// The outcome of running a test file.  Patterns which fail to compile
+// count as one case; otherwise each subject is a case.
+type Report struct {
+	Passed   int
+	Skipped  int
+	Failures []*Failure
+}
+
+// Compile flags for the pcretest pattern modifiers.
+var modifiers = map[byte]int{
+	'i': pcre.CASELESS,
+	'm': pcre.MULTILINE,
+	's': pcre.DOTALL,
+	'x': pcre.EXTENDED,
+	'A': pcre.ANCHORED,
+	'E': pcre.DOLLAR_ENDONLY,
+	'f': pcre.FIRSTLINE,
+	'J': pcre.DUPNAMES,
+	'N': pcre.NO_AUTO_CAPTURE,
+	'O': pcre.NO_AUTO_POSSESS,
+	'U': pcre.UNGREEDY,
+	'W': pcre.UCP,
+	'X': pcre.EXTRA,
+	'Y': pcre.NO_START_OPTIMIZE,
+	'8': pcre.UTF8,
+	'9': pcre.NEVER_UTF,
+	'?': pcre.NO_UTF8_CHECK,
+}
+
+// Compile flags for the <...> pattern modifiers.
+var newlines = map[string]int{
+	"cr":          pcre.NEWLINE_CR,
+	"lf":          pcre.NEWLINE_LF,
+	"crlf":        pcre.NEWLINE_CRLF,
+	"any":         pcre.NEWLINE_ANY,
+	"anycrlf":     pcre.NEWLINE_ANYCRLF,
+	"bsr_anycrlf": pcre.BSR_ANYCRLF,
+	"bsr_unicode": pcre.BSR_UNICODE,
+	"JS":          pcre.JAVASCRIPT_COMPAT,
+}
+
+// Result lines in the output file.
+var resultline = regexp.MustCompile(`^( ?\d+[:+]( |$)|No match|Partial match|Error -?\d+|Failed: |Matched, but )`)
+
+// A pattern with its modifiers.
+type pattern struct {
+	source string
+	flags  int
+	rest   bool // the + modifier: show the rest of the subject
+	skip   string
+}
+
+// Parse the modifiers after the closing delimiter.
+func parsemodifiers(p *pattern, mods string) {
+	for i := 0; i < len(mods); i++ {
+		c := mods[i]
+		switch {
+		case modifiers[c] != 0:
+			p.flags |= modifiers[c]
+		case c == 'S':
+			// Studying does not change results; S+ and S- select
+			// the JIT.
+			if i+1 < len(mods) && (mods[i+1] == '+' || mods[i+1] == '-') {
+				i++
+			}
+		case c == '+':
+			p.rest = true
+		case c == '<':
+			end := strings.IndexByte(mods[i:], '>')
+			if end < 0 || newlines[mods[i+1:i+end]] == 0 {
+				p.skip = "modifier " + mods[i:]
+				return
+			}
+			p.flags |= newlines[mods[i+1:i+end]]
+			i += end
+		case c == ' ' || c == '\r':
+		default:
+			p.skip = "modifier " + string(c)
+			return
+		}
+	}
+}
+
+// Match flags for the subject escapes which set them.
+var subjectflags = map[byte]int{
+	'A': pcre.ANCHORED,
+	'B': pcre.NOTBOL,
+	'Z': pcre.NOTEOL,
+	'Y': pcre.NO_START_OPTIMIZE,
+	'?': pcre.NO_UTF8_CHECK,
+}
+
+// Decode the escapes in a subject line.  Returns the subject and the
+// match flags, or a reason to skip the subject.
+func parsesubject(line string, utf bool) ([]byte, int, string) {
+	var b []byte
+	flags := 0
+	appendchar := func(c int) string {
+		if utf {
+			b = utf8.AppendRune(b, rune(c))
+		} else if c > 255 {
+			return "character value out of range"
+		} else {
+			b = append(b, byte(c))
+		}
+		return ""
+	}
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if c != '\\' || i+1 == len(line) {
+			b = append(b, c)
+			continue
+		}
+		i++
+		switch e := line[i]; {
+		case strings.IndexByte("abefnrtv", e) >= 0:
+			b = append(b, "\a\b\033\f\n\r\t\v"[strings.IndexByte("abefnrtv", e)])
+		case '0' <= e && e <= '7':
+			j := i
+			for j < len(line) && j < i+3 && '0' <= line[j] && line[j] <= '7' {
+				j++
+			}
+			v, _ := strconv.ParseInt(line[i:j], 8, 32)
+			if reason := appendchar(int(v)); reason != "" {
+				return nil, 0, reason
+			}
+			i = j - 1
+		case e == 'x' && strings.HasPrefix(line[i+1:], "{"):
+			end := strings.IndexByte(line[i:], '}')
+			if end < 0 {
+				return nil, 0, "unterminated \\x{"
+			}
+			v, err := strconv.ParseInt(line[i+2:i+end], 16, 32)
+			if err != nil {
+				return nil, 0, "invalid \\x{}"
+			}
+			if reason := appendchar(int(v)); reason != "" {
+				return nil, 0, reason
+			}
+			i += end
+		case e == 'x':
+			j := i + 1
+			for j < len(line) && j < i+3 && strings.IndexByte("0123456789abcdefABCDEF", line[j]) >= 0 {
+				j++
+			}
+			v, _ := strconv.ParseInt("0"+line[i+1:j], 16, 32)
+			b = append(b, byte(v))
+			i = j - 1
+		case e == 'N':
+			if strings.HasPrefix(line[i+1:], `\N`) {
+				flags |= pcre.NOTEMPTY_ATSTART
+				i += 2
+			} else {
+				flags |= pcre.NOTEMPTY
+			}
+		case subjectflags[e] != 0:
+			flags |= subjectflags[e]
+		case isalnum(e) || e == '>' || e == '<':
+			return nil, 0, "subject escape \\" + string(e)
+		default:
+			b = append(b, e)
+		}
+	}
+	return b, flags, ""
+}
+
+func isalnum(c byte) bool {
+	return '0' <= c && c <= '9' || 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z'
+}
+
+// Format group text as pcretest does: printable ASCII as is, other
+// characters as hexadecimal escapes.
+func printable(s []byte, utf bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c, size := rune(s[i]), 1
+		if utf {
+			c, size = utf8.DecodeRune(s[i:])
+			if c == utf8.RuneError && size == 1 {
+				c = rune(s[i])
+			}
+		}
+		i += size
+		switch {
+		case c >= 32 && c < 127:
+			b.WriteRune(c)
+		case utf:
+			fmt.Fprintf(&b, `\x{%x}`, c)
+		default:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		}
+	}
+	return b.String()
+}
+
+// The lines pcretest prints for the errors of pcre_exec.  pcretest
+// adds the offset and reason to PCRE_ERROR_BADUTF8, which the
+// Matcher does not return, so such subjects are skipped.
+var errorlines = map[error]string{
+	pcre.PCRE_ERROR_BADOPTION:      "Error -3 (bad option value)",
+	pcre.PCRE_ERROR_MATCHLIMIT:     "Error -8 (match limit exceeded)",
+	pcre.PCRE_ERROR_BADUTF8_OFFSET: "Error -11 (bad UTF-8 offset)",
+	pcre.PCRE_ERROR_RECURSIONLIMIT: "Error -21 (recursion limit exceeded)",
+}
+
+// Match the subject and format the results as pcretest does.  Returns
+// a reason instead if the results cannot be formatted.
+func run(re pcre.Regexp, p *pattern, subject []byte, flags int) ([]string, string) {
+	m, err := re.Matcher(subject, flags)
+	switch {
+	case err != nil && errorlines[err] != "":
+		return []string{errorlines[err]}, ""
+	case err != nil:
+		return nil, err.Error()
+	case !m.Matches():
+		return []string{"No match"}, ""
+	}
+	utf := p.flags&pcre.UTF8 != 0
+	top := 0
+	for i := 0; i <= m.Groups(); i++ {
+		if m.Present(i) {
+			top = i
+		}
+	}
+	var out []string
+	// pcretest output files have trailing white space removed,
+	// like the lines read by Run.
+	for i := 0; i <= top; i++ {
+		if m.Present(i) {
+			out = append(out, strings.TrimRight(fmt.Sprintf("%2d: %s", i, printable(m.Group(i), utf)), " \t"))
+		} else {
+			out = append(out, fmt.Sprintf("%2d: <unset>", i))
+		}
+		if i == 0 && p.rest {
+			loc := m.GroupIndex(0)
+			out = append(out, strings.TrimRight(fmt.Sprintf("%2d+ %s", 0, printable(subject[loc[1]:], utf)), " \t"))
+		}
+	}
+	return out, ""
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Reads a pcretest output file from r and checks every pattern and
+// subject in it.  The name is used in failure reports.  The returned
+// error is only set for read errors and malformed input.
+func Run(r io.Reader, name string) (*Report, error) {
+	var lines []string
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		lines = append(lines, strings.TrimRight(s.Text(), " \t\r"))
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	report := new(Report)
+	// Collect the result lines starting at index i.
+	results := func(i int) ([]string, int) {
+		j := i
+		for j < len(lines) && resultline.MatchString(lines[j]) {
+			j++
+		}
+		return lines[i:j], j
+	}
+	fail := func(f *Failure) {
+		f.File = name
+		report.Failures = append(report.Failures, f)
+	}
+	for i := 0; i < len(lines); {
+		line := strings.TrimLeft(lines[i], " \t")
+		if line == "" || strings.HasPrefix(lines[i], "PCRE version") {
+			i++
+			continue
+		}
+		// The pattern may continue on the following lines until
+		// the closing delimiter.
+		start := i
+		delim := line[0]
+		text := line[1:]
+		end := -1
+		for {
+			for k := 0; k < len(text); k++ {
+				if text[k] == '\\' {
+					k++
+				} else if text[k] == delim {
+					end = k
+					break
+				}
+			}
+			if end >= 0 || i+1 >= len(lines) {
+				break
+			}
+			i++
+			text += "\n" + lines[i]
+		}
+		i++
+		if end < 0 {
+			return report, fmt.Errorf("%s:%d: unterminated pattern", name, start+1)
+		}
+		p := &pattern{source: text[:end]}
+		parsemodifiers(p, text[end+1:])
+		head := lines[start]
+		var (
+			re   pcre.Regexp
+			cerr *pcre.CompileError
+		)
+		if p.skip == "" {
+			re, cerr = pcre.Compile(p.source, p.flags)
+		}
+		expected, next := results(i)
+		i = next
+		if cerr != nil {
+			actual := []string{fmt.Sprintf("Failed: %s at offset %d", cerr.Message, cerr.Offset)}
+			if equal(expected, actual) {
+				report.Passed++
+			} else {
+				fail(&Failure{Line: start + 1, Pattern: head, Expected: expected, Actual: actual})
+			}
+		} else if p.skip == "" && len(expected) > 0 {
+			// pcretest failed to compile the pattern, but we did not.
+			fail(&Failure{Line: start + 1, Pattern: head, Expected: expected})
+		}
+		for i < len(lines) && lines[i] != "" {
+			if line := lines[i]; line[0] != ' ' && line[0] != '\t' {
+				// Information printed by modifiers such as I.
+				i++
+				continue
+			}
+			subject := strings.TrimLeft(lines[i], " \t")
+			lineno := i + 1
+			expected, next := results(i + 1)
+			i = next
+			if p.skip != "" || cerr != nil {
+				report.Skipped++
+				continue
+			}
+			b, flags, reason := parsesubject(subject, p.flags&pcre.UTF8 != 0)
+			if reason != "" {
+				report.Skipped++
+				continue
+			}
+			actual, reason := run(re, p, b, flags)
+			if reason != "" {
+				report.Skipped++
+				continue
+			}
+			if equal(expected, actual) {
+				report.Passed++
+			} else {
+				fail(&Failure{Line: lineno, Pattern: head, Subject: subject, Expected: expected, Actual: actual})
+			}
+		}
+	}
+	return report, nil
+}
+
+// Like Run, but reads the named file.
+func RunFile(path string) (*Report, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Run(f, path)
+}
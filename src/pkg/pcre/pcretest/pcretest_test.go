@@ -0,0 +1,97 @@
+package pcretest
+
+import (
+	"flag"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var files = flag.String("pcretest", "",
+	"comma-separated pcretest output files to check, such as testdata/testoutput1 from a PCRE source tree")
+
+func check(t *testing.T, path string) *Report {
+	report, err := RunFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range report.Failures {
+		t.Error(f.Diff())
+	}
+	t.Logf("%s: %d passed, %d failed, %d skipped", path,
+		report.Passed, len(report.Failures), report.Skipped)
+	return report
+}
+
+func TestSample(t *testing.T) {
+	report := check(t, filepath.Join("testdata", "testoutput"))
+	if report.Passed != 36 || report.Skipped != 2 {
+		t.Error("Passed", report.Passed, "Skipped", report.Skipped)
+	}
+}
+
+func TestUpstream(t *testing.T) {
+	if *files == "" {
+		t.Skip("no -pcretest files")
+	}
+	for _, path := range strings.Split(*files, ",") {
+		check(t, path)
+	}
+}
+
+func TestRunFailure(t *testing.T) {
+	report, err := Run(strings.NewReader("/a(b)/\n    ab\n 0: ab\n 1: c\n"), "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Passed != 0 || len(report.Failures) != 1 {
+		t.Fatal("Passed", report.Passed, "Failures", len(report.Failures))
+	}
+	f := report.Failures[0]
+	if f.Line != 2 || f.Subject != "ab" || f.Actual[1] != " 1: b" {
+		t.Error(f.Diff())
+	}
+	report, err = Run(strings.NewReader("/a/\nFailed: nothing to repeat at offset 0\n"), "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Failures) != 1 || report.Failures[0].Line != 1 || report.Failures[0].Actual != nil {
+		t.Error("compiled pattern expected to fail", len(report.Failures))
+	}
+	if _, err := Run(strings.NewReader("/abc\n"), "x"); err == nil {
+		t.Error("unterminated pattern")
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	// Invalid UTF-8 is reported with details which are not available.
+	report, err := Run(strings.NewReader("/a/8\n    \xffa\nError -10 (bad UTF-8 string) offset=0 reason=20\n"), "x")
+	if err != nil || report.Skipped != 1 || len(report.Failures) != 0 {
+		t.Error(report, err)
+	}
+	out, reason := run(pcre.MustCompile("a", 0), &pattern{}, []byte("a"), 1<<30)
+	if !equal(out, []string{"Error -3 (bad option value)"}) || reason != "" {
+		t.Error(out, reason)
+	}
+	out, _ = run(pcre.MustCompile("a", 0), &pattern{rest: true}, []byte("xab"), 0)
+	if !equal(out, []string{" 0: a", " 0+ b"}) {
+		t.Error(out)
+	}
+}
+
+func TestParseSubject(t *testing.T) {
+	b, flags, reason := parsesubject(`a\x41\x{e9}\101\N\N\B`, true)
+	if string(b) != "aAéA" || reason != "" {
+		t.Errorf("%q %s", b, reason)
+	}
+	if flags != pcre.NOTEMPTY_ATSTART|pcre.NOTBOL {
+		t.Errorf("flags %#x", flags)
+	}
+	if _, _, reason = parsesubject(`\x{100}`, false); reason == "" {
+		t.Error("\\x{100} without UTF8")
+	}
+	if _, _, reason = parsesubject(`abc\>2`, false); reason == "" {
+		t.Error("\\> accepted")
+	}
+}
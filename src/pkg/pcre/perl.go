@@ -0,0 +1,157 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package pcre
+
+import (
+	"strings"
+)
+
+// Closing delimiters for the bracketing opening delimiters.
+var brackets = map[byte]byte{'(': ')', '[': ']', '{': '}', '<': '>'}
+
+// Delimiters which have a meaning in the pattern, so that escaping
+// them keeps the backslash.
+const metachars = "\\^$.|?*+()[]{}#"
+
+// A Perl-style pattern literal split into its parts.  The offsets
+// map every byte of the pattern (and the end of it) to its position
+// in the literal.
+type literal struct {
+	pattern string
+	offsets []int
+	end     int // position after the closing delimiter
+}
+
+// Scan the delimited part of a Perl-style literal starting at
+// position i, which must be at the opening delimiter.  For s/// and
+// tr///, the replacement part is scanned with another call.
+func scandelimited(s string, i int) (lit literal, err *CompileError) {
+	if i >= len(s) {
+		return lit, &CompileError{Pattern: s, Message: "missing delimiter", Offset: i}
+	}
+	open := s[i]
+	if isalnum(open) || open == '\\' || strings.IndexByte(" \t\n\r\f\v", open) >= 0 {
+		return lit, &CompileError{Pattern: s, Message: "invalid delimiter", Offset: i}
+	}
+	close, nesting := brackets[open]
+	if !nesting {
+		close = open
+	}
+	keep := strings.IndexByte(metachars, open) >= 0
+	var b []byte
+	depth := 0
+	for i++; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			if next := s[i+1]; (next != open && next != close) || keep {
+				b = append(b, c)
+				lit.offsets = append(lit.offsets, i)
+			}
+			i++
+			c = s[i]
+		case nesting && c == open:
+			depth++
+		case c == close && depth > 0:
+			depth--
+		case c == close:
+			lit.pattern = string(b)
+			lit.offsets = append(lit.offsets, i)
+			lit.end = i + 1
+			return lit, nil
+		}
+		b = append(b, c)
+		lit.offsets = append(lit.offsets, i)
+	}
+	return lit, &CompileError{
+		Pattern: s,
+		Message: "missing terminating " + string(close),
+		Offset:  len(s),
+	}
+}
+
+// Parse a literal in one of the forms /pattern/flags, m/pattern/flags
+// or qr/pattern/flags.  After m and qr, any punctuation character can
+// be used as the delimiter, and the bracketing characters ( [ { < are
+// closed by their counterpart and may nest.
+func parseliteral(s string) (lit literal, flags int, err *CompileError) {
+	i := 0
+	switch {
+	case strings.HasPrefix(s, "m") && len(s) > 1 && !isalnum(s[1]):
+		i = 1
+	case strings.HasPrefix(s, "qr") && len(s) > 2 && !isalnum(s[2]):
+		i = 2
+	case strings.HasPrefix(s, "/"):
+	default:
+		return lit, 0, &CompileError{Pattern: s, Message: "not a pattern literal"}
+	}
+	if lit, err = scandelimited(s, i); err != nil {
+		return
+	}
+	flags, j, ferr := modifierflags(s[lit.end:])
+	if ferr != nil {
+		err = &CompileError{Pattern: s, Message: ferr.Error(), Offset: lit.end + j}
+	}
+	return
+}
+
+// Splits a Perl-style pattern literal such as "/^(\d+)\s/msix" or
+// "m{...}i" into the pattern and its flags.  The modifier letters are
+// those of MarshalText.  Errors are reported with their offset in the
+// literal.
+func ParsePerlPattern(literal string) (pattern string, flags int, err *CompileError) {
+	lit, flags, err := parseliteral(literal)
+	return lit.pattern, flags, err
+}
+
+// Compile a Perl-style pattern literal, as accepted by
+// ParsePerlPattern.  Compilation errors are reported with their
+// offset in the literal.
+func CompileLiteral(literal string) (Regexp, *CompileError) {
+	return compileliteral(literal, EnginePCRE)
+}
+
+func compileliteral(literal string, engine Engine) (Regexp, *CompileError) {
+	lit, flags, err := parseliteral(literal)
+	if err != nil {
+		return Regexp{}, err
+	}
+	re, err := CompileEngine(lit.pattern, flags, engine)
+	if err != nil {
+		err.Pattern = literal
+		err.Offset = lit.offsets[err.Offset]
+	}
+	return re, err
+}
+
+// Compile a Perl-style pattern literal.  If compilation fails, panic.
+func MustCompileLiteral(literal string) (re Regexp) {
+	re, err := CompileLiteral(literal)
+	if err != nil {
+		panic(err)
+	}
+	return
+}
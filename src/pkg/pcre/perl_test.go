@@ -0,0 +1,68 @@
+package pcre
+
+import (
+	"testing"
+)
+
+func TestParsePerlPattern(t *testing.T) {
+	check := func(literal, pattern string, flags int) {
+		p, f, err := ParsePerlPattern(literal)
+		if err != nil {
+			t.Error(literal, err)
+			return
+		}
+		if p != pattern || f != flags {
+			t.Errorf("%s: %q %#x", literal, p, f)
+		}
+	}
+	check(`/^(\d+)\s/msix`, `^(\d+)\s`, MULTILINE|DOTALL|CASELESS|EXTENDED)
+	check(`//`, ``, 0)
+	check(`/a\/b/`, `a/b`, 0)
+	check(`/a\\/`, `a\\`, 0)
+	check(`m{a{2}b}i`, `a{2}b`, CASELESS)
+	check(`m{a\}b}`, `a\}b`, 0)
+	check(`m(a(b)c)U`, `a(b)c`, UNGREEDY)
+	check(`m<x>u`, `x`, UTF8)
+	check(`m!a\!b!`, `a!b`, 0)
+	check(`m#a\#b#x`, `a\#b`, EXTENDED)
+	check(`qr/x/n`, `x`, NO_AUTO_CAPTURE)
+}
+
+func TestParsePerlPatternFail(t *testing.T) {
+	check := func(literal, msg string, off int) {
+		_, _, err := ParsePerlPattern(literal)
+		switch {
+		case err == nil:
+			t.Error(literal)
+		case err.Message != msg:
+			t.Error(literal, "Message", err.Message)
+		case err.Offset != off:
+			t.Error(literal, "Offset", err.Offset)
+		}
+	}
+	check(``, "not a pattern literal", 0)
+	check(`abc`, "not a pattern literal", 0)
+	check(`/abc`, "missing terminating /", 4)
+	check(`m{a{b}`, "missing terminating }", 6)
+	check(`/abc/ig`, `unknown modifier 'g'`, 6)
+	check(`m abc `, "invalid delimiter", 1)
+}
+
+func TestCompileLiteral(t *testing.T) {
+	m, err := MustCompileLiteral(`m{^(?<n>\d+)/(\w+)$}i`).MatcherString("12/ABC", 0)
+	if err != nil {
+		t.Error(err)
+	}
+	if !m.Matches() || m.NamedString("n") != "12" || m.GroupString(2) != "ABC" {
+		t.Error("CompileLiteral")
+	}
+	_, cerr := CompileLiteral(`/a\/b(/`)
+	switch {
+	case cerr == nil:
+		t.Error("missing )")
+	case cerr.Pattern != `/a\/b(/`:
+		t.Error("Pattern", cerr.Pattern)
+	case cerr.Offset != 6:
+		t.Error("Offset", cerr.Offset)
+	}
+}
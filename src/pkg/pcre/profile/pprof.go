@@ -0,0 +1,223 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre/syntax"
+	"io"
+	"sort"
+	"time"
+)
+
+// A protocol buffer message, written field by field.
+type message struct {
+	bytes.Buffer
+}
+
+func (m *message) varint(x uint64) {
+	for x >= 0x80 {
+		m.WriteByte(byte(x) | 0x80)
+		x >>= 7
+	}
+	m.WriteByte(byte(x))
+}
+
+func (m *message) int(field int, x int64) {
+	if x != 0 {
+		m.varint(uint64(field) << 3)
+		m.varint(uint64(x))
+	}
+}
+
+func (m *message) bytes(field int, b []byte) {
+	m.varint(uint64(field)<<3 | 2)
+	m.varint(uint64(len(b)))
+	m.Write(b)
+}
+
+func (m *message) packed(field int, xs []int64) {
+	var p message
+	for _, x := range xs {
+		p.varint(uint64(x))
+	}
+	m.bytes(field, p.Bytes())
+}
+
+// Field numbers of profile.proto in github.com/google/pprof.
+const (
+	profileSampleType    = 1
+	profileSample        = 2
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileTimeNanos     = 9
+	profileDurationNanos = 10
+	profileDefaultSample = 14
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID       = 1
+	functionName     = 2
+	functionFilename = 4
+)
+
+// A pprof profile under construction.
+type pprof struct {
+	message
+	strings   map[string]int64
+	locations map[syntax.Span]int64
+	p         *Profile
+}
+
+func (w *pprof) string(s string) int64 {
+	if i, ok := w.strings[s]; ok {
+		return i
+	}
+	i := int64(len(w.strings))
+	w.strings[s] = i
+	return i
+}
+
+// Returns the location of the part of the pattern at span, as a
+// function named after the part and its offset.  The line number is
+// the offset plus one.
+func (w *pprof) location(span syntax.Span, name string) int64 {
+	if id, ok := w.locations[span]; ok {
+		return id
+	}
+	id := int64(len(w.locations) + 1)
+	w.locations[span] = id
+	var f, l, line message
+	f.int(functionID, id)
+	f.int(functionName, w.string(fmt.Sprintf("%s @%d", name, span.Start)))
+	f.int(functionFilename, w.string(w.p.Pattern))
+	w.bytes(profileFunction, f.Bytes())
+	line.int(lineFunctionID, id)
+	line.int(lineLine, int64(span.Start+1))
+	l.int(locationID, id)
+	l.bytes(locationLine, line.Bytes())
+	w.bytes(profileLocation, l.Bytes())
+	return id
+}
+
+// Returns the nodes of the syntax tree which enclose span, innermost
+// first: groups, conditionals and repeats.
+func (p *Profile) enclosing(span syntax.Span) []syntax.Node {
+	var nodes []syntax.Node
+	if p.re == nil {
+		return nil
+	}
+	syntax.Walk(p.re.Root, func(n syntax.Node) bool {
+		s := n.Span()
+		if s.Start > span.Start || s.End < span.End {
+			return false
+		}
+		switch n.(type) {
+		case *syntax.Group, *syntax.Conditional, *syntax.Repeat:
+			if s != span {
+				nodes = append(nodes, n)
+			}
+		}
+		return true
+	})
+	for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+		nodes[i], nodes[j] = nodes[j], nodes[i]
+	}
+	return nodes
+}
+
+// Writes the profile in the gzipped protocol buffer format of pprof,
+// with the sample types steps and backtracks.  Each item is a function
+// called from the groups and repeats which enclose it, and those from
+// a function for the whole pattern, so that the cumulative counts of
+// a group cover its contents.
+func (p *Profile) WriteProfile(out io.Writer) error {
+	w := &pprof{
+		strings:   map[string]int64{"": 0},
+		locations: make(map[syntax.Span]int64),
+		p:         p,
+	}
+	for _, t := range []string{"steps", "backtracks"} {
+		var vt message
+		vt.int(valueTypeType, w.string(t))
+		vt.int(valueTypeUnit, w.string("count"))
+		w.bytes(profileSampleType, vt.Bytes())
+	}
+	root := syntax.Span{Start: 0, End: len(p.Pattern)}
+	var offsets []int
+	for offset := range p.items {
+		offsets = append(offsets, offset)
+	}
+	sort.Ints(offsets)
+	for _, offset := range offsets {
+		r := p.region(offset)
+		if r.Cost() == 0 {
+			continue
+		}
+		stack := []int64{w.location(r.Span, r.Text)}
+		for _, n := range p.enclosing(r.Span) {
+			s := n.Span()
+			if s != root {
+				stack = append(stack, w.location(s, p.Pattern[s.Start:s.End]))
+			}
+		}
+		if r.Span != root {
+			stack = append(stack, w.location(root, p.Pattern))
+		}
+		var s message
+		s.packed(sampleLocationID, stack)
+		s.packed(sampleValue, []int64{int64(r.Cost()), int64(r.Backtracked)})
+		w.bytes(profileSample, s.Bytes())
+	}
+	table := make([]string, len(w.strings))
+	for s, i := range w.strings {
+		table[i] = s
+	}
+	for _, s := range table {
+		w.bytes(profileStringTable, []byte(s))
+	}
+	w.int(profileTimeNanos, time.Now().UnixNano())
+	w.int(profileDurationNanos, int64(p.Duration))
+	w.int(profileDefaultSample, w.strings["steps"])
+	z := gzip.NewWriter(out)
+	if _, err := z.Write(w.Bytes()); err != nil {
+		return err
+	}
+	return z.Close()
+}
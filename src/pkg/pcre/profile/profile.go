@@ -0,0 +1,223 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package profile measures where a pattern spends its matching work.
+//
+// Run matches a pattern against a corpus with Matcher.Trace and counts,
+// for each offset in the pattern, how often the item there was entered
+// and how often matching backtracked to it.  The result can be shown
+// as a heatmap under the pattern, as a list of hotspots, or written as
+// a pprof profile in which the enclosing groups of an item are its
+// callers.
+package profile
+
+import (
+	"fmt"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre/syntax"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+)
+
+// The counts collected by Run.  Entered and Backtracked are indexed by
+// the offset of an item in the pattern; the end of the pattern has the
+// offset len(Pattern).
+type Profile struct {
+	Pattern     string
+	Flags       int           // compile flags
+	Subjects    int           // subjects matched against
+	Matched     int           // subjects which matched
+	Truncated   int           // subjects with more than pcre.MaxTraceSteps steps
+	Steps       int           // steps of all subjects
+	Duration    time.Duration // time spent matching, including tracing
+	Entered     []int
+	Backtracked []int
+	items       map[int]int    // offset to length of the item there
+	re          *syntax.Regexp // nil if the pattern cannot be parsed
+}
+
+// Matches re against each subject of the corpus with the exec flags
+// and returns the counts of all matches.
+func Run(re pcre.Regexp, corpus []string, flags int) (*Profile, error) {
+	pattern := re.String()
+	p := &Profile{
+		Pattern:     pattern,
+		Flags:       re.Flags(),
+		Entered:     make([]int, len(pattern)+1),
+		Backtracked: make([]int, len(pattern)+1),
+		items:       make(map[int]int),
+	}
+	p.re, _ = syntax.Parse(pattern, p.Flags)
+	// Compile the instrumented pattern once, rather than once per
+	// subject as TraceString would, so that Duration is spent matching.
+	auto, cerr := pcre.Compile(pattern, p.Flags|pcre.AUTO_CALLOUT)
+	if cerr != nil {
+		return nil, cerr
+	}
+	m, err := auto.MatcherString("", 0)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	for _, subject := range corpus {
+		t, err := m.TraceCalloutsString(subject, flags)
+		if err != nil {
+			return nil, err
+		}
+		p.add(t)
+	}
+	p.Duration = time.Since(start)
+	return p, nil
+}
+
+func (p *Profile) add(t *pcre.Trace) {
+	p.Subjects++
+	if t.Match != nil {
+		p.Matched++
+	}
+	if t.Truncated {
+		p.Truncated++
+	}
+	for _, s := range t.Steps {
+		if s.Callout != 255 || s.Pattern < 0 || s.Pattern > len(p.Pattern) {
+			// Explicit callouts do not start an item.
+			continue
+		}
+		p.Steps++
+		p.items[s.Pattern] = s.Length
+		if s.Backtrack {
+			p.Backtracked[s.Pattern]++
+		} else {
+			p.Entered[s.Pattern]++
+		}
+	}
+}
+
+// The counts of an item of the pattern.
+type Region struct {
+	Span        syntax.Span
+	Text        string // the item, or "(end)" for the end of the pattern
+	Entered     int
+	Backtracked int
+}
+
+// Returns the number of steps at the item.
+func (r Region) Cost() int {
+	return r.Entered + r.Backtracked
+}
+
+func (p *Profile) region(offset int) Region {
+	r := Region{
+		Span:        syntax.Span{Start: offset, End: offset + p.items[offset]},
+		Entered:     p.Entered[offset],
+		Backtracked: p.Backtracked[offset],
+	}
+	r.Text = p.Pattern[r.Span.Start:r.Span.End]
+	if r.Text == "" {
+		r.Text = "(end)"
+	}
+	return r
+}
+
+// Returns the n items with the most steps, most expensive first.  It
+// returns all items which were reached if n is not positive.
+func (p *Profile) Hotspots(n int) []Region {
+	var regions []Region
+	for offset := range p.items {
+		if r := p.region(offset); r.Cost() > 0 {
+			regions = append(regions, r)
+		}
+	}
+	sort.Slice(regions, func(i, j int) bool {
+		if regions[i].Cost() != regions[j].Cost() {
+			return regions[i].Cost() > regions[j].Cost()
+		}
+		return regions[i].Span.Start < regions[j].Span.Start
+	})
+	if n > 0 && len(regions) > n {
+		regions = regions[:n]
+	}
+	return regions
+}
+
+// Shades from no steps to the most steps of any item.
+const shades = " .:-=+*#%@"
+
+// Returns the pattern on one line and, below it, a line which shades
+// each character by the steps of the item it belongs to.  Control
+// characters in the pattern are shown as spaces.
+func (p *Profile) Heatmap() string {
+	max := 0
+	for offset := range p.items {
+		if c := p.region(offset).Cost(); c > max {
+			max = c
+		}
+	}
+	heat := make([]byte, len(p.Pattern))
+	for i := range heat {
+		heat[i] = ' '
+	}
+	for offset, length := range p.items {
+		c := p.region(offset).Cost()
+		if c == 0 {
+			continue
+		}
+		shade := shades[1+c*(len(shades)-2)/max]
+		for i := offset; i < offset+length; i++ {
+			heat[i] = shade
+		}
+	}
+	var pattern, shading strings.Builder
+	for i, r := range p.Pattern {
+		if r < ' ' || r == 0x7f || r == utf8.RuneError {
+			r = ' '
+		}
+		pattern.WriteRune(r)
+		shading.WriteByte(heat[i])
+	}
+	return pattern.String() + "\n" + shading.String() + "\n"
+}
+
+// Returns a summary, the heatmap and the ten items with the most
+// steps.
+func (p *Profile) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d subjects, %d matched, %d steps in %v", p.Subjects, p.Matched, p.Steps, p.Duration)
+	if p.Truncated > 0 {
+		fmt.Fprintf(&b, ", %d truncated", p.Truncated)
+	}
+	b.WriteString("\n\n" + p.Heatmap() + "\n")
+	w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "steps\t%\tentered\tbacktracked\toffset\t item")
+	for _, r := range p.Hotspots(10) {
+		fmt.Fprintf(w, "%d\t%.1f%%\t%d\t%d\t%d-%d\t %s\n", r.Cost(), 100*float64(r.Cost())/float64(p.Steps),
+			r.Entered, r.Backtracked, r.Span.Start, r.Span.End, r.Text)
+	}
+	w.Flush()
+	return b.String()
+}
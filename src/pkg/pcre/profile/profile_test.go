@@ -0,0 +1,98 @@
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	p, err := Run(pcre.MustCompile(`^(a+)+$`, 0), []string{"aaaa", "aaaa!", "b"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Subjects != 3 || p.Matched != 1 || p.Truncated != 0 || p.Steps == 0 {
+		t.Error(p)
+	}
+	entered, backtracked := 0, 0
+	for i := range p.Entered {
+		entered += p.Entered[i]
+		backtracked += p.Backtracked[i]
+	}
+	if entered+backtracked != p.Steps || backtracked == 0 {
+		t.Error(entered, backtracked, p.Steps)
+	}
+	// The same steps as tracing each subject on its own.
+	m, _ := pcre.MustCompile(`^(a+)+$`, 0).MatcherString("", 0)
+	steps := 0
+	for _, subject := range []string{"aaaa", "aaaa!", "b"} {
+		tr, _ := m.TraceString(subject, 0)
+		steps += len(tr.Steps)
+	}
+	if steps != p.Steps {
+		t.Error("TraceString", steps, p.Steps)
+	}
+	hot := p.Hotspots(0)
+	if len(hot) == 0 || hot[0].Text != "a+" || hot[0].Span.Start != 2 {
+		t.Error(hot)
+	}
+	for i := 1; i < len(hot); i++ {
+		if hot[i].Cost() > hot[i-1].Cost() {
+			t.Error(hot)
+		}
+	}
+	if len(p.Hotspots(2)) != 2 {
+		t.Error(p.Hotspots(2))
+	}
+	if h := p.Heatmap(); !strings.HasPrefix(h, "^(a+)+$\n..@@") {
+		t.Errorf("%q", h)
+	}
+	if s := p.String(); !strings.HasPrefix(s, "3 subjects, 1 matched, ") || !strings.Contains(s, "2-4 a+\n") {
+		t.Error(s)
+	}
+}
+
+func TestRunTruncated(t *testing.T) {
+	defer func(n int) { pcre.MaxTraceSteps = n }(pcre.MaxTraceSteps)
+	pcre.MaxTraceSteps = 5
+	p, _ := Run(pcre.MustCompile(`(?:a|b)*\d`, 0), []string{"ababababab"}, 0)
+	if p.Truncated != 1 || p.Steps != 5 || !strings.Contains(p.String(), ", 1 truncated") {
+		t.Error(p)
+	}
+}
+
+func TestWriteProfile(t *testing.T) {
+	p, _ := Run(pcre.MustCompile(`x(a|b)+y`, 0), []string{"xababz y"}, 0)
+	var b bytes.Buffer
+	if err := p.WriteProfile(&b); err != nil {
+		t.Fatal(err)
+	}
+	z, err := gzip.NewReader(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(z)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The string table holds the sample types, the items and the
+	// groups enclosing them.
+	for _, s := range []string{"steps", "backtracks", "count", "a @2", "(a|b) @1", "(a|b)+ @1", "x(a|b)+y @0"} {
+		if !bytes.Contains(data, []byte(s)) {
+			t.Errorf("%q: no %q", data, s)
+		}
+	}
+}
+
+func TestMessage(t *testing.T) {
+	var m message
+	m.int(1, 150)
+	m.int(2, 0)
+	m.packed(3, []int64{1, 300})
+	if want := []byte{0x08, 0x96, 0x01, 0x1a, 0x03, 0x01, 0xac, 0x02}; !bytes.Equal(m.Bytes(), want) {
+		t.Errorf("% x", m.Bytes())
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package pcre
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Characters which PCRE treats as white space in EXTENDED mode
+// together with UTF8, besides the ASCII ones.  Without UTF8, the byte
+// 0x85 is white space, even within a multibyte character.
+var utf8spaces = []rune{'\u0085', '\u200e', '\u200f', '\u2028', '\u2029'}
+
+// Returns a pattern which matches s literally, whatever the compile
+// flags.  ASCII punctuation and spaces are escaped with a backslash,
+// so they are literal in EXTENDED mode too; NUL and other control
+// characters are written as \xhh, since a pattern cannot contain NUL.
+// Characters which may be white space in EXTENDED mode outside ASCII
+// are put between \Q and \E.  The result can be used in character
+// classes as well, but not between \Q and \E.
+func QuoteMeta(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case isalnum(c) || c == '_':
+			b.WriteByte(c)
+		case c < ' ' || c == 0x7f:
+			b.WriteString(`\x`)
+			if c < 0x10 {
+				b.WriteByte('0')
+			}
+			b.WriteString(strconv.FormatInt(int64(c), 16))
+		case c < utf8.RuneSelf:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if isutf8space(r) || strings.IndexByte(s[i:i+size], 0x85) >= 0 {
+				b.WriteString(`\Q` + s[i:i+size] + `\E`)
+			} else {
+				b.WriteString(s[i : i+size])
+			}
+			i += size
+			continue
+		}
+		i++
+	}
+	return b.String()
+}
+
+func isutf8space(r rune) bool {
+	for _, space := range utf8spaces {
+		if r == space {
+			return true
+		}
+	}
+	return false
+}
+
+// A value for CompileTemplate which is inserted into the pattern
+// without escaping.
+type Raw string
+
+// Where in a pattern a template placeholder is.
+type templatecontext int
+
+const (
+	contextLiteral templatecontext = iota
+	contextClass                   // in a character class
+	contextQuoted                  // between \Q and \E
+	contextComment                 // in (?#...) or an EXTENDED comment
+)
+
+// Replaces the {{name}} placeholders in template with the values in
+// vars.  Strings and byte slices are escaped so that they match
+// literally, in a way which depends on where the placeholder is: with
+// QuoteMeta in general, and by leaving and reentering the quoting
+// between \Q and \E.  Values of type Raw are inserted unchanged.
+// Placeholders in comments are rejected, because a value could end
+// the comment.  "\{" prevents a placeholder.  Whether EXTENDED is in
+// effect is taken from flags and from inline (?x) and (?-x) options,
+// regardless of the group they appear in.
+func ExpandTemplate(template string, flags int, vars map[string]interface{}) (string, *CompileError) {
+	var b strings.Builder
+	fail := func(offset int, message string) (string, *CompileError) {
+		return "", &CompileError{Pattern: template, Message: message, Offset: offset}
+	}
+	extended := flags&EXTENDED != 0
+	context := contextLiteral
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		if strings.HasPrefix(template[i:], "{{") {
+			end := strings.Index(template[i:], "}}")
+			if end < 0 {
+				return fail(i, "unterminated placeholder")
+			}
+			name := strings.TrimSpace(template[i+2 : i+end])
+			value, ok := vars[name]
+			if !ok {
+				return fail(i, "no value for placeholder "+strconv.Quote(name))
+			}
+			var s string
+			switch v := value.(type) {
+			case Raw:
+				b.WriteString(string(v))
+				i += end + 1
+				continue
+			case string:
+				s = v
+			case []byte:
+				s = string(v)
+			default:
+				return fail(i, "placeholder "+strconv.Quote(name)+" needs a string, []byte or Raw value")
+			}
+			switch context {
+			case contextComment:
+				return fail(i, "placeholder "+strconv.Quote(name)+" in a comment")
+			case contextQuoted:
+				if s != "" {
+					b.WriteString(`\E` + QuoteMeta(s) + `\Q`)
+				}
+			default:
+				b.WriteString(QuoteMeta(s))
+			}
+			i += end + 1
+			continue
+		}
+		b.WriteByte(c)
+		switch context {
+		case contextQuoted:
+			if strings.HasPrefix(template[i:], `\E`) {
+				b.WriteByte('E')
+				i++
+				context = contextLiteral
+			}
+		case contextComment:
+			if c == '\n' {
+				context = contextLiteral
+			}
+		case contextClass:
+			switch {
+			case c == '\\' && i+1 < len(template):
+				i++
+				b.WriteByte(template[i])
+			case c == '[' && strings.HasPrefix(template[i:], "[:"):
+				if end := strings.Index(template[i:], ":]"); end >= 0 {
+					b.WriteString(template[i+1 : i+end+2])
+					i += end + 1
+				}
+			case c == ']':
+				context = contextLiteral
+			}
+		default:
+			switch {
+			case c == '\\' && strings.HasPrefix(template[i:], `\Q`):
+				b.WriteByte('Q')
+				i++
+				context = contextQuoted
+			case c == '\\' && i+1 < len(template):
+				i++
+				b.WriteByte(template[i])
+			case c == '[':
+				context = contextClass
+				// A ] right after [ or [^ is a literal.
+				if strings.HasPrefix(template[i+1:], "^") {
+					i++
+					b.WriteByte('^')
+				}
+				if strings.HasPrefix(template[i+1:], "]") {
+					i++
+					b.WriteByte(']')
+				}
+			case c == '#' && extended:
+				context = contextComment
+			case strings.HasPrefix(template[i:], "(?#"):
+				b.WriteString("?#")
+				i += 2
+				// A comment always ends at the next ), even in
+				// EXTENDED mode.
+				for i+1 < len(template) && template[i+1] != ')' {
+					if strings.HasPrefix(template[i+1:], "{{") {
+						return fail(i+1, "placeholder in a comment")
+					}
+					i++
+					b.WriteByte(template[i])
+				}
+			case strings.HasPrefix(template[i:], "(?"):
+				// Inline options such as (?x), (?i-x) or (?x:...).
+				on := true
+				for j := i + 2; j < len(template) && strings.IndexByte("imsxJUX-", template[j]) >= 0; j++ {
+					switch template[j] {
+					case '-':
+						on = false
+					case 'x':
+						extended = on
+					}
+				}
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+// Expands the template with ExpandTemplate and compiles the result.
+// Errors in the template are reported with their offset in the
+// template; compilation errors refer to the expanded pattern.
+func CompileTemplate(template string, flags int, vars map[string]interface{}) (Regexp, *CompileError) {
+	pattern, err := ExpandTemplate(template, flags, vars)
+	if err != nil {
+		return Regexp{}, err
+	}
+	return Compile(pattern, flags)
+}
+
+// Compiles the template with the values in vars.  If expansion or
+// compilation fails, panic.
+func MustCompileTemplate(template string, flags int, vars map[string]interface{}) (re Regexp) {
+	re, err := CompileTemplate(template, flags, vars)
+	if err != nil {
+		panic(err)
+	}
+	return
+}
@@ -0,0 +1,93 @@
+package pcre
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQuoteMeta(t *testing.T) {
+	var all []byte
+	for c := 0; c < 256; c++ {
+		all = append(all, byte(c))
+	}
+	check := func(s string, flags int) {
+		for _, p := range []string{"^" + QuoteMeta(s) + "$", "^[" + QuoteMeta(s) + "]+$"} {
+			re, err := Compile(p, flags)
+			if err != nil {
+				t.Error(flags, p, err)
+				continue
+			}
+			m, _ := re.MatcherString(s, 0)
+			if !m.Matches() {
+				t.Errorf("%#x %q does not match %q", flags, p, s)
+			}
+		}
+	}
+	for _, flags := range []int{0, EXTENDED, CASELESS | EXTENDED} {
+		check(string(all), flags)
+		check("héllo wörld # \u0085\u200e\u2029 х", flags)
+	}
+	for _, flags := range []int{UTF8, UTF8 | EXTENDED} {
+		check(string(all[:128]), flags)
+		check("héllo wörld # \u0085\u200e\u200f\u2028\u2029 х \\E x", flags)
+	}
+	if q := QuoteMeta("a.b\x00c d\u2028"); q != `a\.b\x00c\ d\Q`+"\u2028"+`\E` {
+		t.Error("QuoteMeta", q)
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	vars := map[string]interface{}{
+		"host": "a.b (c)",
+		"path": []byte(`x\E.*`),
+		"num":  Raw(`\d+`),
+		"hash": "#x\ny",
+	}
+	check := func(template string, flags int, want string) {
+		got, err := ExpandTemplate(template, flags, vars)
+		if err != nil {
+			t.Error(template, err)
+		} else if got != want {
+			t.Errorf("%q: got %q, want %q", template, got, want)
+		}
+	}
+	check(`^{{host}}:(\d+)$`, 0, `^a\.b\ \(c\):(\d+)$`)
+	check(`^{{ host }}`, 0, `^a\.b\ \(c\)`)
+	check(`[{{path}}]`, 0, `[x\\E\.\*]`)
+	check(`\Q{{path}}/\E`, 0, `\Q\Ex\\E\.\*\Q/\E`)
+	check(`{{num}}`, 0, `\d+`)
+	check(`\{{num}}`, 0, `\{{num}}`)
+	check("{{hash}}", EXTENDED, `\#x\x0ay`)
+	check("# comment\n{{hash}}", EXTENDED, "# comment\n"+`\#x\x0ay`)
+
+	fail := func(template string, flags int, msg string, offset int) {
+		_, err := ExpandTemplate(template, flags, vars)
+		switch {
+		case err == nil:
+			t.Error(template)
+		case !strings.Contains(err.Message, msg):
+			t.Error(template, "Message", err.Message)
+		case err.Offset != offset:
+			t.Error(template, "Offset", err.Offset)
+		}
+	}
+	fail(`a{{host`, 0, "unterminated placeholder", 1)
+	fail(`a{{user}}`, 0, `no value for placeholder "user"`, 1)
+	fail(`a # {{hash}}`, EXTENDED, "in a comment", 4)
+	fail(`(?x)a # {{hash}}`, 0, "in a comment", 8)
+	fail(`a(?#{{hash}})`, 0, "in a comment", 4)
+	vars["n"] = 1
+	fail(`{{n}}`, 0, "needs a string", 0)
+}
+
+func TestCompileTemplate(t *testing.T) {
+	re := MustCompileTemplate(`^{{host}}:(\d+)$`, EXTENDED, map[string]interface{}{"host": "my host.example"})
+	m, _ := re.MatcherString("my host.example:80", 0)
+	if !m.Matches() || m.GroupString(1) != "80" {
+		t.Error("CompileTemplate")
+	}
+	m, _ = re.MatcherString("my hostXexample:80", 0)
+	if m.Matches() {
+		t.Error("CompileTemplate: . not escaped")
+	}
+}
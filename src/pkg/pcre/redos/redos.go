@@ -0,0 +1,518 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package redos finds patterns which are prone to catastrophic
+// backtracking.
+//
+// Analyze looks for the constructs which make a backtracking matcher
+// take exponential or polynomial time on a failing subject: nested
+// quantifiers which can split the same text in many ways, alternatives
+// which can match the same text under a repetition, and adjacent
+// quantifiers over overlapping characters.  Each finding comes with an
+// attack string, and Confirm runs it against the library's match
+// limits.
+package redos
+
+import (
+	"fmt"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre/syntax"
+	"strings"
+	"unicode/utf8"
+)
+
+// How the matching time grows with the length of the attack string.
+type Severity int
+
+const (
+	Polynomial Severity = iota + 1
+	Exponential
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Polynomial:
+		return "polynomial"
+	case Exponential:
+		return "exponential"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// A construct which can cause catastrophic backtracking.
+type Finding struct {
+	Severity Severity
+	Message  string
+	Span     syntax.Span // the repetition which backtracks
+	Inner    syntax.Span // the part which matches ambiguously
+	// The attack string is Prefix, then Pump repeated, then
+	// Suffix, which is meant to make the match fail.
+	Prefix, Pump, Suffix string
+}
+
+// Returns the attack string with n repetitions of the pump.
+func (f *Finding) Attack(n int) string {
+	return f.Prefix + strings.Repeat(f.Pump, n) + f.Suffix
+}
+
+func (f *Finding) String() string {
+	return fmt.Sprintf("%s: %s at %d-%d: %q + %q * n + %q",
+		f.Severity, f.Message, f.Span.Start, f.Span.End,
+		f.Prefix, f.Pump, f.Suffix)
+}
+
+// Matches the attack string against re with growing n, up to maxlen
+// bytes, and returns true if the library's match or recursion limit
+// is hit (see pcre.Config for their values).  Depending on the
+// library version, the backtracking caused by polynomial findings may
+// not count towards the limits.
+func (f *Finding) Confirm(re pcre.Regexp, maxlen int) (bool, error) {
+	m, err := re.MatcherString("", 0)
+	if err != nil {
+		return false, err
+	}
+	for n := 8; len(f.Attack(n)) <= maxlen; n *= 2 {
+		_, err := m.MatchString(f.Attack(n), 0)
+		switch err {
+		case nil:
+		case pcre.PCRE_ERROR_MATCHLIMIT, pcre.PCRE_ERROR_RECURSIONLIMIT:
+			return true, nil
+		default:
+			return false, err
+		}
+		if len(f.Pump) == 0 {
+			break
+		}
+	}
+	return false, nil
+}
+
+const (
+	nested    = "nested quantifiers over overlapping text"
+	ambiguous = "ambiguous alternation under repetition"
+	adjacent  = "adjacent quantifiers over overlapping characters"
+)
+
+// Parses and analyzes the pattern.
+func Analyze(pattern string, flags int) ([]Finding, *pcre.CompileError) {
+	if _, err := pcre.Compile(pattern, flags); err != nil {
+		return nil, err
+	}
+	re, err := syntax.Parse(pattern, flags)
+	if err != nil {
+		return nil, err
+	}
+	return AnalyzeRegexp(re), nil
+}
+
+// Analyzes a parsed pattern.
+func AnalyzeRegexp(re *syntax.Regexp) []Finding {
+	a := &analyzer{re: re, cache: make(map[string]*pcre.Regexp)}
+	a.walk(re.Root, "", nil)
+	return a.findings
+}
+
+type analyzer struct {
+	re       *syntax.Regexp
+	cache    map[string]*pcre.Regexp // nil for patterns which fail
+	findings []Finding
+}
+
+// Visits n, with the sample text leading up to it and the nodes
+// which follow it up to the end of the pattern or of the enclosing
+// atomic group.
+func (a *analyzer) walk(n syntax.Node, prefix string, tail []syntax.Node) {
+	switch n := n.(type) {
+	case *syntax.Concat:
+		for i, item := range n.Items {
+			rest := append(append([]syntax.Node(nil), n.Items[i+1:]...), tail...)
+			a.adjacent(n.Items, i, prefix, tail)
+			a.walk(item, prefix, rest)
+			prefix += a.sample(item)
+		}
+	case *syntax.Alternation:
+		for _, alt := range n.Alts {
+			a.walk(alt, prefix, tail)
+		}
+	case *syntax.Group:
+		switch n.Kind {
+		case syntax.Atomic, syntax.Lookahead, syntax.NegativeLookahead,
+			syntax.Lookbehind, syntax.NegativeLookbehind:
+			// Backtracking does not enter the group from
+			// outside.
+			tail = nil
+		}
+		a.walk(n.Sub, prefix, tail)
+	case *syntax.Conditional:
+		if n.Assert != nil {
+			a.walk(n.Assert, prefix, nil)
+		}
+		a.walk(n.Yes, prefix, tail)
+		if n.No != nil {
+			a.walk(n.No, prefix, tail)
+		}
+	case *syntax.Repeat:
+		if n.Possessive {
+			tail = nil
+		} else {
+			a.repeat(n, prefix, tail)
+		}
+		a.walk(n.Sub, prefix, tail)
+	}
+}
+
+func unbounded(n syntax.Node) bool {
+	r, ok := n.(*syntax.Repeat)
+	return ok && r.Max < 0 && !r.Possessive
+}
+
+func (a *analyzer) add(f Finding) {
+	for _, g := range a.findings {
+		if g.Span == f.Span && g.Inner == f.Inner {
+			return
+		}
+	}
+	a.findings = append(a.findings, f)
+}
+
+// Checks for nested quantifiers and ambiguous alternatives under r.
+func (a *analyzer) repeat(r *syntax.Repeat, prefix string, tail []syntax.Node) {
+	if r.Max >= 0 || trivial(tail...) {
+		return
+	}
+	found := false
+	edges(r.Sub, func(n syntax.Node) {
+		if found {
+			return
+		}
+		f := Finding{Severity: Exponential, Span: r.Span(), Inner: n.Span(), Prefix: prefix}
+		switch n := n.(type) {
+		case *syntax.Repeat:
+			if n.Possessive || n.Max >= 0 && n.Max < 2 {
+				return
+			}
+			f.Message, f.Pump = nested, a.sample(n.Sub)
+		case *syntax.Alternation:
+			f.Message, f.Pump = ambiguous, a.overlap(n.Alts)
+		}
+		if f.Pump != "" {
+			f.Suffix = a.suffix(f.Pump, tail)
+			a.add(f)
+			found = true
+		}
+	})
+}
+
+// Returns a text which two of the alternatives can match, or "".
+func (a *analyzer) overlap(alts []syntax.Node) string {
+	for i, x := range alts {
+		for j, y := range alts {
+			if w := a.sample(y); i != j && w != "" && a.match(x, "+", w) {
+				return w
+			}
+		}
+	}
+	return ""
+}
+
+// Checks for an unbounded quantifier at items[i] which is followed by
+// another one over overlapping characters, with only optional items
+// in between.
+func (a *analyzer) adjacent(items []syntax.Node, i int, prefix string, tail []syntax.Node) {
+	if !unbounded(items[i]) {
+		return
+	}
+	x := items[i].(*syntax.Repeat)
+	for j := i + 1; j < len(items); j++ {
+		if unbounded(items[j]) {
+			y := items[j].(*syntax.Repeat)
+			pump := ""
+			if w := a.sample(y.Sub); w != "" && a.match(x.Sub, "+", w) {
+				pump = w
+			} else if w := a.sample(x.Sub); w != "" && a.match(y.Sub, "+", w) {
+				pump = w
+			}
+			rest := append(append([]syntax.Node(nil), items[j+1:]...), tail...)
+			if pump != "" && !trivial(rest...) {
+				a.add(Finding{
+					Severity: Polynomial,
+					Message:  adjacent,
+					Span:     x.Span(),
+					Inner:    y.Span(),
+					Prefix:   prefix + a.sample(items[i]),
+					Pump:     pump,
+					Suffix:   a.suffix(pump, rest),
+				})
+			}
+		}
+		if !trivial(items[j]) {
+			return
+		}
+	}
+}
+
+// Calls f for the repetitions and alternations in n which can start
+// and end a match of n, because everything else in n always matches
+// the empty string.
+func edges(n syntax.Node, f func(syntax.Node)) {
+	switch n := n.(type) {
+	case *syntax.Group:
+		switch n.Kind {
+		case syntax.Capture, syntax.NonCapture, syntax.BranchReset, syntax.OptionGroup:
+			edges(n.Sub, f)
+		}
+	case *syntax.Concat:
+		var required []syntax.Node
+		for _, item := range n.Items {
+			if !trivial(item) {
+				required = append(required, item)
+			}
+		}
+		switch len(required) {
+		case 0:
+			for _, item := range n.Items {
+				edges(item, f)
+			}
+		case 1:
+			edges(required[0], f)
+		}
+	case *syntax.Alternation:
+		f(n)
+		for _, alt := range n.Alts {
+			edges(alt, f)
+		}
+	case *syntax.Repeat:
+		f(n)
+	}
+}
+
+// Returns true if the nodes always match the empty string.
+func trivial(nodes ...syntax.Node) bool {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *syntax.Repeat:
+			if n.Min > 0 && !trivial(n.Sub) {
+				return false
+			}
+		case *syntax.Comment, *syntax.SetOptions, *syntax.Callout:
+		case *syntax.Verb:
+			if n.Name == "FAIL" || n.Name == "F" {
+				return false
+			}
+		case *syntax.Anchor:
+			if n.Kind != 'K' {
+				return false
+			}
+		case *syntax.Group:
+			switch n.Kind {
+			case syntax.Capture, syntax.NonCapture, syntax.BranchReset,
+				syntax.Atomic, syntax.OptionGroup:
+				if !trivial(n.Sub) {
+					return false
+				}
+			default:
+				return false
+			}
+		case *syntax.Concat:
+			if !trivial(n.Items...) {
+				return false
+			}
+		case *syntax.Alternation:
+			any := false
+			for _, alt := range n.Alts {
+				any = any || trivial(alt)
+			}
+			if !any {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the characters tried as samples and suffixes.  Without
+// UTF8, these are all bytes; with UTF8, the ASCII characters and a
+// few others.
+func (a *analyzer) universe(flags int) []string {
+	var u []string
+	if flags&pcre.UTF8 == 0 {
+		for c := 0; c < 256; c++ {
+			u = append(u, string([]byte{byte(c)}))
+		}
+		return u
+	}
+	for c := rune(0); c < utf8.RuneSelf; c++ {
+		u = append(u, string(c))
+	}
+	return append(u, "é", " ", "\u0085", " ", "中")
+}
+
+// The preferred sample characters, in order.
+const preferred = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// Compiles a pattern, remembering failures.
+func (a *analyzer) compile(pattern string, flags int) *pcre.Regexp {
+	key := fmt.Sprintf("%d/%s", flags, pattern)
+	re, ok := a.cache[key]
+	if !ok {
+		if c, err := pcre.Compile(pattern, flags); err == nil {
+			re = &c
+		}
+		a.cache[key] = re
+	}
+	return re
+}
+
+// Returns true if n, followed by the quantifier q, matches all of s.
+// References to groups outside n make it fail.
+func (a *analyzer) match(n syntax.Node, q, s string) bool {
+	re := a.compile(`\A(?:`+syntax.String(n)+`)`+q+`\z`, n.Flags())
+	if re == nil {
+		return false
+	}
+	m, err := re.MatcherString(s, 0)
+	return err == nil && m.Matches()
+}
+
+// Returns a short text which n matches, or "".
+func (a *analyzer) sample(n syntax.Node) string {
+	switch n := n.(type) {
+	case *syntax.Literal:
+		if n.Flags()&pcre.UTF8 == 0 {
+			return string([]byte{byte(n.Rune)})
+		}
+		return string(n.Rune)
+	case *syntax.Dot, *syntax.Class, *syntax.CharType:
+		for i := 0; i < len(preferred); i++ {
+			if s := preferred[i : i+1]; a.match(n, "", s) {
+				return s
+			}
+		}
+		for _, s := range a.universe(n.Flags()) {
+			if a.match(n, "", s) {
+				return s
+			}
+		}
+	case *syntax.Concat:
+		s := ""
+		for _, item := range n.Items {
+			s += a.sample(item)
+		}
+		return s
+	case *syntax.Alternation:
+		return a.sample(n.Alts[0])
+	case *syntax.Repeat:
+		return strings.Repeat(a.sample(n.Sub), n.Min)
+	case *syntax.Group:
+		switch n.Kind {
+		case syntax.Lookahead, syntax.NegativeLookahead,
+			syntax.Lookbehind, syntax.NegativeLookbehind:
+			return ""
+		}
+		return a.sample(n.Sub)
+	case *syntax.Backref:
+		if g := a.re.Group(n.Index); g != nil {
+			return a.sample(g.Sub)
+		}
+	case *syntax.Conditional:
+		if n.Cond != syntax.CondDefine {
+			return a.sample(n.Yes)
+		}
+	}
+	return ""
+}
+
+// Returns a character which can neither continue the pump nor start
+// the tail, to make the match fail after the pump, or "" if there is
+// none.
+func (a *analyzer) suffix(pump string, tail []syntax.Node) string {
+	flags := a.re.Flags
+	if len(tail) > 0 {
+		flags = tail[0].Flags()
+	}
+	candidates := append([]string{"!", "#", "\n", " ", "\x00", "~"}, a.universe(flags)...)
+next:
+	for _, c := range candidates {
+		if strings.Contains(pump, c) {
+			continue
+		}
+		for _, n := range tail {
+			starts, empty := a.starts(n, c)
+			if starts {
+				continue next
+			}
+			if !empty {
+				break
+			}
+		}
+		return c
+	}
+	return ""
+}
+
+// Returns whether n can match a text starting with the character c,
+// and whether it can match without consuming any characters.
+func (a *analyzer) starts(n syntax.Node, c string) (starts, empty bool) {
+	switch n := n.(type) {
+	case *syntax.Literal, *syntax.Dot, *syntax.Class, *syntax.CharType:
+		return a.match(n, "", c), false
+	case *syntax.Concat:
+		for _, item := range n.Items {
+			starts, empty := a.starts(item, c)
+			if starts || !empty {
+				return starts, false
+			}
+		}
+		return false, true
+	case *syntax.Alternation:
+		for _, alt := range n.Alts {
+			s, e := a.starts(alt, c)
+			starts, empty = starts || s, empty || e
+		}
+		return
+	case *syntax.Repeat:
+		starts, empty = a.starts(n.Sub, c)
+		return starts, empty || n.Min == 0
+	case *syntax.Group:
+		switch n.Kind {
+		case syntax.Lookahead, syntax.NegativeLookahead,
+			syntax.Lookbehind, syntax.NegativeLookbehind:
+			return false, true
+		}
+		return a.starts(n.Sub, c)
+	case *syntax.Recursion:
+		return true, true
+	case *syntax.Conditional:
+		starts, empty = a.starts(n.Yes, c)
+		if n.No == nil {
+			return starts, true
+		}
+		s, e := a.starts(n.No, c)
+		return starts || s, empty || e
+	}
+	return false, true
+}
@@ -0,0 +1,78 @@
+package redos
+
+import (
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre/syntax"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	check := func(pattern string, flags int, severity Severity, message, pump, suffix string) {
+		findings, err := Analyze(pattern, flags)
+		if err != nil {
+			t.Error(pattern, err)
+			return
+		}
+		if len(findings) == 0 {
+			t.Errorf("%q: no findings", pattern)
+			return
+		}
+		f := findings[0]
+		if f.Severity != severity || f.Message != message || f.Pump != pump || f.Suffix != suffix {
+			t.Errorf("%q: %s", pattern, f.String())
+		}
+	}
+	check(`(a+)+$`, 0, Exponential, nested, "a", "!")
+	check(`^(\w+\s?)*$`, 0, Exponential, nested, "a", "!")
+	check(`^(?:a|aa)+$`, 0, Exponential, ambiguous, "aa", "!")
+	check(`^(\d|[0-9a-f])*!`, 0, Exponential, ambiguous, "0", "#")
+	check(`^\d+\d+$`, 0, Polynomial, adjacent, "0", "!")
+	check(`^a\s*\s*x`, 0, Polynomial, adjacent, "\t", "!")
+	check(`^(?i)(A+)+B`, 0, Exponential, nested, "A", "!")
+
+	findings, _ := Analyze(`x(a+)+$`, 0)
+	if len(findings) != 1 || findings[0].Span != (syntax.Span{Start: 1, End: 6}) ||
+		findings[0].Inner != (syntax.Span{Start: 2, End: 4}) || findings[0].Prefix != "x" ||
+		findings[0].Attack(3) != "xaaa!" {
+		t.Error(findings)
+	}
+}
+
+func TestSafe(t *testing.T) {
+	for _, pattern := range []string{
+		`(a+)+`,
+		`(a+)+b*`,
+		`(ab+)+$`,
+		`(?>(a+)+)`,
+		`(a++)+$`,
+		`(a|b)+$`,
+		`(ab|a)+$`,
+		`(\b\w+)+$`,
+		`\d+\s+$`,
+		`^[a-z]+@[a-z]+\.com$`,
+	} {
+		findings, err := Analyze(pattern, 0)
+		if err != nil || len(findings) != 0 {
+			t.Error(pattern, findings, err)
+		}
+	}
+	if _, err := Analyze(`(`, 0); err == nil {
+		t.Error("no compile error")
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	check := func(pattern string, want bool) {
+		findings, err := Analyze(pattern, 0)
+		if err != nil || len(findings) == 0 {
+			t.Error(pattern, findings, err)
+			return
+		}
+		got, cerr := findings[0].Confirm(pcre.MustCompile(pattern, 0), 1<<16)
+		if cerr != nil || got != want {
+			t.Error(pattern, got, cerr)
+		}
+	}
+	check(`^(a+)+$`, true)
+	check(`^(a|aa)+$`, true)
+}
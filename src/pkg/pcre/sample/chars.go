@@ -0,0 +1,279 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sample
+
+import (
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre/syntax"
+	"math/rand"
+	"strings"
+	"unicode"
+)
+
+// Reports whether a and b are the same letter in different case.
+func foldequal(a, b rune) bool {
+	for f := unicode.SimpleFold(a); f != a; f = unicode.SimpleFold(f) {
+		if f == b {
+			return true
+		}
+	}
+	return false
+}
+
+func isword(r rune, ucp bool) bool {
+	if ucp {
+		return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+	}
+	return r == '_' || r < 0x80 && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+func isdigit(r rune, ucp bool) bool {
+	if ucp {
+		return unicode.IsDigit(r)
+	}
+	return '0' <= r && r <= '9'
+}
+
+func isspace(r rune, ucp bool) bool {
+	if ucp {
+		return unicode.IsSpace(r)
+	}
+	return strings.ContainsRune(" \t\n\v\f\r", r)
+}
+
+func ishspace(r rune) bool {
+	return r == ' ' || r == '\t' || r == 0xa0 || r == 0x1680 || r == 0x180e ||
+		0x2000 <= r && r <= 0x200a || r == 0x202f || r == 0x205f || r == 0x3000
+}
+
+func isvspace(r rune) bool {
+	return '\n' <= r && r <= '\r' || r == 0x85 || r == 0x2028 || r == 0x2029
+}
+
+// Returns the table of a Unicode property name of \p, or nil.
+func property(name string) *unicode.RangeTable {
+	if t, ok := unicode.Categories[name]; ok {
+		return t
+	}
+	if t, ok := unicode.Scripts[name]; ok {
+		return t
+	}
+	return nil
+}
+
+func hasproperty(name string, r rune) bool {
+	switch name {
+	case "Any":
+		return true
+	case "L&":
+		return unicode.IsUpper(r) || unicode.IsLower(r) || unicode.IsTitle(r)
+	case "Xan":
+		return unicode.IsLetter(r) || unicode.IsNumber(r)
+	case "Xwd":
+		return r == '_' || unicode.IsLetter(r) || unicode.IsNumber(r)
+	case "Xsp", "Xps":
+		return unicode.IsSpace(r)
+	}
+	if t := property(name); t != nil {
+		return unicode.Is(t, r)
+	}
+	return false
+}
+
+func isposix(name string, r rune, ucp bool) bool {
+	switch name {
+	case "alpha":
+		return ucp && unicode.IsLetter(r) || r < 0x80 && unicode.IsLetter(r)
+	case "digit":
+		return isdigit(r, ucp)
+	case "alnum":
+		return isword(r, ucp) && r != '_'
+	case "word":
+		return isword(r, ucp)
+	case "space":
+		return isspace(r, ucp)
+	case "blank":
+		return r == ' ' || r == '\t'
+	case "upper":
+		return (ucp || r < 0x80) && unicode.IsUpper(r)
+	case "lower":
+		return (ucp || r < 0x80) && unicode.IsLower(r)
+	case "punct":
+		return r < 0x80 && unicode.IsPunct(r) || r < 0x80 && unicode.IsSymbol(r)
+	case "xdigit":
+		return '0' <= r && r <= '9' || 'a' <= r && r <= 'f' || 'A' <= r && r <= 'F'
+	case "cntrl":
+		return r < 0x20 || r == 0x7f
+	case "graph":
+		return 0x20 < r && r < 0x7f
+	case "print":
+		return 0x20 <= r && r < 0x7f
+	case "ascii":
+		return r < 0x80
+	}
+	return false
+}
+
+// Reports whether the single character r matches n, which is a
+// *Literal, *Dot, *CharType, *Class or an item of a class.
+func matches(n syntax.Node, r rune) bool {
+	flags := n.Flags()
+	caseless := flags&pcre.CASELESS != 0
+	ucp := flags&pcre.UCP != 0
+	switch n := n.(type) {
+	case *syntax.Literal:
+		return r == n.Rune || caseless && foldequal(r, n.Rune)
+	case *syntax.Dot:
+		return r != '\n' || flags&pcre.DOTALL != 0
+	case *syntax.Range:
+		if n.Lo <= r && r <= n.Hi {
+			return true
+		}
+		if caseless {
+			for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+				if n.Lo <= f && f <= n.Hi {
+					return true
+				}
+			}
+		}
+		return false
+	case *syntax.Posix:
+		return isposix(n.Name, r, ucp) != n.Negated
+	case *syntax.Class:
+		for _, item := range n.Items {
+			if matches(item, r) {
+				return !n.Negated
+			}
+		}
+		return n.Negated
+	case *syntax.CharType:
+		switch n.Kind {
+		case 'd':
+			return isdigit(r, ucp)
+		case 'D':
+			return !isdigit(r, ucp)
+		case 'w':
+			return isword(r, ucp)
+		case 'W':
+			return !isword(r, ucp)
+		case 's':
+			return isspace(r, ucp)
+		case 'S':
+			return !isspace(r, ucp)
+		case 'h':
+			return ishspace(r)
+		case 'H':
+			return !ishspace(r)
+		case 'v', 'R':
+			return isvspace(r)
+		case 'V':
+			return !isvspace(r)
+		case 'N':
+			return r != '\n'
+		case 'X', 'C':
+			return true
+		case 'p':
+			return hasproperty(n.Property, r)
+		case 'P':
+			return !hasproperty(n.Property, r)
+		}
+	}
+	return false
+}
+
+// Returns the characters to choose from for n: printable ASCII, tab
+// and newline, and those which n names, such as the ends of a range
+// and a character in it.  Without UTF8, characters above 0xff are left
+// out.
+func candidates(n syntax.Node, rnd *rand.Rand) []rune {
+	var runes []rune
+	for r := rune(0x20); r < 0x7f; r++ {
+		runes = append(runes, r)
+	}
+	runes = append(runes, '\t', '\n')
+	var add func(n syntax.Node)
+	add = func(n syntax.Node) {
+		switch n := n.(type) {
+		case *syntax.Literal:
+			runes = append(runes, n.Rune, unicode.SimpleFold(n.Rune))
+		case *syntax.Range:
+			runes = append(runes, n.Lo, n.Hi, n.Lo+rnd.Int31n(n.Hi-n.Lo+1))
+		case *syntax.Class:
+			for _, item := range n.Items {
+				add(item)
+			}
+		case *syntax.CharType:
+			switch n.Kind {
+			case 'p', 'P':
+				if t := property(n.Property); t != nil {
+					runes = append(runes, pick(t, rnd))
+				}
+			case 'h', 'H':
+				runes = append(runes, 0xa0, 0x3000)
+			case 'v', 'V', 'R':
+				runes = append(runes, '\v', '\f', '\r', 0x2028)
+			}
+		}
+	}
+	add(n)
+	runes = append(runes, 0xe9, 0x3b1, 0x4e2d)
+	if n.Flags()&pcre.UTF8 == 0 {
+		kept := runes[:0]
+		for _, r := range runes {
+			if r <= 0xff {
+				kept = append(kept, r)
+			}
+		}
+		runes = kept
+	}
+	return runes
+}
+
+// Returns a random character of the table.
+func pick(t *unicode.RangeTable, rnd *rand.Rand) rune {
+	var ranges []unicode.Range32
+	for _, r := range t.R16 {
+		ranges = append(ranges, unicode.Range32{Lo: uint32(r.Lo), Hi: uint32(r.Hi), Stride: uint32(r.Stride)})
+	}
+	ranges = append(ranges, t.R32...)
+	r := ranges[rnd.Intn(len(ranges))]
+	return rune(r.Lo + r.Stride*uint32(rnd.Intn(int((r.Hi-r.Lo)/r.Stride+1))))
+}
+
+// Returns a random character which matches n, or which does not if
+// match is false, and false if there is none among the candidates.
+func char(n syntax.Node, match bool, rnd *rand.Rand) (rune, bool) {
+	var found []rune
+	for _, r := range candidates(n, rnd) {
+		if matches(n, r) == match {
+			found = append(found, r)
+		}
+	}
+	if len(found) == 0 {
+		return 0, false
+	}
+	return found[rnd.Intn(len(found))], true
+}
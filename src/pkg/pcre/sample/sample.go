@@ -0,0 +1,352 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package sample generates subjects which match a pattern, and near
+// misses which do not.
+//
+// A Generator walks the syntax tree of the pattern and picks a random
+// way through it: a branch of each alternation, a count for each
+// quantifier and a character for each class.  Back references repeat
+// the text of their group, recursions expand the group they call, and
+// conditionals follow whether their group was set.  Lookarounds and
+// anchors such as \b are not generated directly; every string is
+// checked with Matcher.Match, and one which fails the check is thrown
+// away and generated again.
+package sample
+
+import (
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre/syntax"
+	"github.com/pkg/errors"
+	"math/rand"
+	"unicode/utf8"
+)
+
+// Generates strings for a pattern.  The fields can be changed before
+// the first call.
+type Generator struct {
+	MaxRepeat int // the most repetitions beyond the minimum of a quantifier
+	MaxDepth  int // the most nested recursions
+	Tries     int // attempts at a string before giving up
+
+	re   *syntax.Regexp
+	m    *pcre.Matcher
+	rand *rand.Rand
+}
+
+// Returns a generator for re, with MaxRepeat 3, MaxDepth 4 and Tries
+// 100, whose random choices are determined by seed.
+func New(re pcre.Regexp, seed int64) (*Generator, error) {
+	parsed, cerr := syntax.Parse(re.String(), re.Flags())
+	if cerr != nil {
+		return nil, cerr
+	}
+	m, err := re.MatcherString("", 0)
+	if err != nil {
+		return nil, err
+	}
+	return &Generator{
+		MaxRepeat: 3,
+		MaxDepth:  4,
+		Tries:     100,
+		re:        parsed,
+		m:         m,
+		rand:      rand.New(rand.NewSource(seed)),
+	}, nil
+}
+
+// Returns n strings which match re, generated with the defaults of
+// New.
+func Generate(re pcre.Regexp, n int, seed int64) ([]string, error) {
+	g, err := New(re, seed)
+	if err != nil {
+		return nil, err
+	}
+	return g.strings(n, g.Match)
+}
+
+// Like Generate, but returns near misses, as by NearMiss.
+func NearMisses(re pcre.Regexp, n int, seed int64) ([]string, error) {
+	g, err := New(re, seed)
+	if err != nil {
+		return nil, err
+	}
+	return g.strings(n, g.NearMiss)
+}
+
+func (g *Generator) strings(n int, next func() (string, error)) ([]string, error) {
+	var s []string
+	for i := 0; i < n; i++ {
+		subject, err := next()
+		if err != nil {
+			return s, err
+		}
+		s = append(s, subject)
+	}
+	return s, nil
+}
+
+// Returns a random string which matches the pattern.
+func (g *Generator) Match() (string, error) {
+	for i := 0; i < g.Tries; i++ {
+		for _, s := range g.attempt(-1) {
+			if ok, err := g.m.MatchString(s, 0); err == nil && ok {
+				return s, nil
+			}
+		}
+	}
+	return "", errors.Errorf("sample: no match for %q in %d tries", g.re.Pattern, g.Tries)
+}
+
+// Returns a random string which does not match the pattern, but comes
+// close: it is generated like a match, except that one character,
+// quantifier or back reference is made to fail.  If that still
+// matches, a character is inserted, deleted or replaced at random.
+func (g *Generator) NearMiss() (string, error) {
+	var faults int
+	syntax.Walk(g.re.Root, func(n syntax.Node) bool {
+		if faulty(n) {
+			faults++
+		}
+		return true
+	})
+	for i := 0; i < g.Tries; i++ {
+		var candidates []string
+		if faults > 0 {
+			candidates = g.attempt(g.rand.Intn(faults))
+		}
+		for _, s := range g.attempt(-1) {
+			candidates = append(candidates, g.mutate(s))
+		}
+		for _, s := range candidates {
+			if ok, err := g.m.MatchString(s, 0); err == nil && !ok {
+				return s, nil
+			}
+		}
+	}
+	return "", errors.Errorf("sample: no near miss for %q in %d tries", g.re.Pattern, g.Tries)
+}
+
+// Reports whether a near miss can be made by breaking n.
+func faulty(n syntax.Node) bool {
+	switch n := n.(type) {
+	case *syntax.Literal, *syntax.Dot, *syntax.CharType, *syntax.Class, *syntax.Backref:
+		return true
+	case *syntax.Repeat:
+		return n.Min > 0 || n.Max >= 0
+	}
+	return false
+}
+
+// Inserts, deletes or replaces a random character of s.
+func (g *Generator) mutate(s string) string {
+	runes := []rune(s)
+	i := g.rand.Intn(len(runes) + 1)
+	r := rune(0x20 + g.rand.Intn(0x5f))
+	switch op := g.rand.Intn(3); {
+	case op == 0 || i == len(runes):
+		runes = append(runes[:i], append([]rune{r}, runes[i:]...)...)
+	case op == 1:
+		runes = append(runes[:i], runes[i+1:]...)
+	default:
+		runes[i] = r
+	}
+	return string(runes)
+}
+
+// Thrown by the generator when an attempt cannot succeed, such as at
+// (*FAIL) or too deep a recursion.
+type abort struct{}
+
+// The state of one attempt.
+type state struct {
+	*Generator
+	b         []byte
+	groups    [][]byte // text of each group, nil if unset
+	depth     int      // of recursions
+	lookahead [][]byte // text for positive lookaheads
+	fault     int      // index of the faulty node, counting down
+}
+
+// Returns the generated string, once with the text of the positive
+// lookaheads appended and once without, or nothing if the attempt
+// failed.  If fault is not negative, the fault'th node for which
+// faulty is true is broken.
+func (g *Generator) attempt(fault int) (s []string) {
+	st := &state{Generator: g, groups: make([][]byte, g.re.Groups+1), fault: fault}
+	defer func() {
+		if e := recover(); e != nil {
+			if _, ok := e.(abort); !ok {
+				panic(e)
+			}
+			s = nil
+		}
+	}()
+	st.node(g.re.Root)
+	if st.lookahead != nil {
+		s = append(s, string(st.b)+string(joinbytes(st.lookahead)))
+	}
+	return append(s, string(st.b))
+}
+
+func joinbytes(b [][]byte) []byte {
+	var s []byte
+	for _, x := range b {
+		s = append(s, x...)
+	}
+	return s
+}
+
+func (st *state) rune(r rune, flags int) {
+	if flags&pcre.UTF8 != 0 {
+		var buf [utf8.UTFMax]byte
+		st.b = append(st.b, buf[:utf8.EncodeRune(buf[:], r)]...)
+	} else {
+		st.b = append(st.b, byte(r))
+	}
+}
+
+// Reports whether n is the node to break, counting it off.
+func (st *state) broken(n syntax.Node) bool {
+	if st.fault < 0 || !faulty(n) {
+		return false
+	}
+	st.fault--
+	return st.fault < 0
+}
+
+// Generates text for n into st.b.
+func (st *state) node(n syntax.Node) {
+	broken := st.broken(n)
+	switch n := n.(type) {
+	case *syntax.Literal, *syntax.Dot, *syntax.CharType, *syntax.Class:
+		if n, ok := n.(*syntax.CharType); ok && n.Kind == 'R' && !broken && st.rand.Intn(4) == 0 {
+			st.b = append(st.b, "\r\n"...)
+			break
+		}
+		r, ok := char(n, !broken, st.rand)
+		if !ok {
+			panic(abort{})
+		}
+		st.rune(r, n.Flags())
+	case *syntax.Concat:
+		for _, item := range n.Items {
+			st.node(item)
+		}
+	case *syntax.Alternation:
+		st.node(n.Alts[st.rand.Intn(len(n.Alts))])
+	case *syntax.Repeat:
+		st.repeat(n, broken)
+	case *syntax.Group:
+		st.group(n)
+	case *syntax.Backref:
+		text := st.groups[n.Index]
+		if broken {
+			text = []byte(st.mutate(string(text)))
+		}
+		st.b = append(st.b, text...)
+	case *syntax.Recursion:
+		if st.depth >= st.MaxDepth {
+			panic(abort{})
+		}
+		var sub syntax.Node = st.re.Root
+		if n.Index > 0 {
+			sub = st.re.Group(n.Index).Sub
+		}
+		// Groups set in a recursion are restored afterwards.
+		saved := append([][]byte(nil), st.groups...)
+		st.depth++
+		st.node(sub)
+		st.depth--
+		st.groups = saved
+	case *syntax.Conditional:
+		st.conditional(n)
+	case *syntax.Verb:
+		if n.Name == "FAIL" || n.Name == "F" {
+			panic(abort{})
+		}
+	}
+}
+
+func (st *state) repeat(n *syntax.Repeat, broken bool) {
+	max := n.Min + st.MaxRepeat
+	if n.Max >= 0 && n.Max < max {
+		max = n.Max
+	}
+	count := n.Min + st.rand.Intn(max-n.Min+1)
+	if broken {
+		// One too few or one too many.
+		if n.Min > 0 && (n.Max < 0 || st.rand.Intn(2) == 0) {
+			count = n.Min - 1
+		} else {
+			count = n.Max + 1
+		}
+	}
+	for i := 0; i < count; i++ {
+		st.node(n.Sub)
+	}
+}
+
+func (st *state) group(n *syntax.Group) {
+	switch n.Kind {
+	case syntax.Lookahead:
+		b := st.b
+		st.b = nil
+		st.node(n.Sub)
+		st.lookahead = append(st.lookahead, st.b)
+		st.b = b
+	case syntax.Lookbehind:
+		// Only at the start can the text before be made up.
+		if len(st.b) == 0 {
+			st.node(n.Sub)
+		}
+	case syntax.NegativeLookahead, syntax.NegativeLookbehind:
+	default:
+		start := len(st.b)
+		st.node(n.Sub)
+		if n.Kind == syntax.Capture {
+			st.groups[n.Index] = append([]byte{}, st.b[start:]...)
+		}
+	}
+}
+
+func (st *state) conditional(n *syntax.Conditional) {
+	var yes bool
+	switch n.Cond {
+	case syntax.CondDefine:
+		return
+	case syntax.CondGroup:
+		yes = st.groups[n.Index] != nil
+	case syntax.CondRecursion:
+		yes = st.depth > 0
+	case syntax.CondAssert:
+		yes = st.rand.Intn(2) == 0
+	}
+	if yes {
+		st.node(n.Yes)
+	} else if n.No != nil {
+		st.node(n.No)
+	}
+}
@@ -0,0 +1,99 @@
+package sample
+
+import (
+	"fmt"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"strings"
+	"testing"
+)
+
+var patterns = []struct {
+	pattern string
+	flags   int
+}{
+	{`^a{2,4}b?$`, 0},
+	{`^(\w+)-\1$`, 0},
+	{`^(?<q>['"]).*\k<q>$`, 0},
+	{`^(?=.*\d)(?=.*[A-Z])\w{6,}$`, 0},
+	{`(?<=\$)\d+(?!\d)`, 0},
+	{`^[^a-z\d\s]+$`, 0},
+	{`^[[:xdigit:]]{4}$`, 0},
+	{`^(\((?1)*\))$`, 0},
+	{`^(<)?\w+(?(1)>)$`, 0},
+	{`^\p{Greek}+\s\P{L}$`, pcre.UTF8},
+	{`^abc$`, pcre.CASELESS},
+	{`^x(?i:y)z\b`, 0},
+	{`^\d{3}-\d{4}\R\h\v\N\D\S\W$`, 0},
+	{`^(?:cat|dog)(?:s|)\.$`, 0},
+}
+
+func TestGenerate(t *testing.T) {
+	for _, p := range patterns {
+		re := pcre.MustCompile(p.pattern, p.flags)
+		m, _ := re.MatcherString("", 0)
+		s, err := Generate(re, 20, 1)
+		if err != nil || len(s) != 20 {
+			t.Error(p.pattern, err, s)
+			continue
+		}
+		for _, x := range s {
+			if ok, _ := m.MatchString(x, 0); !ok {
+				t.Errorf("%q: %q does not match", p.pattern, x)
+			}
+		}
+		misses, err := NearMisses(re, 20, 1)
+		if err != nil || len(misses) != 20 {
+			t.Error(p.pattern, err, misses)
+			continue
+		}
+		for _, x := range misses {
+			if ok, _ := m.MatchString(x, 0); ok {
+				t.Errorf("%q: %q matches", p.pattern, x)
+			}
+		}
+	}
+}
+
+func TestGenerateBounds(t *testing.T) {
+	re := pcre.MustCompile(`^a{2,4}(?:b|cd)*$`, 0)
+	s, _ := Generate(re, 50, 7)
+	lengths := make(map[int]bool)
+	for _, x := range s {
+		n := len(x) - len(strings.TrimLeft(x, "a"))
+		if n < 2 || n > 4 {
+			t.Error(x)
+		}
+		lengths[n] = true
+	}
+	if len(lengths) != 3 {
+		t.Error(lengths)
+	}
+	if again, _ := Generate(re, 50, 7); fmt.Sprint(again) != fmt.Sprint(s) {
+		t.Error(again, s)
+	}
+	if other, _ := Generate(re, 50, 8); fmt.Sprint(other) == fmt.Sprint(s) {
+		t.Error(other)
+	}
+
+	g, _ := New(pcre.MustCompile(`^a*b{1,}c{2,9}$`, 0), 1)
+	g.MaxRepeat = 0
+	if x, err := g.Match(); x != "bcc" || err != nil {
+		t.Error(x, err)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	if s, err := Generate(pcre.MustCompile(`a(*FAIL)`, 0), 1, 1); err == nil || s != nil {
+		t.Error(s, err)
+	}
+	// The empty string matches everywhere.
+	if s, err := NearMisses(pcre.MustCompile(`x*`, 0), 1, 1); err == nil || s != nil {
+		t.Error(s, err)
+	}
+	// Too deep a recursion gives up.
+	g, _ := New(pcre.MustCompile(`^(a(?1)b)$`, 0), 1)
+	g.Tries = 5
+	if x, err := g.Match(); err == nil {
+		t.Error(x)
+	}
+}
@@ -0,0 +1,501 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package pcre
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A compiled Perl substitution (s///) or transliteration (tr///)
+// expression.  Use ParseSubstitution or MustParseSubstitution to
+// create such objects.  They are immutable.
+type Substitution struct {
+	re       Regexp
+	global   bool
+	template []templatepart
+	tr       *transliteration // non-nil for tr/// and y///
+}
+
+// One piece of a replacement template: a literal, a capture group
+// reference, or a case conversion escape.
+type templatepart struct {
+	literal string
+	group   int  // capture group, or -1 for literal and caseop
+	caseop  byte // one of "ULEul" for \U, \L, \E, \u, \l, or 0
+}
+
+// Parse a Perl substitution expression such as s/(\w+)@(\w+)/$2 at
+// $1/gi, or a transliteration such as tr/a-z/A-Z/.
+//
+// In s///, the modifier g replaces all matches instead of the first
+// one, and the remaining letters are the pattern modifiers accepted
+// by CompileLiteral.  The e modifier is not supported, and no
+// modifier may be given twice.  The
+// replacement may refer to groups as $1, ${1}, \1, ${name} or
+// $+{name}, and to the whole match as $&.  The escapes \U and \L
+// convert the following text to upper or lower case until \E, and
+// \u and \l convert the next character only.
+//
+// In tr/// (or y///), the lists may contain ranges such as a-z, and
+// the modifiers c (complement the search list), d (delete characters
+// without replacement) and s (squeeze runs of the same replacement
+// character) are supported.  A range whose end comes before its start,
+// such as z-a, is an error.  Transliteration works on UTF-8 characters.
+//
+// As with CompileLiteral, errors are reported with their offset in
+// the expression.  Group references are checked against the pattern.
+func ParseSubstitution(expr string) (*Substitution, *CompileError) {
+	i := 0
+	switch {
+	case strings.HasPrefix(expr, "s") && len(expr) > 1 && !isalnum(expr[1]):
+		i = 1
+	case strings.HasPrefix(expr, "tr") && len(expr) > 2 && !isalnum(expr[2]):
+		i = 2
+	case strings.HasPrefix(expr, "y") && len(expr) > 1 && !isalnum(expr[1]):
+		i = 1
+	default:
+		return nil, &CompileError{Pattern: expr, Message: "not a substitution"}
+	}
+	search, err := scandelimited(expr, i)
+	if err != nil {
+		return nil, err
+	}
+	j := search.end - 1
+	if _, nesting := brackets[expr[i]]; nesting {
+		for j = search.end; j < len(expr) && strings.IndexByte(" \t\n\r", expr[j]) >= 0; j++ {
+		}
+	}
+	repl, err := scandelimited(expr, j)
+	if err != nil {
+		return nil, err
+	}
+	mods := expr[repl.end:]
+	if expr[0] != 's' {
+		return parsetr(expr, search, repl, mods)
+	}
+
+	s := new(Substitution)
+	flags := 0
+	for k := 0; k < len(mods); k++ {
+		var msg string
+		switch c := mods[k]; {
+		case strings.IndexByte(mods[:k], c) >= 0:
+			msg = "repeated modifier " + strconv.QuoteRune(rune(c))
+		case c == 'e':
+			msg = "modifier e is not supported"
+		case c == 'g':
+			s.global = true
+			continue
+		default:
+			f, _, ferr := modifierflags(mods[k : k+1])
+			if ferr == nil {
+				flags |= f
+				continue
+			}
+			msg = ferr.Error()
+		}
+		return nil, &CompileError{Pattern: expr, Message: msg, Offset: repl.end + k}
+	}
+	if s.re, err = Compile(search.pattern, flags); err != nil {
+		err.Pattern = expr
+		err.Offset = search.offsets[err.Offset]
+		return nil, err
+	}
+	if s.template, err = parsetemplate(s.re, repl); err != nil {
+		err.Pattern = expr
+		return nil, err
+	}
+	return s, nil
+}
+
+// Parse a substitution expression.  If parsing fails, panic.
+func MustParseSubstitution(expr string) *Substitution {
+	s, err := ParseSubstitution(expr)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Split the replacement part of s/// into template parts.  Returned
+// errors only have their offset set.
+func parsetemplate(re Regexp, repl literal) ([]templatepart, *CompileError) {
+	var (
+		parts []templatepart
+		lit   []byte
+	)
+	src := repl.pattern
+	groups := re.Groups()
+	names := re.NamedGroups()
+	flush := func() {
+		if len(lit) > 0 {
+			parts = append(parts, templatepart{literal: string(lit), group: -1})
+			lit = nil
+		}
+	}
+	ref := func(group int) {
+		flush()
+		parts = append(parts, templatepart{group: group})
+	}
+	fail := func(i int, msg string) ([]templatepart, *CompileError) {
+		return nil, &CompileError{Message: msg, Offset: repl.offsets[i]}
+	}
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '\\' && i+1 < len(src):
+			i++
+			e := src[i]
+			switch {
+			case strings.IndexByte("ULEul", e) >= 0:
+				flush()
+				parts = append(parts, templatepart{group: -1, caseop: e})
+			case '1' <= e && e <= '9':
+				if int(e-'0') > groups {
+					return fail(i-1, "reference to non-existent group")
+				}
+				ref(int(e - '0'))
+			case e == 'n':
+				lit = append(lit, '\n')
+			case e == 't':
+				lit = append(lit, '\t')
+			case e == 'r':
+				lit = append(lit, '\r')
+			case e == 'f':
+				lit = append(lit, '\f')
+			case e == 'e':
+				lit = append(lit, '\033')
+			case e == 'a':
+				lit = append(lit, '\a')
+			case e == '0':
+				lit = append(lit, 0)
+			default:
+				lit = append(lit, e)
+			}
+		case c == '$' && i+1 < len(src):
+			start := i
+			name := ""
+			switch e := src[i+1]; {
+			case e == '&':
+				i++
+				ref(0)
+				continue
+			case '0' <= e && e <= '9':
+				j := i + 1
+				for j < len(src) && '0' <= src[j] && src[j] <= '9' {
+					j++
+				}
+				name = src[i+1 : j]
+				i = j - 1
+			case e == '{' || e == '+' && strings.HasPrefix(src[i+2:], "{"):
+				j := strings.IndexByte(src[i:], '}')
+				if j < 0 {
+					return fail(start, "missing } in group reference")
+				}
+				name = src[strings.IndexByte(src[i:], '{')+i+1 : i+j]
+				i += j
+			default:
+				lit = append(lit, c)
+				continue
+			}
+			group, err := strconv.Atoi(name)
+			if err != nil {
+				var ok bool
+				if group, ok = names[name]; !ok {
+					return fail(start, "reference to non-existent group "+name)
+				}
+			} else if group > groups {
+				return fail(start, "reference to non-existent group "+name)
+			}
+			ref(group)
+		default:
+			lit = append(lit, c)
+		}
+	}
+	flush()
+	return parts, nil
+}
+
+// Applies case conversions to the template output.
+type caseconverter struct {
+	mode    byte // 'U', 'L' or 0
+	oneshot byte // 'u', 'l' or 0
+}
+
+func (cc *caseconverter) write(b []byte, s string) []byte {
+	if cc.mode == 0 && cc.oneshot == 0 {
+		return append(b, s...)
+	}
+	for _, r := range s {
+		switch {
+		case cc.oneshot == 'u':
+			r = unicode.ToTitle(r)
+		case cc.oneshot == 'l':
+			r = unicode.ToLower(r)
+		case cc.mode == 'U':
+			r = unicode.ToUpper(r)
+		case cc.mode == 'L':
+			r = unicode.ToLower(r)
+		}
+		cc.oneshot = 0
+		var buf [utf8.UTFMax]byte
+		b = append(b, buf[:utf8.EncodeRune(buf[:], r)]...)
+	}
+	return b
+}
+
+func (s *Substitution) expand(b []byte, m *Matcher) []byte {
+	var cc caseconverter
+	for _, p := range s.template {
+		switch {
+		case p.caseop == 'U' || p.caseop == 'L':
+			cc.mode = p.caseop
+		case p.caseop == 'E':
+			cc.mode = 0
+		case p.caseop != 0:
+			cc.oneshot = p.caseop
+		case p.group >= 0:
+			b = cc.write(b, m.GroupString(p.group))
+		default:
+			b = cc.write(b, p.literal)
+		}
+	}
+	return b
+}
+
+// Applies the substitution to subject.  Returns the result and the
+// number of substitutions made (for tr///, the number of characters
+// found in the search list).
+func (s *Substitution) Apply(subject []byte) ([]byte, int, error) {
+	if s.tr != nil {
+		r, n := s.tr.apply(subject)
+		return r, n, nil
+	}
+	m := new(Matcher)
+	m.init(s.re)
+	m.subjectb = subject
+	return s.substitute(m, subject)
+}
+
+// Like Apply, but for strings.
+func (s *Substitution) ApplyString(subject string) (string, int, error) {
+	if s.tr != nil {
+		r, n := s.tr.apply([]byte(subject))
+		return string(r), n, nil
+	}
+	m := new(Matcher)
+	m.init(s.re)
+	m.subjects = subject
+	r, n, err := s.substitute(m, []byte(subject))
+	return string(r), n, err
+}
+
+func (s *Substitution) substitute(m *Matcher, subject []byte) ([]byte, int, error) {
+	var r []byte
+	n, last := 0, 0
+	matched, err := m.matchfrom(0, 0)
+	for ; matched; matched, err = m.Next(0) {
+		start, end := int(m.ovector[0]), int(m.ovector[1])
+		r = append(r, subject[last:start]...)
+		r = s.expand(r, m)
+		last = end
+		n++
+		if !s.global {
+			break
+		}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if n == 0 {
+		return subject, 0, nil
+	}
+	return append(r, subject[last:]...), n, nil
+}
+
+// A compiled tr/// expression.
+type transliteration struct {
+	search     map[rune]int // index in from
+	to         []rune
+	complement bool
+	delete     bool
+	squeeze    bool
+}
+
+func parsetr(expr string, search, repl literal, mods string) (*Substitution, *CompileError) {
+	tr := new(transliteration)
+	for k := 0; k < len(mods); k++ {
+		if strings.IndexByte(mods[:k], mods[k]) >= 0 {
+			return nil, &CompileError{
+				Pattern: expr,
+				Message: "repeated modifier " + strconv.QuoteRune(rune(mods[k])),
+				Offset:  repl.end + k,
+			}
+		}
+		switch mods[k] {
+		case 'c':
+			tr.complement = true
+		case 'd':
+			tr.delete = true
+		case 's':
+			tr.squeeze = true
+		case 'r':
+		default:
+			return nil, &CompileError{
+				Pattern: expr,
+				Message: "unknown modifier " + strconv.QuoteRune(rune(mods[k])),
+				Offset:  repl.end + k,
+			}
+		}
+	}
+	from, err := expandtr(search)
+	if err != nil {
+		err.Pattern = expr
+		return nil, err
+	}
+	if tr.to, err = expandtr(repl); err != nil {
+		err.Pattern = expr
+		return nil, err
+	}
+	if len(tr.to) == 0 && !tr.delete {
+		tr.to = from
+	}
+	tr.search = make(map[rune]int, len(from))
+	for i, r := range from {
+		if _, ok := tr.search[r]; !ok {
+			tr.search[r] = i
+		}
+	}
+	return &Substitution{tr: tr}, nil
+}
+
+// Expand the ranges and escapes in a tr/// list.  Returned errors
+// only have their offset set.
+func expandtr(l literal) ([]rune, *CompileError) {
+	s := l.pattern
+	var list []rune
+	next := func(i int) (rune, int) {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case 'n':
+				return '\n', i + 2
+			case 't':
+				return '\t', i + 2
+			case 'r':
+				return '\r', i + 2
+			case 'f':
+				return '\f', i + 2
+			case 'e':
+				return '\033', i + 2
+			case 'a':
+				return '\a', i + 2
+			case '0':
+				return 0, i + 2
+			}
+			r, size := utf8.DecodeRuneInString(s[i+1:])
+			return r, i + 1 + size
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		return r, i + size
+	}
+	for i := 0; i < len(s); {
+		start := i
+		var lo rune
+		lo, i = next(i)
+		if i+1 < len(s) && s[i] == '-' {
+			hi, j := next(i + 1)
+			if lo > hi {
+				return nil, &CompileError{
+					Message: "invalid range " + strconv.Quote(s[start:j]),
+					Offset:  l.offsets[start],
+				}
+			}
+			for r := lo; r <= hi; r++ {
+				list = append(list, r)
+			}
+			i = j
+			continue
+		}
+		list = append(list, lo)
+	}
+	return list, nil
+}
+
+// Returns the replacement for r, whether r is in the search list,
+// and whether r is to be deleted.
+func (tr *transliteration) lookup(r rune) (rune, bool, bool) {
+	i, found := tr.search[r]
+	if tr.complement {
+		if found {
+			return r, false, false
+		}
+		if len(tr.to) == 0 {
+			return r, true, tr.delete
+		}
+		return tr.to[len(tr.to)-1], true, false
+	}
+	switch {
+	case !found:
+		return r, false, false
+	case i < len(tr.to):
+		return tr.to[i], true, false
+	case tr.delete:
+		return r, true, true
+	}
+	return tr.to[len(tr.to)-1], true, false
+}
+
+func (tr *transliteration) apply(subject []byte) ([]byte, int) {
+	r := make([]byte, 0, len(subject))
+	n := 0
+	var last rune = -1 // last replacement written, for squeezing
+	for i := 0; i < len(subject); {
+		c, size := utf8.DecodeRune(subject[i:])
+		if c == utf8.RuneError && size == 1 {
+			r = append(r, subject[i])
+			i++
+			last = -1
+			continue
+		}
+		i += size
+		repl, found, del := tr.lookup(c)
+		if !found {
+			r = utf8.AppendRune(r, c)
+			last = -1
+			continue
+		}
+		n++
+		if del || tr.squeeze && repl == last {
+			continue
+		}
+		r = utf8.AppendRune(r, repl)
+		last = repl
+	}
+	return r, n
+}
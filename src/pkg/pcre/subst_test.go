@@ -0,0 +1,84 @@
+package pcre
+
+import (
+	"testing"
+)
+
+func TestSubstitution(t *testing.T) {
+	check := func(expr, subject, result string, count int) {
+		s, err := ParseSubstitution(expr)
+		if err != nil {
+			t.Error(expr, err)
+			return
+		}
+		r, n, aerr := s.ApplyString(subject)
+		if aerr != nil {
+			t.Error(expr, aerr)
+		}
+		if r != result || n != count {
+			t.Errorf("%s on %q: %q, %d", expr, subject, r, n)
+		}
+		b, n, aerr := s.Apply([]byte(subject))
+		if aerr != nil || string(b) != result || n != count {
+			t.Errorf("%s on %q: Apply %q, %d", expr, subject, b, n)
+		}
+	}
+	check(`s/(\w+)@(\w+)/$2 at $1/gi`, "joe@home, ann@work", "home at joe, work at ann", 2)
+	check(`s/(\w+)@(\w+)/$2 at $1/`, "joe@home, ann@work", "home at joe, ann@work", 1)
+	check(`s/foo/bar/`, "no match", "no match", 0)
+	check(`s/FOO/bar/ig`, "Foo foo", "bar bar", 2)
+	check(`s/x*/-/g`, "abc", "-a-b-c-", 4)
+	check(`s/\b(\w)/\u$1/g`, "hello big world", "Hello Big World", 3)
+	check(`s/(\w+)/\U$1\E!/`, "shout it", "SHOUT! it", 1)
+	check(`s/(\w+) (\w+)/\u\L$2\E \l$1/`, "HELLO WORLD", "World hELLO", 1)
+	check(`s/(?<user>\w+)@/${user} at /`, "me@host", "me at host", 1)
+	check(`s/(?<user>\w+)@/$+{user}: /`, "me@host", "me: host", 1)
+	check(`s/(a)(b)?/[\1|$2|$&]/g`, "ab a", "[a|b|ab] [a||a]", 2)
+	check(`s{/}{\\}g`, "a/b/c", `a\b\c`, 2)
+	check(`s{a} {b}`, "aa", "ba", 1)
+	check(`s|^|> |mg`, "a\nb", "> a\n> b", 2)
+	check(`s/\//|/g`, "a/b", "a|b", 1)
+	check(`s/(?<=a)b/X/g`, "abab", "aXaX", 2)
+	check(`s/./\$/gs`, "a\n", "$$", 2)
+	check(`s/x*/-/gu`, "äö", "-ä-ö-", 3)
+	check(`tr/a-z/A-Z/`, "hello, world", "HELLO, WORLD", 10)
+	check(`tr/a-y/b-z/`, "abc", "bcd", 3)
+	check(`y/abc//d`, "aXbYc", "XY", 3)
+	check(`tr/a-zA-Z/ /cs`, "hello,  world!", "hello world ", 4)
+	check(`tr/a//`, "banana", "banana", 3)
+	check(`tr/a-c/x/`, "abcd", "xxxd", 3)
+	check(`tr/ab/x/d`, "abc", "xc", 2)
+	check(`tr/a/a/s`, "aaabaa", "aba", 5)
+	check(`tr/äö/ao/`, "häöh", "haoh", 2)
+	check(`tr{/}{\\}`, "a/b", `a\b`, 1)
+}
+
+func TestSubstitutionFail(t *testing.T) {
+	check := func(expr, msg string, off int) {
+		_, err := ParseSubstitution(expr)
+		switch {
+		case err == nil:
+			t.Error(expr)
+		case err.Message != msg:
+			t.Error(expr, "Message", err.Message)
+		case err.Offset != off:
+			t.Error(expr, "Offset", err.Offset)
+		case err.Pattern != expr:
+			t.Error(expr, "Pattern", err.Pattern)
+		}
+	}
+	check(`m/a/b/`, "not a substitution", 0)
+	check(`s/a/b`, "missing terminating /", 5)
+	check(`s/a(/b/`, "missing )", 4)
+	check(`s/a/$1/`, "reference to non-existent group 1", 4)
+	check(`s/(a)/\2/`, "reference to non-existent group", 6)
+	check(`s/a/${x}/`, "reference to non-existent group x", 4)
+	check(`s/a/b/ge`, "modifier e is not supported", 7)
+	check(`s/a/b/gq`, `unknown modifier 'q'`, 7)
+	check(`tr/a/b/x`, `unknown modifier 'x'`, 7)
+	check(`s/a/b/gg`, `repeated modifier 'g'`, 7)
+	check(`s/a/b/ii`, `repeated modifier 'i'`, 7)
+	check(`tr/a/b/dd`, `repeated modifier 'd'`, 8)
+	check(`tr/z-a//`, `invalid range "z-a"`, 3)
+	check(`tr/a/c-b/`, `invalid range "c-b"`, 5)
+}
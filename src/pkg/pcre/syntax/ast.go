@@ -0,0 +1,256 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package syntax
+
+// A byte range [Start, End) in the pattern.
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// A node of the syntax tree.  The concrete types are the pointer
+// types defined in this file.
+type Node interface {
+	// Returns the part of the pattern which the node was parsed
+	// from.
+	Span() Span
+	// Returns the compile flags in effect for the node, including
+	// those set by inline options such as (?i).
+	Flags() int
+}
+
+type node struct {
+	span  Span
+	flags int
+}
+
+func (n *node) Span() Span { return n.span }
+func (n *node) Flags() int { return n.flags }
+
+// A literal character.  Without UTF8, Rune is a byte value.
+type Literal struct {
+	node
+	Rune rune
+}
+
+// Any character: ".".
+type Dot struct {
+	node
+}
+
+// A zero-width assertion: ^ or $, or \A, \Z, \z, \b, \B, \G, and \K
+// (which resets the start of the match), given by the letter.
+type Anchor struct {
+	node
+	Kind byte
+}
+
+// A character type escape such as \d, given by the letter: one of
+// dDwWsShHvVRXNC, or p and P with Property set to the name in the
+// braces, such as L or Lu.  A negated property \p{^L} is stored as P.
+type CharType struct {
+	node
+	Kind     byte
+	Property string
+}
+
+// A character class, such as [a-z\d].  The items are *Literal,
+// *Range, *CharType and *Posix nodes.
+type Class struct {
+	node
+	Negated bool
+	Items   []Node
+}
+
+// A range of characters in a class.
+type Range struct {
+	node
+	Lo, Hi rune
+}
+
+// A POSIX class inside a class, such as [:alpha:] or [:^digit:].
+type Posix struct {
+	node
+	Name    string
+	Negated bool
+}
+
+// A sequence of nodes which match one after the other.
+type Concat struct {
+	node
+	Items []Node
+}
+
+// Alternatives separated by |.
+type Alternation struct {
+	node
+	Alts []Node
+}
+
+// A quantified node.  Max is -1 for no upper limit.  Lazy and
+// Possessive record a ? or + after the quantifier; UNGREEDY in Flags
+// reverses the meaning of Lazy.
+type Repeat struct {
+	node
+	Sub        Node
+	Min, Max   int
+	Lazy       bool
+	Possessive bool
+}
+
+// The kind of a group.
+type GroupKind int
+
+const (
+	Capture            GroupKind = iota // (...), (?<name>...)
+	NonCapture                          // (?:...), or (...) with NO_AUTO_CAPTURE
+	BranchReset                         // (?|...)
+	Atomic                              // (?>...)
+	Lookahead                           // (?=...)
+	NegativeLookahead                   // (?!...)
+	Lookbehind                          // (?<=...)
+	NegativeLookbehind                  // (?<!...)
+	OptionGroup                         // (?i-s:...)
+)
+
+// A parenthesized group.  Index and Name are set for capture groups,
+// On and Off for option groups, which set and clear the letters of
+// the inline options.
+type Group struct {
+	node
+	Kind    GroupKind
+	Index   int
+	Name    string
+	On, Off string
+	Sub     Node
+}
+
+// Inline options which apply to the rest of the enclosing group:
+// (?i), (?-x) and so on.
+type SetOptions struct {
+	node
+	On, Off string
+}
+
+// A back reference, such as \1, \g{-1} or \k<name>.  Index is the
+// absolute group number; for named references, it is the first group
+// with that name.
+type Backref struct {
+	node
+	Index int
+	Name  string
+}
+
+// A recursion or subroutine call, such as (?R), (?1), (?-1) or
+// (?&name).  Index 0 is the whole pattern.
+type Recursion struct {
+	node
+	Index int
+	Name  string
+}
+
+// The kind of the condition of a Conditional.
+type ConditionKind int
+
+const (
+	CondGroup     ConditionKind = iota // (?(1)...), (?(<name>)...)
+	CondRecursion                      // (?(R)...), (?(R1)...), (?(R&name)...)
+	CondDefine                         // (?(DEFINE)...)
+	CondAssert                         // (?(?=...)...)
+)
+
+// A conditional group (?(condition)yes|no).  Index and Name refer to
+// a group for CondGroup and CondRecursion, where Index 0 and no Name
+// stands for any recursion; Assert is the assertion for CondAssert.
+// No is nil if there is only one branch.
+type Conditional struct {
+	node
+	Cond   ConditionKind
+	Index  int
+	Name   string
+	Assert *Group
+	Yes    Node
+	No     Node
+}
+
+// A backtracking control verb such as (*PRUNE) or (*MARK:name), or a
+// setting at the start of the pattern such as (*UTF8) or
+// (*LIMIT_MATCH=100), with the part after : or = in Arg.
+type Verb struct {
+	node
+	Name string
+	Arg  string
+}
+
+// A callout (?C) or (?Cn).
+type Callout struct {
+	node
+	Number int
+}
+
+// A comment: (?#...), or # up to the end of the line in EXTENDED
+// mode.  Text excludes the delimiters.
+type Comment struct {
+	node
+	Text string
+}
+
+// Returns the direct children of n.
+func Children(n Node) []Node {
+	switch n := n.(type) {
+	case *Class:
+		return n.Items
+	case *Concat:
+		return n.Items
+	case *Alternation:
+		return n.Alts
+	case *Repeat:
+		return []Node{n.Sub}
+	case *Group:
+		return []Node{n.Sub}
+	case *Conditional:
+		var c []Node
+		if n.Assert != nil {
+			c = append(c, n.Assert)
+		}
+		c = append(c, n.Yes)
+		if n.No != nil {
+			c = append(c, n.No)
+		}
+		return c
+	}
+	return nil
+}
+
+// Calls f for n and, if f returns true, for its descendants, in the
+// order of the pattern.
+func Walk(n Node, f func(Node) bool) {
+	if f(n) {
+		for _, c := range Children(n) {
+			Walk(c, f)
+		}
+	}
+}
@@ -0,0 +1,488 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package syntax
+
+import (
+	"fmt"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"strconv"
+	"strings"
+)
+
+// A description of a part of a pattern in plain English, with
+// descriptions of its parts as children.  It can be marshalled as
+// JSON.
+type Explanation struct {
+	Text     string         `json:"text"`
+	Pattern  string         `json:"pattern"` // the part of the pattern
+	Span     Span           `json:"span"`
+	Flags    []string       `json:"flags,omitempty"` // for the whole pattern
+	Children []*Explanation `json:"children,omitempty"`
+}
+
+// Returns the explanation as indented text, one part per line.
+func (e *Explanation) String() string {
+	var b strings.Builder
+	e.write(&b, "")
+	return b.String()
+}
+
+func (e *Explanation) write(b *strings.Builder, indent string) {
+	b.WriteString(indent + e.Text + "\n")
+	if len(e.Flags) > 0 {
+		b.WriteString(indent + "  flags: " + strings.Join(e.Flags, ", ") + "\n")
+	}
+	for _, c := range e.Children {
+		c.write(b, indent+"  ")
+	}
+}
+
+// Parses the pattern and explains it.
+func Explain(pattern string, flags int) (*Explanation, *pcre.CompileError) {
+	re, err := Parse(pattern, flags)
+	if err != nil {
+		return nil, err
+	}
+	return re.Explain(), nil
+}
+
+// Descriptions of compile flags.
+var flagnames = []struct {
+	flag        int
+	name, about string
+}{
+	{pcre.CASELESS, "CASELESS", "letters match in either case"},
+	{pcre.MULTILINE, "MULTILINE", "^ and $ match at line breaks"},
+	{pcre.DOTALL, "DOTALL", ". matches newlines"},
+	{pcre.EXTENDED, "EXTENDED", "white space and # comments are ignored"},
+	{pcre.ANCHORED, "ANCHORED", "matches only at the start position"},
+	{pcre.DOLLAR_ENDONLY, "DOLLAR_ENDONLY", "$ matches only at the very end"},
+	{pcre.UNGREEDY, "UNGREEDY", "quantifiers are lazy unless followed by ?"},
+	{pcre.EXTRA, "EXTRA", "unknown escapes are errors"},
+	{pcre.DUPNAMES, "DUPNAMES", "group names may be repeated"},
+	{pcre.NO_AUTO_CAPTURE, "NO_AUTO_CAPTURE", "only named groups capture"},
+	{pcre.UTF8, "UTF8", "pattern and subject are UTF-8"},
+	{pcre.UCP, "UCP", `\d, \w and \s use Unicode properties`},
+	{pcre.FIRSTLINE, "FIRSTLINE", "the match must start in the first line"},
+	{pcre.AUTO_CALLOUT, "AUTO_CALLOUT", "callouts before each item"},
+}
+
+// Descriptions of inline option letters.
+var optionnames = map[byte]string{
+	'i': "case-insensitive", 'm': "multiline", 's': "dot matches newline",
+	'x': "extended", 'J': "duplicate names", 'U': "ungreedy", 'X': "extra",
+}
+
+// Returns an explanation of the whole pattern.
+func (re *Regexp) Explain() *Explanation {
+	e := re.explain(re.Root)
+	root := &Explanation{
+		Text:    "pattern " + strconv.Quote(re.Pattern),
+		Pattern: re.Pattern,
+		Span:    Span{0, len(re.Pattern)},
+	}
+	for _, f := range flagnames {
+		if re.Flags&f.flag != 0 {
+			root.Flags = append(root.Flags, f.name+" ("+f.about+")")
+		}
+	}
+	if _, ok := re.Root.(*Concat); ok {
+		root.Children = e.Children
+	} else {
+		root.Children = []*Explanation{e}
+	}
+	return root
+}
+
+func quotechar(r rune, flags int) string {
+	if flags&pcre.UTF8 == 0 && r >= 0x80 {
+		return fmt.Sprintf(`'\x%02x'`, r)
+	}
+	return strconv.QuoteRune(r)
+}
+
+func quotetext(runes []rune, flags int) string {
+	if flags&pcre.UTF8 != 0 {
+		return strconv.Quote(string(runes))
+	}
+	b := make([]byte, len(runes))
+	for i, r := range runes {
+		b[i] = byte(r)
+	}
+	return strconv.Quote(string(b))
+}
+
+func caseless(flags int) string {
+	if flags&pcre.CASELESS != 0 {
+		return " (ignoring case)"
+	}
+	return ""
+}
+
+// Singular and plural descriptions of character types.
+var chartypes = map[byte][2]string{
+	'd': {"a digit", "digits"},
+	'D': {"a non-digit character", "non-digit characters"},
+	'w': {"a word character", "word characters"},
+	'W': {"a non-word character", "non-word characters"},
+	's': {"a white space character", "white space characters"},
+	'S': {"a non-space character", "non-space characters"},
+	'h': {"a horizontal white space character", "horizontal white space characters"},
+	'H': {"a character other than horizontal white space", "characters other than horizontal white space"},
+	'v': {"a vertical white space character", "vertical white space characters"},
+	'V': {"a character other than vertical white space", "characters other than vertical white space"},
+	'R': {"a line break", "line breaks"},
+	'X': {"an extended grapheme cluster", "extended grapheme clusters"},
+	'N': {"a character other than newline", "characters other than newline"},
+	'C': {"a single byte", "single bytes"},
+}
+
+// Returns the singular and plural descriptions of a node which
+// matches a single character, or false for other nodes.
+func (re *Regexp) leaf(n Node) (one, many string, ok bool) {
+	switch n := n.(type) {
+	case *Literal:
+		q := quotechar(n.Rune, n.flags) + caseless(n.flags)
+		return "the character " + q, q + " characters", true
+	case *Dot:
+		if n.flags&pcre.DOTALL != 0 {
+			return "any character", "any characters", true
+		}
+		return "any character except newline", "any characters except newline", true
+	case *CharType:
+		if d, ok := chartypes[n.Kind]; ok {
+			return d[0], d[1], true
+		}
+		with := "with"
+		if n.Kind == 'P' {
+			with = "without"
+		}
+		return "a character " + with + " property " + n.Property,
+			"characters " + with + " property " + n.Property, true
+	case *Class:
+		var items []string
+		for _, item := range n.Items {
+			switch item := item.(type) {
+			case *Literal:
+				items = append(items, quotechar(item.Rune, item.flags))
+			case *Range:
+				items = append(items, quotechar(item.Lo, item.flags)+" to "+quotechar(item.Hi, item.flags))
+			case *CharType:
+				one, _, _ := re.leaf(item)
+				items = append(items, one)
+			case *Posix:
+				not := ""
+				if item.Negated {
+					not = "not "
+				}
+				items = append(items, "a "+not+item.Name+" character")
+			}
+		}
+		of := "of"
+		if n.Negated {
+			of = "not of"
+		}
+		list := strings.Join(items, ", ") + caseless(n.flags)
+		return "one character " + of + ": " + list, "characters " + of + ": " + list, true
+	}
+	return "", "", false
+}
+
+func quantifier(n *Repeat) string {
+	var s string
+	switch {
+	case n.Min == 0 && n.Max == -1:
+		s = "zero or more"
+	case n.Min == 1 && n.Max == -1:
+		s = "one or more"
+	case n.Min == 0 && n.Max == 1:
+		s = "optionally"
+	case n.Max == -1:
+		s = fmt.Sprintf("%d or more", n.Min)
+	case n.Min == n.Max:
+		s = fmt.Sprintf("exactly %d", n.Min)
+	default:
+		s = fmt.Sprintf("between %d and %d", n.Min, n.Max)
+	}
+	return s
+}
+
+func (re *Regexp) group(n *Group) string {
+	switch n.Kind {
+	case Capture:
+		if n.Name != "" {
+			return "named group '" + n.Name + "'"
+		}
+		return fmt.Sprintf("group %d", n.Index)
+	case NonCapture:
+		return "group"
+	case BranchReset:
+		return "branch reset group, alternatives share group numbers"
+	case Atomic:
+		return "atomic group, no backtracking into it"
+	case Lookahead:
+		return "followed by"
+	case NegativeLookahead:
+		return "not followed by"
+	case Lookbehind:
+		return "preceded by"
+	case NegativeLookbehind:
+		return "not preceded by"
+	}
+	return "group with " + re.options(n.On, n.Off)
+}
+
+func (re *Regexp) options(on, off string) string {
+	var s []string
+	for i := 0; i < len(on); i++ {
+		s = append(s, optionnames[on[i]]+" on")
+	}
+	for i := 0; i < len(off); i++ {
+		s = append(s, optionnames[off[i]]+" off")
+	}
+	return "options " + strings.Join(s, ", ")
+}
+
+func (re *Regexp) reference(index int, name string) string {
+	if name != "" {
+		return "group '" + name + "'"
+	}
+	return fmt.Sprintf("group %d", index)
+}
+
+func (re *Regexp) anchor(n *Anchor) string {
+	switch n.Kind {
+	case '^':
+		if n.flags&pcre.MULTILINE != 0 {
+			return "start of a line"
+		}
+		return "start of the subject"
+	case '$':
+		switch {
+		case n.flags&pcre.MULTILINE != 0:
+			return "end of a line"
+		case n.flags&pcre.DOLLAR_ENDONLY != 0:
+			return "end of the subject"
+		}
+		return "end of the subject, or before a final newline"
+	case 'A':
+		return "start of the subject"
+	case 'Z':
+		return "end of the subject, or before a final newline"
+	case 'z':
+		return "end of the subject"
+	case 'b':
+		return "word boundary"
+	case 'B':
+		return "not a word boundary"
+	case 'G':
+		return "position where the match attempt started"
+	}
+	return "reset the start of the reported match to here"
+}
+
+// Descriptions of verbs without arguments.
+var verbnames = map[string]string{
+	"ACCEPT":          "end the match successfully",
+	"FAIL":            "fail and backtrack",
+	"F":               "fail and backtrack",
+	"COMMIT":          "fail the whole match if backtracked into",
+	"PRUNE":           "fail at the current start position if backtracked into",
+	"SKIP":            "continue after this position if backtracked into",
+	"THEN":            "try the next alternative if backtracked into",
+	"UTF8":            "setting: pattern and subject are UTF-8",
+	"UTF":             "setting: pattern and subject are UTF-8",
+	"UCP":             `setting: \d, \w and \s use Unicode properties`,
+	"CR":              "setting: newline is CR",
+	"LF":              "setting: newline is LF",
+	"CRLF":            "setting: newline is CRLF",
+	"ANYCRLF":         "setting: newline is CR, LF or CRLF",
+	"ANY":             "setting: newline is any Unicode line break",
+	"BSR_ANYCRLF":     `setting: \R matches CR, LF or CRLF`,
+	"BSR_UNICODE":     `setting: \R matches any Unicode line break`,
+	"NO_START_OPT":    "setting: no start-of-match optimizations",
+	"NO_AUTO_POSSESS": "setting: no automatic possessification",
+	"LIMIT_MATCH":     "setting: match limit",
+	"LIMIT_RECURSION": "setting: recursion limit",
+}
+
+func (re *Regexp) verb(n *Verb) string {
+	s := verbnames[n.Name]
+	switch {
+	case n.Name == "MARK":
+		return "set the mark to " + strconv.Quote(n.Arg)
+	case n.Arg == "":
+	case strings.HasPrefix(n.Name, "LIMIT_"):
+		s += " " + n.Arg
+	case n.Name == "SKIP":
+		s = "continue after the mark " + strconv.Quote(n.Arg) + " if backtracked into"
+	default:
+		s += ", setting the mark to " + strconv.Quote(n.Arg)
+	}
+	return s
+}
+
+func (re *Regexp) condition(n *Conditional) string {
+	switch n.Cond {
+	case CondGroup:
+		return "if " + re.reference(n.Index, n.Name) + " has matched"
+	case CondRecursion:
+		if n.Index == 0 && n.Name == "" {
+			return "if inside a recursion"
+		}
+		return "if inside a recursion into " + re.reference(n.Index, n.Name)
+	case CondDefine:
+		return "definitions, only used by reference"
+	}
+	return "if the assertion holds"
+}
+
+// Explains a node, which is the child of a node which has been
+// explained.
+func (re *Regexp) explain(n Node) *Explanation {
+	span := n.Span()
+	e := &Explanation{Pattern: re.Pattern[span.Start:span.End], Span: span}
+	if one, _, ok := re.leaf(n); ok {
+		e.Text = one
+		return e
+	}
+	switch n := n.(type) {
+	case *Concat:
+		e.Text = "in sequence"
+		e.Children = re.sequence(n.Items)
+		if len(e.Children) == 1 {
+			return e.Children[0]
+		}
+	case *Alternation:
+		e.Text = "one of"
+		for _, alt := range n.Alts {
+			e.Children = append(e.Children, re.explain(alt))
+		}
+	case *Repeat:
+		e.Text = quantifier(n)
+		lazy := n.Lazy != (n.flags&pcre.UNGREEDY != 0)
+		switch {
+		case n.Possessive:
+			e.Text += " (possessive)"
+		case lazy && n.Min != n.Max:
+			e.Text += " (lazy)"
+		}
+		if one, many, ok := re.leaf(n.Sub); ok {
+			if n.Max == 1 {
+				e.Text += " " + one
+			} else {
+				e.Text += " " + many
+			}
+		} else {
+			e.Text += " of"
+			e.Children = re.body(n.Sub)
+		}
+	case *Group:
+		e.Text = re.group(n)
+		e.Children = re.body(n.Sub)
+		if len(e.Children) == 1 && len(e.Children[0].Children) == 0 {
+			e.Text += ": " + e.Children[0].Text
+			e.Children = nil
+		}
+	case *Anchor:
+		e.Text = re.anchor(n)
+	case *SetOptions:
+		e.Text = "set " + re.options(n.On, n.Off) + " for the rest of the group"
+	case *Backref:
+		e.Text = "the text matched by " + re.reference(n.Index, n.Name)
+	case *Recursion:
+		if n.Index == 0 && n.Name == "" {
+			e.Text = "the whole pattern, recursively"
+		} else {
+			e.Text = "the pattern of " + re.reference(n.Index, n.Name)
+		}
+	case *Conditional:
+		e.Text = re.condition(n)
+		if n.Assert != nil {
+			e.Children = append(e.Children, re.explain(n.Assert))
+		}
+		if n.Cond == CondDefine {
+			e.Children = append(e.Children, re.body(n.Yes)...)
+			break
+		}
+		then := re.explain(n.Yes)
+		then.Text = "then " + then.Text
+		e.Children = append(e.Children, then)
+		if n.No != nil {
+			no := re.explain(n.No)
+			no.Text = "else " + no.Text
+			e.Children = append(e.Children, no)
+		}
+	case *Verb:
+		e.Text = re.verb(n)
+	case *Callout:
+		e.Text = fmt.Sprintf("callout %d", n.Number)
+	case *Comment:
+		e.Text = "comment " + strconv.Quote(strings.TrimSpace(n.Text))
+	}
+	return e
+}
+
+// Explains the contents of a group or repetition.
+func (re *Regexp) body(n Node) []*Explanation {
+	if c, ok := n.(*Concat); ok {
+		return re.sequence(c.Items)
+	}
+	return []*Explanation{re.explain(n)}
+}
+
+// Explains the items of a sequence, merging runs of literals.
+func (re *Regexp) sequence(items []Node) []*Explanation {
+	var list []*Explanation
+	for i := 0; i < len(items); {
+		l, ok := items[i].(*Literal)
+		j := i + 1
+		for ok && j < len(items) {
+			m, ok := items[j].(*Literal)
+			if !ok || m.flags&pcre.CASELESS != l.flags&pcre.CASELESS {
+				break
+			}
+			j++
+		}
+		if j-i < 2 {
+			list = append(list, re.explain(items[i]))
+			i++
+			continue
+		}
+		var runes []rune
+		for _, item := range items[i:j] {
+			runes = append(runes, item.(*Literal).Rune)
+		}
+		span := Span{items[i].Span().Start, items[j-1].Span().End}
+		list = append(list, &Explanation{
+			Text:    "the text " + quotetext(runes, l.flags) + caseless(l.flags),
+			Pattern: re.Pattern[span.Start:span.End],
+			Span:    span,
+		})
+		i = j
+	}
+	return list
+}
@@ -0,0 +1,78 @@
+package syntax
+
+import (
+	"encoding/json"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	e, err := Explain(`^(?<host>\S+) (\d{1,3})?[^a-z_\d]*?(?:abc|x)+$`, pcre.CASELESS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `pattern "^(?<host>\\S+) (\\d{1,3})?[^a-z_\\d]*?(?:abc|x)+$"
+  flags: CASELESS (letters match in either case)
+  start of the subject
+  named group 'host': one or more non-space characters
+  the character ' ' (ignoring case)
+  optionally of
+    group 2: between 1 and 3 digits
+  zero or more (lazy) characters not of: 'a' to 'z', '_', a digit (ignoring case)
+  one or more of
+    group
+      one of
+        the text "abc" (ignoring case)
+        the character 'x' (ignoring case)
+  end of the subject, or before a final newline
+`
+	if got := e.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	e, _ = Explain("(?x) a b # comment\n", 0)
+	if got := e.String(); !strings.Contains(got, `the text "ab"`) ||
+		!strings.Contains(got, `comment "comment"`) ||
+		!strings.Contains(got, "set options extended on") {
+		t.Error(got)
+	}
+
+	e, _ = Explain(`(a)(?(1)b|(?&n))(?<n>c)(*SKIP)\1`, pcre.UTF8|pcre.EXTENDED)
+	got := e.String()
+	for _, s := range []string{
+		"EXTENDED (white space and # comments are ignored)",
+		"if group 1 has matched",
+		"then the character 'b'",
+		"else the pattern of group 'n'",
+		"continue after this position if backtracked into",
+		"the text matched by group 1",
+	} {
+		if !strings.Contains(got, s) {
+			t.Errorf("%q not in\n%s", s, got)
+		}
+	}
+}
+
+func TestExplainJSON(t *testing.T) {
+	e, _ := Explain(`a(b|c)`, 0)
+	b, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v struct {
+		Children []struct {
+			Text     string
+			Pattern  string
+			Span     Span
+			Children []json.RawMessage
+		}
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Children) != 2 || v.Children[1].Pattern != "(b|c)" ||
+		v.Children[1].Span != (Span{1, 6}) || len(v.Children[1].Children) != 1 {
+		t.Errorf("%s", b)
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package syntax
+
+import (
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// Rewrites the pattern for EXTENDED mode, with groups and
+// alternatives on lines of their own, indented by nesting level, and
+// comments aligned after the items.  The result must be compiled with
+// flags|pcre.EXTENDED.  Returns an error if the result does not
+// compile to a pattern with the same Info as the original.
+func Format(pattern string, flags int) (string, error) {
+	re, err := Parse(pattern, flags)
+	if err != nil {
+		return "", err
+	}
+	s := re.Format()
+	if err := equivalent(pattern, flags, s, flags|pcre.EXTENDED); err != nil {
+		return "", err
+	}
+	return s, nil
+}
+
+// Rewrites the pattern on a single line, without white space and
+// comments.  The result must be compiled with flags&^pcre.EXTENDED.
+// Returns an error if the result does not compile to a pattern with
+// the same Info as the original.
+func Minify(pattern string, flags int) (string, error) {
+	re, err := Parse(pattern, flags)
+	if err != nil {
+		return "", err
+	}
+	s := re.Minify()
+	if err := equivalent(pattern, flags, s, flags&^pcre.EXTENDED); err != nil {
+		return "", err
+	}
+	return s, nil
+}
+
+// Compiles two patterns and checks that they have the same Info,
+// apart from EXTENDED, and the same group names.
+func equivalent(pattern1 string, flags1 int, pattern2 string, flags2 int) error {
+	re1, err := pcre.Compile(pattern1, flags1)
+	if err != nil {
+		return err
+	}
+	re2, err := pcre.Compile(pattern2, flags2)
+	if err != nil {
+		return errors.Wrapf(err, "syntax: rewritten pattern %q", pattern2)
+	}
+	info1, info2 := re1.Info(), re2.Info()
+	info1.Options &^= pcre.EXTENDED
+	info2.Options &^= pcre.EXTENDED
+	if info1 != info2 {
+		return errors.Errorf("syntax: rewritten pattern %q differs: %+v, want %+v",
+			pattern2, info2, info1)
+	}
+	names := re2.NamedGroups()
+	for name, index := range re1.NamedGroups() {
+		if names[name] != index {
+			return errors.Errorf("syntax: rewritten pattern %q lacks group %q", pattern2, name)
+		}
+	}
+	return nil
+}
+
+type line struct {
+	depth   int
+	text    string
+	comment string
+}
+
+type formatter struct {
+	lines []line
+	skip  map[Node]bool
+}
+
+// Returns the pattern in the layout described for Format.
+func (re *Regexp) Format() string {
+	f := formatter{skip: make(map[Node]bool)}
+	// Settings such as (*UTF8) must stay at the very start.
+	first, end := re.Root, 0
+	if a, ok := first.(*Alternation); ok {
+		first = a.Alts[0]
+	}
+	items := []Node{first}
+	if c, ok := first.(*Concat); ok {
+		items = c.Items
+	}
+	var settings strings.Builder
+	for _, n := range items {
+		v, ok := n.(*Verb)
+		if !ok || v.span.Start != end {
+			break
+		}
+		if _, start := startverbs[v.Name]; !start {
+			break
+		}
+		settings.WriteString(atom(v))
+		f.skip[v] = true
+		end = v.span.End
+	}
+	if settings.Len() > 0 {
+		f.add(0, settings.String())
+	}
+	if _, ok := re.Root.(*Alternation); ok {
+		f.body(re.Root, 1)
+	} else {
+		f.body(re.Root, 0)
+	}
+	width := 0
+	for _, l := range f.lines {
+		if w := 2*l.depth + len(l.text); l.comment != "" && w > width {
+			width = w
+		}
+	}
+	var b strings.Builder
+	for i, l := range f.lines {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		s := strings.Repeat("  ", l.depth) + l.text
+		if l.comment != "" {
+			if l.text != "" {
+				s += strings.Repeat(" ", width-len(s)+2)
+			}
+			s += "# " + l.comment
+		}
+		b.WriteString(s)
+	}
+	return b.String()
+}
+
+func (f *formatter) add(depth int, text string) {
+	f.lines = append(f.lines, line{depth: depth, text: text})
+}
+
+// Renders a node which is kept on one line.
+func atom(n Node) string {
+	p := printer{noextended: true}
+	p.write(n)
+	return p.String()
+}
+
+// Returns true if n is kept on one line: it contains no
+// alternatives, conditionals or comments, and no nested groups.
+func simple(n Node) bool {
+	if r, ok := n.(*Repeat); ok {
+		n = r.Sub
+	}
+	ok := true
+	Walk(n, func(c Node) bool {
+		switch c.(type) {
+		case *Alternation, *Conditional, *Comment:
+			ok = false
+		case *Group:
+			ok = c == n
+		}
+		return ok
+	})
+	return ok
+}
+
+// Adds the lines for the contents of a group at the given depth.
+func (f *formatter) body(n Node, depth int) {
+	switch n := n.(type) {
+	case *Alternation:
+		for i, alt := range n.Alts {
+			if i > 0 {
+				f.add(depth-1, "|")
+			}
+			f.body(alt, depth)
+		}
+	case *Concat:
+		f.items(n.Items, depth)
+	default:
+		f.items([]Node{n}, depth)
+	}
+}
+
+// Adds the lines for a sequence, with runs of simple items on one
+// line.
+func (f *formatter) items(items []Node, depth int) {
+	open := false
+	for _, n := range items {
+		if f.skip[n] {
+			continue
+		}
+		switch n := n.(type) {
+		case *Comment:
+			text := strings.Join(strings.Fields(n.Text), " ")
+			if len(f.lines) == 0 || f.lines[len(f.lines)-1].comment != "" {
+				f.add(depth, "")
+			}
+			l := &f.lines[len(f.lines)-1]
+			l.comment = text
+			open = false
+		default:
+			if simple(n) {
+				if !open {
+					f.add(depth, "")
+					open = true
+				}
+				f.lines[len(f.lines)-1].text += atom(n)
+			} else {
+				f.block(n, depth)
+				open = false
+			}
+		}
+	}
+}
+
+// Adds the lines for a group or conditional, possibly quantified.
+func (f *formatter) block(n Node, depth int) {
+	switch n := n.(type) {
+	case *Repeat:
+		f.block(n.Sub, depth)
+		var p printer
+		p.quantifier(n)
+		f.lines[len(f.lines)-1].text += p.String()
+	case *Group:
+		p := printer{noextended: true}
+		p.open(n)
+		f.add(depth, p.String())
+		f.body(n.Sub, depth+1)
+		f.add(depth, ")")
+	case *Conditional:
+		p := printer{noextended: true}
+		p.open(n)
+		f.add(depth, p.String())
+		f.body(n.Yes, depth+1)
+		if n.No != nil {
+			f.add(depth, "|")
+			f.body(n.No, depth+1)
+		}
+		f.add(depth, ")")
+	default:
+		f.add(depth, atom(n))
+	}
+}
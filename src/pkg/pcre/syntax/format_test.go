@@ -0,0 +1,102 @@
+package syntax
+
+import (
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	check := func(pattern string, flags int, want string) {
+		got, err := Format(pattern, flags)
+		if err != nil {
+			t.Error(pattern, err)
+		} else if got != want {
+			t.Errorf("%q: got\n%s\nwant\n%s", pattern, got, want)
+		}
+	}
+	check(`^(?<host>[^:]+):(\d+)$`, 0, `^(?<host>[^\:]+)\:(\d+)$`)
+	check(`(?:GET|POST) (/\S*)(?: HTTP/(1\.[01]))?`, 0, `(?:
+  GET
+|
+  POST
+)
+\ (\/\S*)
+(?:
+  \ HTTP\/(1\.[01])
+)?`)
+	check("a|b # alternatives\n", pcre.EXTENDED, `  a
+|
+  b  # alternatives`)
+	check("(?x) ( \\d+ )  # number\n  (?: , (\\d+) )* # more\n", 0, `(\d+)  # number
+(?:
+  \,(\d+)
+)*     # more`)
+	check(`(*UTF8)a|b`, 0, `(*UTF8)
+  a
+|
+  b`)
+	check(`(a)?(?(1)b|(?#none)c)`, 0, `(a)?
+(?(1)
+  b
+|  # none
+  c
+)`)
+}
+
+func TestMinify(t *testing.T) {
+	check := func(pattern string, flags int, want string) {
+		got, err := Minify(pattern, flags)
+		if err != nil {
+			t.Error(pattern, err)
+		} else if got != want {
+			t.Errorf("%q: got %q, want %q", pattern, got, want)
+		}
+	}
+	check("(?<host> [^:\\s]+ ) : (\\d+) # port\n", pcre.EXTENDED, `(?<host>[^:\s]+):(\d+)`)
+	check("a\\ b[\\ -\\-] \\# (?x: c d ) (?-x) e", pcre.EXTENDED, `a b[ -\-]#(?:cd) e`)
+	check(`x{1,}\Q.*\E(?#c)\x41[\]\^]`, 0, `x+\.\*A[\]\^]`)
+}
+
+// Subjects for comparing rewritten patterns with the originals.
+var subjects = []string{
+	"", "a", "abc", "aaa", "ab12cd", "2011-12-13", "a b c", "x\ny", "(a)",
+	"[x]", "AbC", "éà", "hello world", "ae", "bcd", "a.b", "jk", "d e f",
+}
+
+func TestFormatCorpus(t *testing.T) {
+	for _, c := range corpus {
+		formatted, err := Format(c.pattern, c.flags)
+		if err != nil {
+			t.Errorf("%q: %v", c.pattern, err)
+			continue
+		}
+		minified, err := Minify(c.pattern, c.flags)
+		if err != nil {
+			t.Errorf("%q: %v", c.pattern, err)
+			continue
+		}
+		re := pcre.MustCompile(c.pattern, c.flags)
+		same(t, re, pcre.MustCompile(formatted, c.flags|pcre.EXTENDED))
+		same(t, re, pcre.MustCompile(minified, c.flags&^pcre.EXTENDED))
+		if again, err := Minify(formatted, c.flags|pcre.EXTENDED); err != nil || again != minified {
+			t.Errorf("%q: minified %q, then %q, %v", c.pattern, minified, again, err)
+		}
+	}
+}
+
+// Checks that re2 matches the subjects like re1.
+func same(t *testing.T, re1, re2 pcre.Regexp) {
+	for _, s := range subjects {
+		m1, err1 := re1.MatcherString(s, 0)
+		m2, err2 := re2.MatcherString(s, 0)
+		if err1 != nil || err2 != nil || m1.Matches() != m2.Matches() {
+			t.Errorf("%q, %q: %q: %v, %v", re1, re2, s, err1, err2)
+			continue
+		}
+		for i := 0; m1.Matches() && i <= m1.Groups(); i++ {
+			if g1, g2 := m1.GroupIndex(i), m2.GroupIndex(i); len(g1) != len(g2) || len(g1) == 2 && g1[0] != g2[0] {
+				t.Errorf("%q, %q: %q: group %d: %v, %v", re1, re2, s, i, g1, g2)
+			}
+		}
+	}
+}
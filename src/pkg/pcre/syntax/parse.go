@@ -0,0 +1,1109 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package syntax parses patterns of package pcre into syntax trees.
+//
+// Parse understands the PCRE1 pattern language: literals and escapes,
+// character classes, groups of all kinds, quantifiers, back
+// references, recursion and subroutine calls, conditionals,
+// backtracking control verbs, callouts, comments and inline options,
+// including the effect of EXTENDED and UTF8 on parsing.  Every node
+// records its span in the pattern and the flags in effect for it.
+// String turns a tree back into an equivalent pattern, and
+// Regexp.Verify cross-checks the parser against pcre.Compile.
+package syntax
+
+import (
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A parsed pattern.
+type Regexp struct {
+	Pattern string
+	Flags   int // as passed to Parse
+	Root    Node
+	Groups  int            // number of capture groups
+	Names   map[string]int // first group number for each name
+	groups  []*Group       // by number; the first group for numbers shared in (?|...)
+}
+
+// Returns the capture group with the given number, or nil.
+func (re *Regexp) Group(index int) *Group {
+	if index <= 0 || index >= len(re.groups) {
+		return nil
+	}
+	return re.groups[index]
+}
+
+// A parse error, turned into a *pcre.CompileError by Parse.
+type parseerror struct {
+	offset  int
+	message string
+}
+
+type parser struct {
+	src      string
+	pos      int
+	flags    int // current flags, including inline options
+	groups   int // capture groups opened so far
+	names    map[string]int
+	nodes    []*Group // capture groups by number
+	refs     []Node   // references to resolve at the end
+	behind   []*Group // lookbehind assertions to check
+	verbsend int      // end of the settings at the start of the pattern
+}
+
+func (p *parser) fail(offset int, message string) {
+	panic(parseerror{offset, message})
+}
+
+func (p *parser) more() bool {
+	return p.pos < len(p.src)
+}
+
+func (p *parser) peek() byte {
+	return p.src[p.pos]
+}
+
+func (p *parser) has(prefix string) bool {
+	return strings.HasPrefix(p.src[p.pos:], prefix)
+}
+
+func (p *parser) node(start int) node {
+	return node{span: Span{start, p.pos}, flags: p.flags}
+}
+
+// Returns the next character: a rune with UTF8 and a byte otherwise.
+func (p *parser) next() rune {
+	if p.flags&pcre.UTF8 == 0 {
+		p.pos++
+		return rune(p.src[p.pos-1])
+	}
+	r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+	if r == utf8.RuneError && size <= 1 {
+		p.fail(p.pos, "invalid UTF-8 string")
+	}
+	p.pos += size
+	return r
+}
+
+// Parses the pattern with the specified compile flags.  Errors are
+// reported with messages in the style of PCRE, although they do not
+// always agree with those of Compile.
+func Parse(pattern string, flags int) (re *Regexp, cerr *pcre.CompileError) {
+	p := &parser{src: pattern, flags: flags, names: make(map[string]int)}
+	p.nodes = []*Group{nil}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(parseerror)
+			if !ok {
+				panic(r)
+			}
+			re, cerr = nil, &pcre.CompileError{
+				Pattern: pattern,
+				Message: e.message,
+				Offset:  e.offset,
+			}
+		}
+	}()
+	if strings.IndexByte(pattern, 0) >= 0 {
+		p.fail(strings.IndexByte(pattern, 0), "NUL byte in pattern")
+	}
+	root := p.alternation(false)
+	if p.more() {
+		p.fail(p.pos, "unmatched parentheses")
+	}
+	re = &Regexp{
+		Pattern: pattern,
+		Flags:   flags,
+		Root:    root,
+		Groups:  p.groups,
+		Names:   p.names,
+		groups:  p.nodes,
+	}
+	p.resolve()
+	for _, g := range p.behind {
+		alts := []Node{g.Sub}
+		if a, ok := g.Sub.(*Alternation); ok {
+			alts = a.Alts
+		}
+		for _, alt := range alts {
+			if min, max := re.Width(alt); min != max {
+				p.fail(g.span.Start, "lookbehind assertion is not fixed length")
+			}
+		}
+	}
+	return re, nil
+}
+
+// Like Parse, but panics if the pattern cannot be parsed.
+func MustParse(pattern string, flags int) *Regexp {
+	re, err := Parse(pattern, flags)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+// Resolves named references and checks that referenced groups exist.
+func (p *parser) resolve() {
+	lookup := func(n Node, index *int, name string) {
+		if name != "" {
+			i, ok := p.names[name]
+			if !ok {
+				p.fail(n.Span().Start, "reference to non-existent subpattern")
+			}
+			*index = i
+		} else if *index > p.groups {
+			p.fail(n.Span().Start, "reference to non-existent subpattern")
+		}
+	}
+	for _, n := range p.refs {
+		switch n := n.(type) {
+		case *Backref:
+			lookup(n, &n.Index, n.Name)
+		case *Recursion:
+			lookup(n, &n.Index, n.Name)
+		case *Conditional:
+			if n.Cond == CondGroup || n.Cond == CondRecursion {
+				lookup(n, &n.Index, n.Name)
+			}
+		}
+	}
+}
+
+// Parses alternatives up to ) or the end of the pattern.  In a branch
+// reset group, each alternative numbers its groups from the same
+// start.
+func (p *parser) alternation(reset bool) Node {
+	start, flags := p.pos, p.flags
+	base, max := p.groups, p.groups
+	var alts []Node
+	for {
+		alts = append(alts, p.concat())
+		if p.groups > max {
+			max = p.groups
+		}
+		if !p.more() || p.peek() != '|' {
+			break
+		}
+		p.pos++
+		if reset {
+			p.groups = base
+		}
+	}
+	p.groups = max
+	if len(alts) == 1 {
+		return alts[0]
+	}
+	return &Alternation{node: node{span: Span{start, p.pos}, flags: flags}, Alts: alts}
+}
+
+func isspace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\v' || c == '\f' || c == '\r'
+}
+
+// In EXTENDED mode, skips white space and adds comments to items.
+func (p *parser) skipextended(items *[]Node) {
+	for p.flags&pcre.EXTENDED != 0 && p.more() {
+		switch c := p.peek(); {
+		case isspace(c):
+			p.pos++
+		case c == '#':
+			start := p.pos
+			end := strings.IndexByte(p.src[p.pos:], '\n')
+			if end < 0 {
+				end = len(p.src) - p.pos
+			}
+			p.pos += end
+			*items = append(*items, &Comment{node: p.node(start), Text: p.src[start+1 : p.pos]})
+		default:
+			return
+		}
+	}
+}
+
+// Parses a sequence up to |, ) or the end of the pattern.
+func (p *parser) concat() Node {
+	start, flags := p.pos, p.flags
+	var items []Node
+	for {
+		p.skipextended(&items)
+		if !p.more() || p.peek() == '|' || p.peek() == ')' {
+			break
+		}
+		switch c := p.peek(); {
+		case c == '*' || c == '+' || c == '?' || c == '{' && p.isquantifier():
+			p.repeat(items)
+		case p.has(`\Q`):
+			p.pos += 2
+			for p.more() && !p.has(`\E`) {
+				s := p.pos
+				r := p.next()
+				items = append(items, &Literal{node: p.node(s), Rune: r})
+			}
+			if p.more() {
+				p.pos += 2
+			}
+		case p.has(`\E`):
+			p.pos += 2
+		default:
+			items = append(items, p.atom())
+		}
+	}
+	if len(items) == 1 {
+		return items[0]
+	}
+	return &Concat{node: node{span: Span{start, p.pos}, flags: flags}, Items: items}
+}
+
+// Returns true if a { at the current position starts a quantifier.
+func (p *parser) isquantifier() bool {
+	i := p.pos + 1
+	digits := func() int {
+		j := i
+		for i < len(p.src) && '0' <= p.src[i] && p.src[i] <= '9' {
+			i++
+		}
+		return i - j
+	}
+	if digits() == 0 {
+		return false
+	}
+	if i < len(p.src) && p.src[i] == ',' {
+		i++
+		digits()
+	}
+	return i < len(p.src) && p.src[i] == '}'
+}
+
+func (p *parser) number(max int, message string) int {
+	start := p.pos
+	n := 0
+	for p.more() && '0' <= p.peek() && p.peek() <= '9' {
+		n = n*10 + int(p.peek()-'0')
+		if n > max {
+			p.fail(start, message)
+		}
+		p.pos++
+	}
+	return n
+}
+
+// Parses a quantifier and applies it to the last item.
+func (p *parser) repeat(items []Node) {
+	start := p.pos
+	min, max := 0, -1
+	switch p.peek() {
+	case '*':
+		p.pos++
+	case '+':
+		p.pos++
+		min = 1
+	case '?':
+		p.pos++
+		max = 1
+	default:
+		const toobig = "number too big in {} quantifier"
+		p.pos++
+		min = p.number(65535, toobig)
+		max = min
+		if p.peek() == ',' {
+			p.pos++
+			max = -1
+			if p.peek() != '}' {
+				max = p.number(65535, toobig)
+				if max < min {
+					p.fail(p.pos, "numbers out of order in {} quantifier")
+				}
+			}
+		}
+		p.pos++
+	}
+	i := len(items) - 1
+	for i >= 0 {
+		if _, ok := items[i].(*Comment); !ok {
+			break
+		}
+		i--
+	}
+	if i < 0 {
+		p.fail(start, "nothing to repeat")
+	}
+	switch items[i].(type) {
+	case *Repeat, *Anchor, *SetOptions, *Verb, *Callout:
+		p.fail(start, "nothing to repeat")
+	}
+	sub := items[i]
+	r := &Repeat{Sub: sub, Min: min, Max: max}
+	if p.more() && p.peek() == '?' {
+		r.Lazy = true
+		p.pos++
+	} else if p.more() && p.peek() == '+' {
+		r.Possessive = true
+		p.pos++
+	}
+	r.node = p.node(sub.Span().Start)
+	items[i] = r
+}
+
+// Parses a single item.
+func (p *parser) atom() Node {
+	start := p.pos
+	switch p.peek() {
+	case '(':
+		return p.group()
+	case '[':
+		return p.class()
+	case '\\':
+		return p.escape(false)
+	case '.':
+		p.pos++
+		return &Dot{node: p.node(start)}
+	case '^', '$':
+		p.pos++
+		return &Anchor{node: p.node(start), Kind: p.src[start]}
+	}
+	r := p.next()
+	return &Literal{node: p.node(start), Rune: r}
+}
+
+func ishex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func isalnum(c byte) bool {
+	return '0' <= c && c <= '9' || 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z'
+}
+
+// Checks the value of a \x{...} or \o{...} escape.
+func (p *parser) checkcode(start int, v int64) rune {
+	switch {
+	case p.flags&pcre.UTF8 == 0 && v > 0xff,
+		v > utf8.MaxRune:
+		p.fail(start, "character value in \\x{} or \\o{} is too large")
+	case p.flags&pcre.UTF8 != 0 && 0xd800 <= v && v <= 0xdfff:
+		p.fail(start, "disallowed Unicode code point (>= 0xd800 && <= 0xdfff)")
+	}
+	return rune(v)
+}
+
+// Parses a braced, angle-bracketed or quoted name or number after \g
+// or \k, or a plain number after \g.  Returns the text and whether it
+// was in angle brackets or quotes.
+func (p *parser) reference(start int) (string, bool) {
+	if !p.more() {
+		return "", false
+	}
+	var close byte
+	switch p.peek() {
+	case '{':
+		close = '}'
+	case '<':
+		close = '>'
+	case '\'':
+		close = '\''
+	default:
+		s := p.pos
+		if p.peek() == '-' || p.peek() == '+' {
+			p.pos++
+		}
+		for p.more() && '0' <= p.peek() && p.peek() <= '9' {
+			p.pos++
+		}
+		return p.src[s:p.pos], false
+	}
+	end := strings.IndexByte(p.src[p.pos+1:], close)
+	if end < 0 {
+		p.fail(p.pos, "syntax error in subpattern name (missing terminator)")
+	}
+	text := p.src[p.pos+1 : p.pos+1+end]
+	p.pos += end + 2
+	return text, close != '}'
+}
+
+// Resolves a signed group number, which may be relative to the
+// current group count.
+func (p *parser) groupnumber(start int, text string, allowzero bool) int {
+	n, err := strconv.Atoi(text)
+	switch {
+	case err != nil:
+		p.fail(start, "malformed number or name")
+	case n == 0 && !allowzero:
+		p.fail(start, "a numbered reference must not be zero")
+	case text[0] == '-':
+		n = p.groups + n + 1
+		if n <= 0 {
+			p.fail(start, "reference to non-existent subpattern")
+		}
+	case text[0] == '+':
+		n += p.groups
+	}
+	return n
+}
+
+func validname(name string) bool {
+	if name == "" || len(name) > 32 || '0' <= name[0] && name[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isalnum(name[i]) && name[i] != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+func isnumber(s string) bool {
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		s = s[1:]
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// A back reference or subroutine call by name or signed number.
+func (p *parser) namedref(start int, text string, call bool) Node {
+	var n Node
+	switch {
+	case isnumber(text):
+		index := p.groupnumber(start, text, call)
+		if call {
+			n = &Recursion{node: p.node(start), Index: index}
+		} else {
+			n = &Backref{node: p.node(start), Index: index}
+		}
+	case validname(text):
+		if call {
+			n = &Recursion{node: p.node(start), Name: text}
+		} else {
+			n = &Backref{node: p.node(start), Name: text}
+		}
+	default:
+		p.fail(start, "syntax error in subpattern name")
+	}
+	p.refs = append(p.refs, n)
+	return n
+}
+
+// Parses an escape sequence.  In a class, only escapes for characters
+// and character types are allowed.
+func (p *parser) escape(inclass bool) Node {
+	start := p.pos
+	p.pos++
+	if !p.more() {
+		p.fail(p.pos, "\\ at end of pattern")
+	}
+	if p.peek() >= utf8.RuneSelf {
+		r := p.next()
+		return &Literal{node: p.node(start), Rune: r}
+	}
+	c := p.peek()
+	p.pos++
+	literal := func(r rune) Node {
+		return &Literal{node: p.node(start), Rune: r}
+	}
+	invalid := func() {
+		if inclass {
+			p.fail(p.pos-1, "escape sequence is invalid in character class")
+		}
+	}
+	switch c {
+	case 'a':
+		return literal(7)
+	case 'e':
+		return literal(27)
+	case 'f':
+		return literal('\f')
+	case 'n':
+		return literal('\n')
+	case 'r':
+		return literal('\r')
+	case 't':
+		return literal('\t')
+	case 'b':
+		if inclass {
+			return literal('\b')
+		}
+		return &Anchor{node: p.node(start), Kind: c}
+	case 'A', 'Z', 'z', 'G', 'K':
+		if inclass {
+			return literal(rune(c))
+		}
+		return &Anchor{node: p.node(start), Kind: c}
+	case 'B', 'R', 'X':
+		invalid()
+		if c == 'B' {
+			return &Anchor{node: p.node(start), Kind: c}
+		}
+		return &CharType{node: p.node(start), Kind: c}
+	case 'N':
+		invalid()
+		if p.more() && p.peek() == '{' {
+			p.fail(p.pos, "PCRE does not support \\L, \\l, \\N{name}, \\U, or \\u")
+		}
+		return &CharType{node: p.node(start), Kind: c}
+	case 'C':
+		if inclass {
+			return literal('C')
+		}
+		return &CharType{node: p.node(start), Kind: c}
+	case 'd', 'D', 'w', 'W', 's', 'S', 'h', 'H', 'v', 'V':
+		return &CharType{node: p.node(start), Kind: c}
+	case 'p', 'P':
+		name := ""
+		switch {
+		case !p.more():
+			p.fail(p.pos, "malformed \\P or \\p sequence")
+		case p.peek() == '{':
+			end := strings.IndexByte(p.src[p.pos:], '}')
+			if end < 0 {
+				p.fail(p.pos, "malformed \\P or \\p sequence")
+			}
+			name = p.src[p.pos+1 : p.pos+end]
+			p.pos += end + 1
+		default:
+			name = p.src[p.pos : p.pos+1]
+			p.pos++
+		}
+		if strings.HasPrefix(name, "^") {
+			name = name[1:]
+			c ^= 'p' ^ 'P'
+		}
+		if name == "" {
+			p.fail(p.pos, "unknown property name after \\P or \\p")
+		}
+		return &CharType{node: p.node(start), Kind: c, Property: name}
+	case 'x':
+		if p.more() && p.peek() == '{' {
+			end := strings.IndexByte(p.src[p.pos:], '}')
+			if end > 1 {
+				v, err := strconv.ParseInt(p.src[p.pos+1:p.pos+end], 16, 64)
+				if err == nil {
+					p.pos += end + 1
+					return literal(p.checkcode(start, v))
+				}
+			}
+			// Not a valid \x{...}: \x is NUL and { a literal.
+			return literal(0)
+		}
+		v := 0
+		for i := 0; i < 2 && p.more() && ishex(p.peek()); i++ {
+			d, _ := strconv.ParseInt(p.src[p.pos:p.pos+1], 16, 64)
+			v = v*16 + int(d)
+			p.pos++
+		}
+		return literal(rune(v))
+	case 'o':
+		end := strings.IndexByte(p.src[p.pos:], '}')
+		if !p.more() || p.peek() != '{' || end < 0 {
+			p.fail(p.pos, "missing opening brace after \\o")
+		}
+		v, err := strconv.ParseInt(p.src[p.pos+1:p.pos+end], 8, 64)
+		if err != nil {
+			p.fail(p.pos, "non-octal character in \\o{} (closing brace missing?)")
+		}
+		p.pos += end + 1
+		return literal(p.checkcode(start, v))
+	case 'c':
+		if !p.more() {
+			p.fail(p.pos, "\\c at end of pattern")
+		}
+		x := p.peek()
+		if x >= utf8.RuneSelf {
+			p.fail(p.pos, "\\c must be followed by an ASCII character")
+		}
+		p.pos++
+		if 'a' <= x && x <= 'z' {
+			x -= 'a' - 'A'
+		}
+		return literal(rune(x ^ 0x40))
+	case '0':
+		v := 0
+		for i := 0; i < 2 && p.more() && '0' <= p.peek() && p.peek() <= '7'; i++ {
+			v = v*8 + int(p.peek()-'0')
+			p.pos++
+		}
+		return literal(rune(v))
+	case '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		if !inclass {
+			p.pos--
+			s := p.pos
+			n := p.number(1<<30, "number is too big")
+			if n < 10 || n <= p.groups {
+				b := &Backref{node: p.node(start), Index: n}
+				p.refs = append(p.refs, b)
+				return b
+			}
+			p.pos = s + 1
+		}
+		if c >= '8' {
+			return literal(rune(c))
+		}
+		v := int(c - '0')
+		for i := 0; i < 2 && p.more() && '0' <= p.peek() && p.peek() <= '7'; i++ {
+			v = v*8 + int(p.peek()-'0')
+			p.pos++
+		}
+		if p.flags&pcre.UTF8 == 0 && v > 0xff {
+			p.fail(start, "octal value is greater than \\377 in 8-bit non-UTF-8 mode")
+		}
+		return literal(rune(v))
+	case 'g':
+		if inclass {
+			return literal('g')
+		}
+		text, call := p.reference(start)
+		if text == "" || text == "-" || text == "+" {
+			p.fail(p.pos, "a numbered reference must not be zero")
+		}
+		return p.namedref(start, text, call)
+	case 'k':
+		if inclass {
+			return literal('k')
+		}
+		if !p.more() || strings.IndexByte("<'{", p.peek()) < 0 {
+			p.fail(p.pos, "\\k is not followed by a braced, angle-bracketed, or quoted name")
+		}
+		text, _ := p.reference(start)
+		if !validname(text) {
+			p.fail(start, "syntax error in subpattern name")
+		}
+		return p.namedref(start, text, false)
+	case 'L', 'l', 'U', 'u':
+		p.fail(p.pos-1, "PCRE does not support \\L, \\l, \\N{name}, \\U, or \\u")
+	}
+	if isalnum(c) && p.flags&pcre.EXTRA != 0 {
+		p.fail(p.pos-1, "unrecognized character follows \\")
+	}
+	return literal(rune(c))
+}
+
+var posixnames = []string{"alpha", "digit", "alnum", "ascii", "blank", "cntrl",
+	"graph", "lower", "print", "punct", "space", "upper", "word", "xdigit"}
+
+// Parses a character class.
+func (p *parser) class() Node {
+	start := p.pos
+	p.pos++
+	c := &Class{}
+	if p.more() && p.peek() == '^' {
+		c.Negated = true
+		p.pos++
+	}
+	first := true
+	for {
+		if !p.more() {
+			p.fail(p.pos, "missing terminating ] for character class")
+		}
+		if p.peek() == ']' && !first {
+			p.pos++
+			break
+		}
+		first = false
+		istart := p.pos
+		var item Node
+		switch {
+		case p.has(`\Q`):
+			p.pos += 2
+			for p.more() && !p.has(`\E`) {
+				s := p.pos
+				r := p.next()
+				c.Items = append(c.Items, &Literal{node: p.node(s), Rune: r})
+			}
+			if p.more() {
+				p.pos += 2
+			}
+			continue
+		case p.has(`\E`):
+			p.pos += 2
+			continue
+		case p.has("[=") || p.has("[."):
+			p.fail(p.pos, "POSIX collating elements are not supported")
+		case p.has("[:"):
+			end := strings.Index(p.src[p.pos:], ":]")
+			if end < 0 {
+				item = &Literal{node: node{span: Span{p.pos, p.pos + 1}, flags: p.flags}, Rune: '['}
+				p.pos++
+				break
+			}
+			name := p.src[p.pos+2 : p.pos+end]
+			x := &Posix{Name: strings.TrimPrefix(name, "^"), Negated: strings.HasPrefix(name, "^")}
+			known := false
+			for _, n := range posixnames {
+				known = known || n == x.Name
+			}
+			if !known {
+				p.fail(p.pos, "unknown POSIX class name")
+			}
+			p.pos += end + 2
+			x.node = p.node(istart)
+			item = x
+		case p.peek() == '\\':
+			item = p.escape(true)
+		default:
+			r := p.next()
+			item = &Literal{node: p.node(istart), Rune: r}
+		}
+		lo, ok := item.(*Literal)
+		if ok && p.has("-") && p.pos+1 < len(p.src) && p.src[p.pos+1] != ']' {
+			dash := p.pos
+			p.pos++
+			var hi Node
+			switch {
+			case p.has("[:") || p.has(`\Q`) || p.has(`\E`):
+				p.pos = dash
+				c.Items = append(c.Items, item)
+				continue
+			case p.peek() == '\\':
+				hi = p.escape(true)
+			default:
+				s := p.pos
+				r := p.next()
+				hi = &Literal{node: p.node(s), Rune: r}
+			}
+			if h, ok := hi.(*Literal); ok {
+				if h.Rune < lo.Rune {
+					p.fail(p.pos-1, "range out of order in character class")
+				}
+				item = &Range{node: p.node(istart), Lo: lo.Rune, Hi: h.Rune}
+			} else {
+				c.Items = append(c.Items, lo,
+					&Literal{node: node{span: Span{dash, dash + 1}, flags: p.flags}, Rune: '-'})
+				item = hi
+			}
+		}
+		c.Items = append(c.Items, item)
+	}
+	c.node = p.node(start)
+	return c
+}
+
+// Settings at the start of the pattern, and the flags they set.
+var startverbs = map[string]int{
+	"UTF8": pcre.UTF8, "UTF": pcre.UTF8, "UCP": pcre.UCP,
+	"CR": 0, "LF": 0, "CRLF": 0, "ANYCRLF": 0, "ANY": 0,
+	"BSR_ANYCRLF": 0, "BSR_UNICODE": 0, "NO_START_OPT": 0,
+	"NO_AUTO_POSSESS": 0, "LIMIT_MATCH": 0, "LIMIT_RECURSION": 0,
+}
+
+// Backtracking control verbs, and whether they take an argument:
+// 0 never, 1 optionally, 2 always.
+var verbs = map[string]int{
+	"ACCEPT": 0, "FAIL": 0, "F": 0, "COMMIT": 0,
+	"PRUNE": 1, "SKIP": 1, "THEN": 1, "MARK": 2,
+}
+
+// Parses a verb (*...).
+func (p *parser) verb() Node {
+	start := p.pos
+	end := strings.IndexByte(p.src[p.pos:], ')')
+	if end < 0 {
+		p.fail(len(p.src), "(*VERB) not recognized or malformed")
+	}
+	text := p.src[p.pos+2 : p.pos+end]
+	p.pos += end + 1
+	v := &Verb{node: p.node(start), Name: text}
+	if i := strings.IndexAny(text, ":="); i >= 0 {
+		v.Name, v.Arg = text[:i], text[i+1:]
+		if v.Name == "" && text[i] == ':' {
+			v.Name = "MARK"
+		}
+	}
+	if flag, ok := startverbs[v.Name]; ok && start == p.verbsend {
+		limit := strings.HasPrefix(v.Name, "LIMIT_")
+		if limit != (v.Arg != "" && isnumber(v.Arg)) || !limit && v.Arg != "" {
+			p.fail(start, "(*VERB) not recognized or malformed")
+		}
+		p.verbsend = p.pos
+		p.flags |= flag
+		v.flags = p.flags
+		return v
+	}
+	arg, ok := verbs[v.Name]
+	switch {
+	case !ok || strings.ContainsRune(text, '='):
+		p.fail(start, "(*VERB) not recognized or malformed")
+	case arg == 0 && v.Arg != "":
+		p.fail(start, "an argument is not allowed for (*ACCEPT), (*FAIL), or (*COMMIT)")
+	case arg == 2 && v.Arg == "":
+		p.fail(start, "(*MARK) must have an argument")
+	}
+	return v
+}
+
+// Inline option letters and their flags.
+var optionletters = map[byte]int{
+	'i': pcre.CASELESS, 'm': pcre.MULTILINE, 's': pcre.DOTALL,
+	'x': pcre.EXTENDED, 'J': pcre.DUPNAMES, 'U': pcre.UNGREEDY,
+	'X': pcre.EXTRA,
+}
+
+// Parses inline option letters up to ) or :, and applies them.
+func (p *parser) options() (on, off string) {
+	start := p.pos
+	neg := false
+	for p.more() && p.peek() != ')' && p.peek() != ':' {
+		c := p.peek()
+		flag, ok := optionletters[c]
+		switch {
+		case c == '-' && !neg:
+			neg = true
+		case !ok:
+			p.fail(p.pos, "unrecognized character after (? or (?-")
+		case neg:
+			off += string(c)
+			p.flags &^= flag
+		default:
+			on += string(c)
+			p.flags |= flag
+		}
+		p.pos++
+	}
+	if !p.more() {
+		p.fail(start, "missing )")
+	}
+	return
+}
+
+// Reads a group name up to the terminator.
+func (p *parser) name(term byte) string {
+	end := strings.IndexByte(p.src[p.pos:], term)
+	if end < 0 {
+		p.fail(p.pos, "syntax error in subpattern name (missing terminator)")
+	}
+	name := p.src[p.pos : p.pos+end]
+	if !validname(name) {
+		p.fail(p.pos, "syntax error in subpattern name")
+	}
+	p.pos += end + 1
+	return name
+}
+
+// Parses a group, or another construct starting with (.
+func (p *parser) group() Node {
+	start := p.pos
+	if p.has("(*") {
+		return p.verb()
+	}
+	g := &Group{}
+	saved := p.flags
+	switch {
+	case !p.has("(?"):
+		p.pos++
+		if p.flags&pcre.NO_AUTO_CAPTURE != 0 {
+			g.Kind = NonCapture
+		} else {
+			p.capture(g, "")
+		}
+	default:
+		p.pos += 2
+		if !p.more() {
+			p.fail(p.pos, "unrecognized character after (? or (?-")
+		}
+		switch {
+		case p.has("#"):
+			end := strings.IndexByte(p.src[p.pos:], ')')
+			if end < 0 {
+				p.fail(len(p.src), "missing ) after comment")
+			}
+			p.pos += end + 1
+			return &Comment{node: p.node(start), Text: p.src[start+3 : p.pos-1]}
+		case p.has(":"):
+			g.Kind = NonCapture
+			p.pos++
+		case p.has("|"):
+			g.Kind = BranchReset
+			p.pos++
+		case p.has(">"):
+			g.Kind = Atomic
+			p.pos++
+		case p.has("="):
+			g.Kind = Lookahead
+			p.pos++
+		case p.has("!"):
+			g.Kind = NegativeLookahead
+			p.pos++
+		case p.has("<="):
+			g.Kind = Lookbehind
+			p.pos += 2
+		case p.has("<!"):
+			g.Kind = NegativeLookbehind
+			p.pos += 2
+		case p.has("<"), p.has("'"), p.has("P<"):
+			if p.peek() == 'P' {
+				p.pos++
+			}
+			term := byte('>')
+			if p.peek() == '\'' {
+				term = '\''
+			}
+			p.pos++
+			p.capture(g, p.name(term))
+		case p.has("P="):
+			p.pos += 2
+			return p.namedref(start, p.name(')'), false)
+		case p.has("P>"), p.has("&"):
+			if p.peek() == 'P' {
+				p.pos++
+			}
+			p.pos++
+			return p.namedref(start, p.name(')'), true)
+		case p.has("R)"):
+			p.pos += 2
+			return &Recursion{node: p.node(start)}
+		case '0' <= p.peek() && p.peek() <= '9',
+			(p.peek() == '+' || p.peek() == '-') && p.pos+1 < len(p.src) &&
+				'0' <= p.src[p.pos+1] && p.src[p.pos+1] <= '9':
+			end := strings.IndexByte(p.src[p.pos:], ')')
+			if end < 0 || !isnumber(p.src[p.pos:p.pos+end]) {
+				p.fail(p.pos, "(?R or (?[+-]digits must be followed by )")
+			}
+			text := p.src[p.pos : p.pos+end]
+			p.pos += end + 1
+			return p.namedref(start, text, true)
+		case p.has("C"):
+			p.pos++
+			n := p.number(255, "number after (?C is > 255")
+			if !p.more() || p.peek() != ')' {
+				p.fail(p.pos, "closing ) for (?C expected")
+			}
+			p.pos++
+			return &Callout{node: p.node(start), Number: n}
+		case p.has("("):
+			return p.conditional(start)
+		default:
+			on, off := p.options()
+			if p.peek() == ')' {
+				p.pos++
+				// The options stay in effect until the end of
+				// the enclosing group.
+				return &SetOptions{node: p.node(start), On: on, Off: off}
+			}
+			p.pos++
+			g.Kind = OptionGroup
+			g.On, g.Off = on, off
+		}
+	}
+	g.Sub = p.alternation(g.Kind == BranchReset)
+	if !p.more() {
+		p.fail(p.pos, "missing )")
+	}
+	p.pos++
+	p.flags = saved
+	g.node = p.node(start)
+	if g.Kind == Lookbehind || g.Kind == NegativeLookbehind {
+		p.behind = append(p.behind, g)
+	}
+	return g
+}
+
+// Numbers a capture group and registers its name.
+func (p *parser) capture(g *Group, name string) {
+	p.groups++
+	g.Kind = Capture
+	g.Index = p.groups
+	g.Name = name
+	if len(p.nodes) <= g.Index {
+		p.nodes = append(p.nodes, g)
+	}
+	if name == "" {
+		return
+	}
+	if i, ok := p.names[name]; ok {
+		if i != g.Index && p.flags&pcre.DUPNAMES == 0 {
+			p.fail(p.pos-len(name)-1, "two named subpatterns have the same name")
+		}
+		return
+	}
+	p.names[name] = g.Index
+}
+
+// Parses a conditional group after (?.
+func (p *parser) conditional(start int) Node {
+	c := &Conditional{}
+	if p.has("(?=") || p.has("(?!") || p.has("(?<=") || p.has("(?<!") {
+		c.Cond = CondAssert
+		c.Assert = p.group().(*Group)
+	} else {
+		cstart := p.pos
+		p.pos++
+		end := strings.IndexByte(p.src[p.pos:], ')')
+		if end < 0 {
+			p.fail(p.pos, "malformed number or name after (?(")
+		}
+		text := p.src[p.pos : p.pos+end]
+		p.pos += end + 1
+		switch {
+		case text == "R":
+			c.Cond = CondRecursion
+		case strings.HasPrefix(text, "R&") && validname(text[2:]):
+			c.Cond, c.Name = CondRecursion, text[2:]
+		case strings.HasPrefix(text, "R") && isnumber(text[1:]) && text[1] != '-' && text[1] != '+':
+			c.Cond = CondRecursion
+			c.Index, _ = strconv.Atoi(text[1:])
+		case text == "DEFINE":
+			c.Cond = CondDefine
+		case isnumber(text):
+			c.Cond = CondGroup
+			c.Index = p.groupnumber(cstart+1, text, false)
+		case len(text) > 2 && (text[0] == '<' && text[len(text)-1] == '>' ||
+			text[0] == '\'' && text[len(text)-1] == '\'') && validname(text[1:len(text)-1]):
+			c.Cond, c.Name = CondGroup, text[1:len(text)-1]
+		case validname(text):
+			c.Cond, c.Name = CondGroup, text
+		default:
+			p.fail(cstart+1, "malformed number or name after (?(")
+		}
+		c.node = node{span: Span{cstart, p.pos}}
+		p.refs = append(p.refs, c)
+	}
+	saved := p.flags
+	body := p.alternation(false)
+	if !p.more() {
+		p.fail(p.pos, "missing )")
+	}
+	p.pos++
+	p.flags = saved
+	c.Yes = body
+	if a, ok := body.(*Alternation); ok {
+		switch {
+		case len(a.Alts) > 2:
+			p.fail(start, "conditional group contains more than two branches")
+		case c.Cond == CondDefine:
+			p.fail(start, "DEFINE group contains more than one branch")
+		}
+		c.Yes, c.No = a.Alts[0], a.Alts[1]
+	}
+	c.node = p.node(start)
+	return c
+}
@@ -0,0 +1,144 @@
+package syntax
+
+import (
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"strings"
+	"testing"
+)
+
+// Patterns for which the parser must agree with pcre.Compile.
+var corpus = []struct {
+	pattern string
+	flags   int
+}{
+	{`abc`, 0},
+	{`a.b*c+?d??e{2}f{2,}g{2,5}+`, 0},
+	{`^(a)(b(c))\1\2\3$`, 0},
+	{`(a)(b)(c)(d)(e)(f)(g)(h)(i)(j)\10\11`, 0},
+	{`(?<year>\d{4})-(?P<month>\d\d)-(?'day'\d\d)\k<year>\k{month}\k'day'(?P=day)`, 0},
+	{`(a)\g1\g{1}\g{-1}\g<1>\g'-1'(?1)(?-1)(?+1)(b)`, 0},
+	{`(?|(a)|(b)(c)|(d))(e)`, 0},
+	{`(?:a|b)(?>c|d)(?=e)(?!f)(?<=g|hi)(?<!jk)`, 0},
+	{`(?i)a(?-i:b)(?s-m)c(?x: d e )(?J)(?<n>x)|(?<n>y)`, 0},
+	{`[a-z\d_\-\]][^\]\\a][]a][^]a][[:alpha:][:^digit:]][\x00-\x{ff}\Q]\E]`, 0},
+	{`[a\-z][a-][-a][\b]`, 0},
+	{`\x41\x{42}\o{103}\104\0\cA\e\a\f\n\r\t\Q.*\E\.`, 0},
+	{`\A\Z\z\b\B\G\Ka\R\X\N\C\h\H\v\V\s\S\w\W\pL\p{Lu}\P{^N}`, 0},
+	{`(a)?(?(1)b|c)(?(<n>)d)(?<n>e)(?(R)f)(?(R1)g|h)(?(R&n)i)(?(?=j)k|l)`, 0},
+	{`(?(DEFINE)(?<num>\d+))(?&num)(?P>num)(?R)?`, 0},
+	{`(*UTF8)(*UCP)(*CRLF)a(*PRUNE)b(*SKIP:x)(*MARK:m)(*:n)(*THEN)(*COMMIT)|(*FAIL)|(*F)|(*ACCEPT)`, 0},
+	{`a(?C)b(?C12)c(?#comment)d`, 0},
+	{"a b # comment (x)\n (c) [ ]#", pcre.EXTENDED},
+	{"(?x) a (?-x) b", 0},
+	{`(a)(b)`, pcre.NO_AUTO_CAPTURE},
+	{`(?<n>a)`, pcre.NO_AUTO_CAPTURE},
+	{"é+[à-ÿ]\\x{263a}", pcre.UTF8},
+	{"\xe9+[\xe0-\xff]", 0},
+	{`(?U)a*?b+`, 0},
+	{`a{,3}x{1x}{`, 0},
+	{`((?:(?<inner>a)|b)*)+`, 0},
+	{``, 0},
+	{`|`, 0},
+	{`()`, 0},
+}
+
+func TestParse(t *testing.T) {
+	for _, c := range corpus {
+		re, err := Parse(c.pattern, c.flags)
+		if err != nil {
+			t.Errorf("%q: %v", c.pattern, err)
+			continue
+		}
+		if err := re.Verify(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestParseTree(t *testing.T) {
+	re := MustParse(`x(?<n>a|bc)+?\1`, 0)
+	if re.Groups != 1 || re.Names["n"] != 1 {
+		t.Error(re.Groups, re.Names)
+	}
+	c, ok := re.Root.(*Concat)
+	if !ok || len(c.Items) != 3 {
+		t.Fatalf("%#v", re.Root)
+	}
+	r, ok := c.Items[1].(*Repeat)
+	if !ok || r.Min != 1 || r.Max != -1 || !r.Lazy || r.Span() != (Span{1, 13}) {
+		t.Errorf("%#v", c.Items[1])
+	}
+	g, ok := r.Sub.(*Group)
+	if !ok || g.Kind != Capture || g.Index != 1 || g.Name != "n" || g != re.Group(1) {
+		t.Errorf("%#v", r.Sub)
+	}
+	if a, ok := g.Sub.(*Alternation); !ok || len(a.Alts) != 2 || a.Alts[1].Span() != (Span{8, 10}) {
+		t.Errorf("%#v", g.Sub)
+	}
+	if b, ok := c.Items[2].(*Backref); !ok || b.Index != 1 {
+		t.Errorf("%#v", c.Items[2])
+	}
+
+	re = MustParse(`a(?i)b(?-i:c)d`, 0)
+	var flags []int
+	Walk(re.Root, func(n Node) bool {
+		if l, ok := n.(*Literal); ok {
+			flags = append(flags, l.Flags()&pcre.CASELESS)
+		}
+		return true
+	})
+	if len(flags) != 4 || flags[0] != 0 || flags[1] == 0 || flags[2] != 0 || flags[3] == 0 {
+		t.Error(flags)
+	}
+
+	re = MustParse(`(?|(a)|(b)(c))(d)`, 0)
+	if re.Groups != 3 || re.Group(3) == nil || String(re.Group(3)) != "(d)" {
+		t.Error(re.Groups, re.Group(3))
+	}
+	re = MustParse(`(a)\10\1`, 0)
+	if l, ok := re.Root.(*Concat).Items[1].(*Literal); !ok || l.Rune != 010 {
+		t.Errorf("%#v", re.Root.(*Concat).Items[1])
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	check := func(pattern string, flags int, msg string) {
+		_, err := Parse(pattern, flags)
+		if err == nil || !strings.Contains(err.Message, msg) {
+			t.Errorf("%q: %v, want %q", pattern, err, msg)
+			return
+		}
+		if _, cerr := pcre.Compile(pattern, flags); cerr == nil {
+			t.Errorf("%q: Compile succeeds", pattern)
+		}
+	}
+	check(`a(b`, 0, "missing )")
+	check(`a)b`, 0, "unmatched parentheses")
+	check(`*a`, 0, "nothing to repeat")
+	check(`a|+`, 0, "nothing to repeat")
+	check(`a**`, 0, "nothing to repeat")
+	check(`[a`, 0, "missing terminating ]")
+	check(`[z-a]`, 0, "range out of order")
+	check(`[[:foo:]]`, 0, "unknown POSIX class name")
+	check(`a{3,2}`, 0, "numbers out of order")
+	check(`a{70000}`, 0, "number too big")
+	check(`(a)\2`, 0, "non-existent subpattern")
+	check(`\k<x>`, 0, "non-existent subpattern")
+	check(`(?&x)`, 0, "non-existent subpattern")
+	check(`\g{0}`, 0, "must not be zero")
+	check(`(?<n>a)(?<n>b)`, 0, "same name")
+	check(`(?<=a+)b`, 0, "not fixed length")
+	check(`(?<=a|b(c|de))x`, 0, "not fixed length")
+	check(`(?(1)a|b|c)`, 0, "more than two branches")
+	check(`(?(DEFINE)a|b)`, 0, "more than one branch")
+	check(`(?z)`, 0, "unrecognized character after (?")
+	check(`(*FOO)`, 0, "not recognized")
+	check(`a(*UTF8)`, 0, "not recognized")
+	check(`(*MARK)`, 0, "must have an argument")
+	check(`(?C256)`, 0, "> 255")
+	check(`\x{100}`, 0, "too large")
+	check(`\U`, 0, "does not support")
+	check(`a\`, 0, `\ at end of pattern`)
+	check("\xff", pcre.UTF8, "invalid UTF-8")
+	check(`\y`, pcre.EXTRA, "unrecognized character follows")
+}
@@ -0,0 +1,296 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package syntax
+
+import (
+	"fmt"
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+// Returns a pattern equivalent to the parsed one, in a canonical
+// form: literals are escaped with pcre.QuoteMeta, references use
+// \g{n} and \k<name>, and # comments become (?#...).  It must be
+// compiled with the flags passed to Parse.
+func (re *Regexp) String() string {
+	return String(re.Root)
+}
+
+// Returns the pattern for n and its descendants.
+func String(n Node) string {
+	var p printer
+	p.write(n)
+	return p.String()
+}
+
+// Returns a pattern equivalent to the parsed one on a single line,
+// without comments and white space, and with as few escapes as
+// possible.  It must be compiled with the flags passed to Parse,
+// without EXTENDED.
+func (re *Regexp) Minify() string {
+	p := printer{minify: true, noextended: true}
+	p.write(re.Root)
+	return p.String()
+}
+
+type printer struct {
+	strings.Builder
+	minify     bool // minimal escapes and no comments
+	noextended bool // leave out x in inline options
+	inclass    bool
+}
+
+// Characters which need an escape outside and inside classes when
+// minifying.
+const (
+	special      = `\^$.|?*+()[{`
+	classspecial = `\]^-[`
+)
+
+func (p *printer) literal(r rune, flags int) string {
+	switch {
+	case flags&pcre.UTF8 == 0 && r >= 0x80:
+		return fmt.Sprintf("\\x%02x", r)
+	case !p.minify || r < 0x20 || r == 0x7f:
+		return pcre.QuoteMeta(string(r))
+	case p.inclass && strings.ContainsRune(classspecial, r),
+		!p.inclass && strings.ContainsRune(special, r):
+		return "\\" + string(r)
+	}
+	return string(r)
+}
+
+var groupprefix = map[GroupKind]string{
+	Capture:            "(",
+	NonCapture:         "(?:",
+	BranchReset:        "(?|",
+	Atomic:             "(?>",
+	Lookahead:          "(?=",
+	NegativeLookahead:  "(?!",
+	Lookbehind:         "(?<=",
+	NegativeLookbehind: "(?<!",
+}
+
+func (p *printer) options(on, off string) string {
+	if p.noextended {
+		on = strings.Replace(on, "x", "", -1)
+		off = strings.Replace(off, "x", "", -1)
+	}
+	if off != "" {
+		return on + "-" + off
+	}
+	return on
+}
+
+func (p *printer) write(n Node) {
+	switch n := n.(type) {
+	case *Literal:
+		p.WriteString(p.literal(n.Rune, n.flags))
+	case *Dot:
+		p.WriteByte('.')
+	case *Anchor:
+		if n.Kind != '^' && n.Kind != '$' {
+			p.WriteByte('\\')
+		}
+		p.WriteByte(n.Kind)
+	case *CharType:
+		p.WriteByte('\\')
+		p.WriteByte(n.Kind)
+		if n.Property != "" {
+			p.WriteString("{" + n.Property + "}")
+		}
+	case *Class:
+		p.WriteByte('[')
+		if n.Negated {
+			p.WriteByte('^')
+		}
+		p.inclass = true
+		for _, item := range n.Items {
+			p.write(item)
+		}
+		p.inclass = false
+		p.WriteByte(']')
+	case *Range:
+		p.WriteString(p.literal(n.Lo, n.flags) + "-" + p.literal(n.Hi, n.flags))
+	case *Posix:
+		p.WriteString("[:")
+		if n.Negated {
+			p.WriteByte('^')
+		}
+		p.WriteString(n.Name + ":]")
+	case *Concat:
+		for _, item := range n.Items {
+			p.write(item)
+		}
+	case *Alternation:
+		for i, alt := range n.Alts {
+			if i > 0 {
+				p.WriteByte('|')
+			}
+			p.write(alt)
+		}
+	case *Repeat:
+		p.write(n.Sub)
+		p.quantifier(n)
+	case *Group:
+		p.open(n)
+		p.write(n.Sub)
+		p.WriteByte(')')
+	case *SetOptions:
+		if o := p.options(n.On, n.Off); o != "" {
+			p.WriteString("(?" + o + ")")
+		}
+	case *Backref:
+		if n.Name != "" {
+			p.WriteString(`\k<` + n.Name + ">")
+		} else {
+			fmt.Fprintf(p, `\g{%d}`, n.Index)
+		}
+	case *Recursion:
+		switch {
+		case n.Name != "":
+			p.WriteString("(?&" + n.Name + ")")
+		case n.Index == 0:
+			p.WriteString("(?R)")
+		default:
+			fmt.Fprintf(p, "(?%d)", n.Index)
+		}
+	case *Conditional:
+		p.open(n)
+		p.write(n.Yes)
+		if n.No != nil {
+			p.WriteByte('|')
+			p.write(n.No)
+		}
+		p.WriteByte(')')
+	case *Verb:
+		p.WriteString("(*" + n.Name)
+		switch {
+		case n.Arg == "":
+		case strings.HasPrefix(n.Name, "LIMIT_"):
+			p.WriteString("=" + n.Arg)
+		default:
+			p.WriteString(":" + n.Arg)
+		}
+		p.WriteByte(')')
+	case *Callout:
+		p.WriteString("(?C" + strconv.Itoa(n.Number) + ")")
+	case *Comment:
+		// A comment containing ) cannot be written as (?#...),
+		// and it does not affect matching.
+		if !p.minify && !strings.Contains(n.Text, ")") {
+			p.WriteString("(?#" + n.Text + ")")
+		}
+	}
+}
+
+// Compiles the pattern and its String form with pcre.Compile and
+// checks that both have the number of capture groups and the names
+// found by the parser.
+func (re *Regexp) Verify() error {
+	for _, pattern := range []string{re.Pattern, re.String()} {
+		c, err := pcre.Compile(pattern, re.Flags)
+		if err != nil {
+			return err
+		}
+		if g := c.Groups(); g != re.Groups {
+			return errors.Errorf("syntax: %q: %d groups, parsed %d", pattern, g, re.Groups)
+		}
+		names := c.NamedGroups()
+		for name := range re.Names {
+			if _, ok := names[name]; !ok {
+				return errors.Errorf("syntax: %q: no group %q", pattern, name)
+			}
+		}
+		if len(names) != len(re.Names) {
+			return errors.Errorf("syntax: %q: %d named groups, parsed %d", pattern, len(names), len(re.Names))
+		}
+	}
+	return nil
+}
+
+// Writes the quantifier of n.
+func (p *printer) quantifier(n *Repeat) {
+	switch {
+	case n.Min == 0 && n.Max == -1:
+		p.WriteByte('*')
+	case n.Min == 1 && n.Max == -1:
+		p.WriteByte('+')
+	case n.Min == 0 && n.Max == 1:
+		p.WriteByte('?')
+	case n.Max == -1:
+		fmt.Fprintf(p, "{%d,}", n.Min)
+	case n.Min == n.Max:
+		fmt.Fprintf(p, "{%d}", n.Min)
+	default:
+		fmt.Fprintf(p, "{%d,%d}", n.Min, n.Max)
+	}
+	if n.Lazy {
+		p.WriteByte('?')
+	} else if n.Possessive {
+		p.WriteByte('+')
+	}
+}
+
+// Writes the opening of a group or conditional, up to its contents.
+func (p *printer) open(n Node) {
+	switch n := n.(type) {
+	case *Group:
+		switch {
+		case n.Kind == Capture && n.Name != "":
+			p.WriteString("(?<" + n.Name + ">")
+		case n.Kind == OptionGroup:
+			p.WriteString("(?" + p.options(n.On, n.Off) + ":")
+		default:
+			p.WriteString(groupprefix[n.Kind])
+		}
+	case *Conditional:
+		p.WriteString("(?")
+		switch n.Cond {
+		case CondAssert:
+			p.write(n.Assert)
+		case CondDefine:
+			p.WriteString("(DEFINE)")
+		case CondRecursion:
+			switch {
+			case n.Name != "":
+				p.WriteString("(R&" + n.Name + ")")
+			case n.Index == 0:
+				p.WriteString("(R)")
+			default:
+				fmt.Fprintf(p, "(R%d)", n.Index)
+			}
+		default:
+			if n.Name != "" {
+				p.WriteString("(<" + n.Name + ">)")
+			} else {
+				fmt.Fprintf(p, "(%d)", n.Index)
+			}
+		}
+	}
+}
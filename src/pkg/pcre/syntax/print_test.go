@@ -0,0 +1,75 @@
+package syntax
+
+import (
+	"github.com/athlum/golang-pkg-pcre/src/pkg/pcre"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	check := func(pattern string, flags int, want string) {
+		re, err := Parse(pattern, flags)
+		if err != nil {
+			t.Error(pattern, err)
+			return
+		}
+		if got := re.String(); got != want {
+			t.Errorf("%q: got %q, want %q", pattern, got, want)
+		}
+	}
+	check(`a.b*c+?d{2,}+`, 0, `a.b*c+?d{2,}+`)
+	check(`a{1}b{0,}c{1,}d{0,1}`, 0, `a{1}b*c+d?`)
+	check(`(?P<n>a)(?P=n)\g-1\1(?P>n)(?-1)(?+1)()`, 0, `(?<n>a)\k<n>\g{1}\g{1}(?&n)(?1)(?2)()`)
+	check(`[]a\d-][:x]`, 0, `[\]a\d\-][\:x]`)
+	check(`[^[:^alpha:]\x41-\x{5a}]`, 0, `[^[:^alpha:]A-Z]`)
+	check(`\Qa.b\E\x2e\t`, 0, `a\.b\.\x09`)
+	check(`\pL\p{^Lu}`, 0, `\p{L}\P{Lu}`)
+	check("a # one\n b (?#two)", pcre.EXTENDED, `a(?# one)b(?#two)`)
+	check("a#(x)\nb", pcre.EXTENDED, `ab`)
+	check(`(?(<n>)a|b)(?(R)c)(?(R&n)d)(?<n>)`, 0, `(?(<n>)a|b)(?(R)c)(?(R&n)d)(?<n>)`)
+	check(`(*LIMIT_MATCH=10)(*:m)`, 0, `(*LIMIT_MATCH=10)(*MARK:m)`)
+	check(`(?C)(?i-s:a)`, 0, `(?C0)(?i-s:a)`)
+	check("\xe9", 0, `\xe9`)
+	check("é", pcre.UTF8, "é")
+}
+
+// String must give a pattern with the same groups, which parses to
+// the same String.
+func TestRoundTrip(t *testing.T) {
+	for _, c := range corpus {
+		re, err := Parse(c.pattern, c.flags)
+		if err != nil {
+			t.Errorf("%q: %v", c.pattern, err)
+			continue
+		}
+		s := re.String()
+		re2, err := Parse(s, c.flags)
+		if err != nil {
+			t.Errorf("%q: %q: %v", c.pattern, s, err)
+			continue
+		}
+		if err := re2.Verify(); err != nil {
+			t.Error(err)
+		}
+		if s2 := re2.String(); s2 != s {
+			t.Errorf("%q: %q, then %q", c.pattern, s, s2)
+		}
+	}
+}
+
+func TestWidth(t *testing.T) {
+	check := func(pattern string, min, max int) {
+		re := MustParse(pattern, 0)
+		if lo, hi := re.Width(re.Root); lo != min || hi != max {
+			t.Errorf("%q: %d, %d", pattern, lo, hi)
+		}
+	}
+	check(`abc`, 3, 3)
+	check(`a|bc`, 1, 2)
+	check(`a{2,3}(?:bc)?`, 2, 5)
+	check(`a+\R`, 2, -1)
+	check(`(?=abc)^x$`, 1, 1)
+	check(`(a)\1`, 1, -1)
+	check(`(ab)(?1)`, 4, 4)
+	check(`a(?R)?`, 1, -1)
+	check(`(?(DEFINE)a)(?(1)bb|c)()`, 1, 2)
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package syntax
+
+// Returns the minimum and maximum number of characters which n can
+// match, with -1 for no upper limit or when the maximum cannot be
+// determined, as for back references.
+func (re *Regexp) Width(n Node) (min, max int) {
+	return re.width(n, make(map[int]bool))
+}
+
+func add(a, b int) int {
+	if a < 0 || b < 0 {
+		return -1
+	}
+	return a + b
+}
+
+func either(min1, max1, min2, max2 int) (min, max int) {
+	min, max = min1, max1
+	if min2 < min {
+		min = min2
+	}
+	if max2 < 0 || max >= 0 && max2 > max {
+		max = max2
+	}
+	return
+}
+
+// Computes the width, with calls holding the groups entered through
+// recursion to stop at recursive calls.
+func (re *Regexp) width(n Node, calls map[int]bool) (min, max int) {
+	switch n := n.(type) {
+	case *Literal, *Dot, *Class:
+		return 1, 1
+	case *CharType:
+		switch n.Kind {
+		case 'R':
+			return 1, 2
+		case 'X':
+			return 1, -1
+		}
+		return 1, 1
+	case *Concat:
+		for _, item := range n.Items {
+			lo, hi := re.width(item, calls)
+			min, max = min+lo, add(max, hi)
+		}
+		return
+	case *Alternation:
+		for i, alt := range n.Alts {
+			lo, hi := re.width(alt, calls)
+			if i == 0 {
+				min, max = lo, hi
+			} else {
+				min, max = either(min, max, lo, hi)
+			}
+		}
+		return
+	case *Repeat:
+		lo, hi := re.width(n.Sub, calls)
+		min = n.Min * lo
+		switch {
+		case n.Max == 0 || hi == 0:
+			max = 0
+		case n.Max < 0 || hi < 0:
+			max = -1
+		default:
+			max = n.Max * hi
+		}
+		return
+	case *Group:
+		switch n.Kind {
+		case Lookahead, NegativeLookahead, Lookbehind, NegativeLookbehind:
+			return 0, 0
+		}
+		return re.width(n.Sub, calls)
+	case *Backref:
+		return 0, -1
+	case *Recursion:
+		if calls[n.Index] {
+			return 0, -1
+		}
+		calls[n.Index] = true
+		defer delete(calls, n.Index)
+		if n.Index == 0 {
+			return re.width(re.Root, calls)
+		}
+		if g := re.Group(n.Index); g != nil {
+			return re.width(g.Sub, calls)
+		}
+		return 0, -1
+	case *Conditional:
+		if n.Cond == CondDefine {
+			return 0, 0
+		}
+		min, max = re.width(n.Yes, calls)
+		lo, hi := 0, 0
+		if n.No != nil {
+			lo, hi = re.width(n.No, calls)
+		}
+		return either(min, max, lo, hi)
+	}
+	return 0, 0
+}
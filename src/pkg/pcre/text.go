@@ -0,0 +1,162 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package pcre
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Modifier letters for the "/pattern/flags" notation, as used by
+// PHP's preg functions.
+var modifiers = []struct {
+	letter byte
+	flag   int
+}{
+	{'i', CASELESS},
+	{'m', MULTILINE},
+	{'s', DOTALL},
+	{'x', EXTENDED},
+	{'A', ANCHORED},
+	{'D', DOLLAR_ENDONLY},
+	{'U', UNGREEDY},
+	{'X', EXTRA},
+	{'J', DUPNAMES},
+	{'n', NO_AUTO_CAPTURE},
+	{'u', UTF8},
+}
+
+// Returns the modifier letters for flags, or an error if some flag
+// has no letter.
+func modifierstring(flags int) (string, error) {
+	var b []byte
+	for _, m := range modifiers {
+		if flags&m.flag != 0 {
+			b = append(b, m.letter)
+			flags &^= m.flag
+		}
+	}
+	if flags != 0 {
+		return "", errors.Errorf("flags %#x have no modifier letter", flags)
+	}
+	return string(b), nil
+}
+
+// Returns the flags for the modifier letters in s.  On error, the
+// second return value is the index of the offending letter.
+func modifierflags(s string) (int, int, error) {
+	flags := 0
+loop:
+	for i := 0; i < len(s); i++ {
+		for _, m := range modifiers {
+			if s[i] == m.letter {
+				flags |= m.flag
+				continue loop
+			}
+		}
+		return 0, i, errors.Errorf("unknown modifier %q", s[i])
+	}
+	return flags, 0, nil
+}
+
+// Encodes the pattern in "/pattern/flags" notation, escaping slashes
+// in the pattern.  An uninitialized Regexp encodes as the empty
+// string.  Implements encoding.TextMarshaler, which also makes
+// encoding/json write Regexp objects as strings.
+func (re Regexp) MarshalText() ([]byte, error) {
+	if re.ptr == nil {
+		return []byte{}, nil
+	}
+	mods, err := modifierstring(re.flags)
+	if err != nil {
+		return nil, err
+	}
+	b := []byte{'/'}
+	for i := 0; i < len(re.pattern); i++ {
+		switch c := re.pattern[i]; c {
+		case '\\':
+			b = append(b, c)
+			if i+1 < len(re.pattern) {
+				i++
+				b = append(b, re.pattern[i])
+			}
+		case '/':
+			b = append(b, '\\', '/')
+		default:
+			b = append(b, c)
+		}
+	}
+	b = append(b, '/')
+	return append(b, mods...), nil
+}
+
+// Compiles text in "/pattern/flags" notation, as written by
+// MarshalText, and stores the result in re.  Text which does not
+// start with a slash is compiled as a pattern without flags, and
+// empty text results in an uninitialized Regexp.  Patterns are
+// compiled as by CompileAuto, so that a Regexp from CompileAuto keeps
+// its engine.  Invalid patterns are reported as *CompileError, with
+// the offset in text.  Implements encoding.TextUnmarshaler.
+func (re *Regexp) UnmarshalText(text []byte) error {
+	s := string(text)
+	var (
+		r   Regexp
+		err *CompileError
+	)
+	switch {
+	case s == "":
+	case s[0] == '/':
+		r, err = compileliteral(s, EngineAuto)
+	default:
+		r, err = CompileAuto(s, 0)
+	}
+	if err != nil {
+		return err
+	}
+	*re = r
+	return nil
+}
+
+// A Regexp for use with flag.Var.  Unlike Regexp, whose String
+// method returns the bare pattern, it implements flag.Value in terms of
+// the "/pattern/flags" notation, so that flags survive a round trip.
+type Flag struct {
+	Regexp
+}
+
+// Returns the pattern in "/pattern/flags" notation, or the bare
+// pattern if its flags have no modifier letters.
+func (f *Flag) String() string {
+	b, err := f.MarshalText()
+	if err != nil {
+		return f.pattern
+	}
+	return string(b)
+}
+
+// Compiles the flag argument in "/pattern/flags" notation.
+func (f *Flag) Set(value string) error {
+	return f.UnmarshalText([]byte(value))
+}
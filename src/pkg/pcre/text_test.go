@@ -0,0 +1,135 @@
+package pcre
+
+import (
+	"encoding/json"
+	"flag"
+	"testing"
+)
+
+func TestMarshalText(t *testing.T) {
+	check := func(pattern string, flags int, text string) {
+		b, err := MustCompile(pattern, flags).MarshalText()
+		if err != nil {
+			t.Error(pattern, err)
+		}
+		if string(b) != text {
+			t.Error(pattern, "MarshalText", string(b))
+		}
+		var re Regexp
+		if err := re.UnmarshalText(b); err != nil {
+			t.Error(text, err)
+		}
+		if re.Flags() != flags || re.Groups() != MustCompile(pattern, flags).Groups() {
+			t.Error(text, "UnmarshalText", re.String(), re.Flags())
+		}
+	}
+	check(`abc`, 0, `/abc/`)
+	check(`^(\d+)\s`, MULTILINE|DOTALL|CASELESS|EXTENDED, `/^(\d+)\s/imsx`)
+	check(`a/b`, UTF8, `/a\/b/u`)
+	check(`a\/b`, 0, `/a\/b/`)
+	check(`a\\/b`, UNGREEDY, `/a\\\/b/U`)
+
+	for _, compile := range []func(string, int) (Regexp, *CompileError){Compile, CompileAuto} {
+		re, _ := compile(`a\/b+`, CASELESS)
+		b, _ := re.MarshalText()
+		var back Regexp
+		if err := back.UnmarshalText(b); err != nil || !back.Equal(re) || back.Hash() != re.Hash() ||
+			back.String() != `a/b+` {
+			t.Error(string(b), back.String(), err)
+		}
+	}
+	for pattern, want := range map[string]string{
+		`[\/]\\/`:  `[/]\\/`,
+		`\Q\/\E\/`: `\Q\/\E/`,
+		`\Q\\E\/`:  `\Q\\E/`,
+	} {
+		if s := MustCompile(pattern, 0).String(); s != want {
+			t.Error(pattern, s)
+		}
+	}
+	auto, _ := CompileAuto(`a\/b+`, 0)
+	b, _ := auto.MarshalText()
+	var back Regexp
+	if back.UnmarshalText(b); back.Engine() != auto.Engine() || auto.Engine() != EngineGo {
+		t.Error("Engine", back.Engine(), auto.Engine())
+	}
+
+	if _, err := MustCompile("a", NEWLINE_CR).MarshalText(); err == nil {
+		t.Error("NEWLINE_CR")
+	}
+	if b, err := (Regexp{}).MarshalText(); err != nil || len(b) != 0 {
+		t.Error("uninitialized", b, err)
+	}
+}
+
+func TestUnmarshalText(t *testing.T) {
+	var re Regexp
+	if err := re.UnmarshalText([]byte("a(b)")); err != nil {
+		t.Error(err)
+	}
+	if re.String() != "a(b)" || re.Flags() != 0 {
+		t.Error("plain", re.String(), re.Flags())
+	}
+	check := func(text string, off int) {
+		err := re.UnmarshalText([]byte(text))
+		if cerr, ok := err.(*CompileError); !ok {
+			t.Error(text, err)
+		} else if cerr.Offset != off {
+			t.Error(text, "Offset", cerr.Offset)
+		}
+	}
+	check("/abc", 4)
+	check("/abc/iq", 6)
+	check("/a(b/", 4)
+	check("a(b", 3)
+}
+
+func TestJSON(t *testing.T) {
+	var config struct {
+		Match Regexp
+		Skip  *Regexp
+	}
+	err := json.Unmarshal([]byte(`{"Match": "/^(\\S+) x/i", "Skip": "debug"}`), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Match.Flags() != CASELESS || config.Skip.String() != "debug" {
+		t.Error("Unmarshal", config.Match.Flags(), config.Skip.String())
+	}
+	b, err := json.Marshal(config)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(b) != `{"Match":"/^(\\S+) x/i","Skip":"/debug/"}` {
+		t.Error("Marshal", string(b))
+	}
+	err = json.Unmarshal([]byte(`{"Match": "/(/"}`), &config)
+	if _, ok := err.(*CompileError); !ok {
+		t.Error("invalid pattern", err)
+	}
+}
+
+func TestFlagValue(t *testing.T) {
+	var f Flag
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&f, "re", "pattern")
+	if err := fs.Parse([]string{"-re", "/ab+c/i"}); err != nil {
+		t.Error(err)
+	}
+	if f.Regexp.String() != "ab+c" || f.Flags() != CASELESS {
+		t.Error("Set", f.Regexp.String(), f.Flags())
+	}
+	if f.String() != "/ab+c/i" {
+		t.Error("String", f.String())
+	}
+	var g Flag
+	if err := g.Set(f.String()); err != nil {
+		t.Error(err)
+	}
+	if g.Regexp.String() != "ab+c" || g.Flags() != CASELESS {
+		t.Error("round trip", g.String())
+	}
+	if (&Flag{}).String() != "" {
+		t.Error("zero Flag")
+	}
+}
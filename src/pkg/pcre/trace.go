@@ -0,0 +1,232 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package pcre
+
+/*
+#include <pcre.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"unsafe"
+)
+
+// A step of a traced match, recorded before an item of the pattern is
+// matched.
+type TraceStep struct {
+	Callout   int     `json:"callout"`  // 255 for automatic callouts
+	Pattern   int     `json:"pattern"`  // offset of the next item in the pattern
+	Length    int     `json:"length"`   // length of the next item in the pattern
+	Start     int     `json:"start"`    // start of the match attempt in the subject
+	Position  int     `json:"position"` // current position in the subject
+	Groups    [][]int `json:"groups"`   // offsets of groups 1 and up, nil if unset
+	Mark      string  `json:"mark,omitempty"`
+	Backtrack bool    `json:"backtrack"` // the position moved back in the same attempt
+}
+
+// The steps of a traced match.  It can be marshalled as JSON.
+type Trace struct {
+	Pattern   string      `json:"pattern"`
+	Subject   string      `json:"subject"`
+	Steps     []TraceStep `json:"steps"`
+	Truncated bool        `json:"truncated"` // more than MaxTraceSteps steps
+	Match     []int       `json:"match"`     // offsets of the match, or nil
+	groups    int
+}
+
+// The number of steps after which a Trace stops recording.
+var MaxTraceSteps = 100000
+
+var (
+	tracemu   sync.Mutex
+	traces    = make(map[uintptr]*Trace)
+	tracenext uintptr
+)
+
+//export tracestep
+func tracestep(block *C.pcre_callout_block) C.int {
+	id := uintptr(block.callout_data)
+	tracemu.Lock()
+	t := traces[id]
+	tracemu.Unlock()
+	if t == nil {
+		// A callout in a pattern which is not traced.
+		return 0
+	}
+	if len(t.Steps) >= MaxTraceSteps {
+		t.Truncated = true
+		return 0
+	}
+	step := TraceStep{
+		Callout:  int(block.callout_number),
+		Pattern:  int(block.pattern_position),
+		Length:   int(block.next_item_length),
+		Start:    int(block.start_match),
+		Position: int(block.current_position),
+		Groups:   make([][]int, t.groups),
+	}
+	if top := int(block.capture_top); top > 1 {
+		ovector := (*[1 << 28]C.int)(unsafe.Pointer(block.offset_vector))[: 2*top : 2*top]
+		for i := 1; i < top && i <= t.groups; i++ {
+			if ovector[2*i] >= 0 {
+				step.Groups[i-1] = []int{int(ovector[2*i]), int(ovector[2*i+1])}
+			}
+		}
+	}
+	if block.mark != nil {
+		step.Mark = C.GoString((*C.char)(unsafe.Pointer(block.mark)))
+	}
+	if n := len(t.Steps); n > 0 {
+		prev := t.Steps[n-1]
+		step.Backtrack = prev.Start == step.Start && step.Position < prev.Position
+	}
+	t.Steps = append(t.Steps, step)
+	return 0
+}
+
+// Like Match, but records each step of the match.  The pattern is
+// compiled again with AUTO_CALLOUT for this; callouts in the pattern
+// are recorded as well.  The matcher holds the results of the match
+// afterwards.
+func (m *Matcher) Trace(subject []byte, flags int) (*Trace, error) {
+	t := &Trace{Subject: string(subject)}
+	err := m.tracematch(t, AUTO_CALLOUT, func() (bool, error) {
+		return m.Match(subject, flags)
+	})
+	return t, err
+}
+
+// Like Trace, but for a subject string.
+func (m *Matcher) TraceString(subject string, flags int) (*Trace, error) {
+	t := &Trace{Subject: subject}
+	err := m.tracematch(t, AUTO_CALLOUT, func() (bool, error) {
+		return m.MatchString(subject, flags)
+	})
+	return t, err
+}
+
+// Like Trace, but records only the callouts in the pattern, such as
+// (?C1), without compiling it again.
+func (m *Matcher) TraceCallouts(subject []byte, flags int) (*Trace, error) {
+	t := &Trace{Subject: string(subject)}
+	err := m.tracematch(t, 0, func() (bool, error) {
+		return m.Match(subject, flags)
+	})
+	return t, err
+}
+
+// Like TraceCallouts, but for a subject string.
+func (m *Matcher) TraceCalloutsString(subject string, flags int) (*Trace, error) {
+	t := &Trace{Subject: subject}
+	err := m.tracematch(t, 0, func() (bool, error) {
+		return m.MatchString(subject, flags)
+	})
+	return t, err
+}
+
+func (m *Matcher) tracematch(t *Trace, extraFlags int, match func() (bool, error)) error {
+	if m.re.ptr == nil {
+		panic("Matcher.Trace: uninitialized")
+	}
+	re := m.re
+	if extraFlags != 0 || re.re2 != nil {
+		// Callouts need libpcre, not the Go engine.
+		var cerr *CompileError
+		if re, cerr = Compile(m.re.pattern, m.re.flags|extraFlags); cerr != nil {
+			return cerr
+		}
+	}
+	t.Pattern = m.re.pattern
+	t.groups = m.groups
+	tracemu.Lock()
+	tracenext++
+	id := tracenext
+	traces[id] = t
+	tracemu.Unlock()
+	saved := m.re
+	m.re, m.trace = re, id
+	defer func() {
+		m.re, m.trace = saved, 0
+		tracemu.Lock()
+		delete(traces, id)
+		tracemu.Unlock()
+	}()
+	matched, err := match()
+	if matched {
+		t.Match = m.GroupIndex(0)
+	}
+	return err
+}
+
+// Returns the steps as a table, one step per line, with the next item
+// of the pattern and the rest of the subject.
+func (t *Trace) String() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "step\tstart\tpos\titem\tsubject\tgroups")
+	for i, s := range t.Steps {
+		item := ""
+		if s.Pattern+s.Length <= len(t.Pattern) {
+			item = t.Pattern[s.Pattern : s.Pattern+s.Length]
+		}
+		if s.Length == 0 {
+			item = "(end)"
+		}
+		rest := t.Subject[s.Position:]
+		if len(rest) > 16 {
+			rest = rest[:16] + "..."
+		}
+		var groups []string
+		for g, o := range s.Groups {
+			if o != nil && o[0] <= o[1] && o[1] <= len(t.Subject) {
+				groups = append(groups, fmt.Sprintf("%d=%q", g+1, t.Subject[o[0]:o[1]]))
+			}
+		}
+		if s.Mark != "" {
+			groups = append(groups, "mark="+strconv.Quote(s.Mark))
+		}
+		if s.Backtrack {
+			groups = append(groups, "backtrack")
+		}
+		fmt.Fprintf(w, "%d\t%d\t%d\t%s\t%s\t%s\n", i+1, s.Start, s.Position,
+			item, strconv.Quote(rest), strings.Join(groups, " "))
+	}
+	w.Flush()
+	switch {
+	case t.Truncated:
+		fmt.Fprintf(&b, "truncated after %d steps\n", len(t.Steps))
+	case t.Match != nil:
+		fmt.Fprintf(&b, "match at %d-%d: %q\n", t.Match[0], t.Match[1], t.Subject[t.Match[0]:t.Match[1]])
+	default:
+		b.WriteString("no match\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,106 @@
+package pcre
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	m, _ := MustCompile(`(a+)b`, 0).MatcherString("", 0)
+	tr, err := m.TraceString("xaab", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tr.Match) != 2 || tr.Match[0] != 1 || tr.Match[1] != 4 || !m.Matches() || m.GroupString(1) != "aa" {
+		t.Error(tr.Match, m.GroupString(1))
+	}
+	found := false
+	for _, s := range tr.Steps {
+		if s.Callout != 255 || len(s.Groups) != 1 {
+			t.Errorf("%+v", s)
+		}
+		if tr.Pattern[s.Pattern:s.Pattern+s.Length] == "b" {
+			found = true
+			if s.Position != 3 || s.Groups[0] == nil || s.Groups[0][0] != 1 || s.Groups[0][1] != 3 {
+				t.Errorf("%+v", s)
+			}
+		}
+	}
+	if !found {
+		t.Error(tr)
+	}
+	if !strings.HasSuffix(tr.String(), "match at 1-4: \"aab\"\n") {
+		t.Error(tr)
+	}
+	// The matcher is back to the pattern without callouts.
+	if m.re.flags&AUTO_CALLOUT != 0 || m.trace != 0 {
+		t.Error(m.re.flags)
+	}
+	if ok, _ := m.MatchString("b", 0); ok {
+		t.Error("b matches")
+	}
+
+	m, _ = MustCompile(`(a+)+$`, 0).MatcherString("", 0)
+	tr, _ = m.TraceString("aa!", 0)
+	backtracks := 0
+	for _, s := range tr.Steps {
+		if s.Backtrack {
+			backtracks++
+		}
+	}
+	if backtracks == 0 || tr.Match != nil || !strings.HasSuffix(tr.String(), "no match\n") ||
+		!strings.Contains(tr.String(), `1="a" backtrack`) {
+		t.Error(tr)
+	}
+	b, err := json.Marshal(tr)
+	if err != nil || !strings.Contains(string(b), `"backtrack":true`) ||
+		!strings.Contains(string(b), `"groups":[[0,1]]`) {
+		t.Errorf("%s %v", b, err)
+	}
+}
+
+func TestTraceMark(t *testing.T) {
+	m, _ := MustCompile(`a(*MARK:x)(?C1)b`, 0).MatcherString("", 0)
+	tr, _ := m.TraceString("ab", 0)
+	callout := false
+	for _, s := range tr.Steps {
+		if s.Callout == 1 {
+			callout = s.Mark == "x"
+		}
+	}
+	if !callout {
+		t.Error(tr)
+	}
+	// Callouts in patterns which are not traced are ignored.
+	if ok, err := m.MatchString("ab", 0); !ok || err != nil {
+		t.Error(ok, err)
+	}
+}
+
+func TestTraceTruncated(t *testing.T) {
+	defer func(n int) { MaxTraceSteps = n }(MaxTraceSteps)
+	MaxTraceSteps = 3
+	m, _ := MustCompile(`abc`, 0).MatcherString("", 0)
+	tr, _ := m.TraceString("abc", 0)
+	if len(tr.Steps) != 3 || !tr.Truncated || tr.Match == nil ||
+		!strings.HasSuffix(tr.String(), "truncated after 3 steps\n") {
+		t.Error(tr)
+	}
+}
+
+func TestTraceCallouts(t *testing.T) {
+	m, _ := MustCompile(`(?:a(?C1)|b(?C2))+c`, 0).MatcherString("", 0)
+	tr, err := m.TraceCalloutsString("abac", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var callouts []int
+	for _, s := range tr.Steps {
+		callouts = append(callouts, s.Callout)
+	}
+	if fmt.Sprint(callouts) != "[1 2 1]" || tr.Match == nil {
+		t.Error(tr)
+	}
+}
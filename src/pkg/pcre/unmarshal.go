@@ -0,0 +1,274 @@
+// Copyright (c) 2011 Florian Weimer. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+// * Redistributions of source code must retain the above copyright
+//   notice, this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright
+//   notice, this list of conditions and the following disclaimer in the
+//   documentation and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package pcre
+
+import (
+	"encoding"
+	"github.com/pkg/errors"
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A struct field filled by Matcher.Unmarshal.
+type structfield struct {
+	index  int    // in the struct
+	field  string // Go name, for error messages
+	group  string // from the pcre tag
+	layout string // for time.Time, from the layout tag
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	ipType              = reflect.TypeOf(net.IP(nil))
+	timeType            = reflect.TypeOf(time.Time{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Parsed struct types, by reflect.Type.
+var structcache sync.Map
+
+// Returns the tagged fields of a struct type.
+func structfields(t reflect.Type) ([]structfield, error) {
+	if fields, ok := structcache.Load(t); ok {
+		return fields.([]structfield), nil
+	}
+	var fields []structfield
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		group, ok := f.Tag.Lookup("pcre")
+		if !ok || group == "-" {
+			continue
+		}
+		switch {
+		case f.PkgPath != "":
+			return nil, errors.Errorf("field %s: unexported", f.Name)
+		case group == "":
+			return nil, errors.Errorf("field %s: empty group name", f.Name)
+		case !supported(f.Type):
+			return nil, errors.Errorf("field %s: unsupported type %s", f.Name, f.Type)
+		}
+		fields = append(fields, structfield{
+			index:  i,
+			field:  f.Name,
+			group:  group,
+			layout: f.Tag.Get("layout"),
+		})
+	}
+	structcache.Store(t, fields)
+	return fields, nil
+}
+
+// Returns true if Unmarshal can convert a group to type t.
+func supported(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case durationType, ipType, timeType:
+		return true
+	}
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+	}
+	return false
+}
+
+// Returns the struct type behind a pointer passed to Unmarshal.
+func structtype(v interface{}) (reflect.Type, error) {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return nil, errors.Errorf("Unmarshal needs a pointer to a struct, not %T", v)
+	}
+	return t.Elem(), nil
+}
+
+// Check that the struct which v points to can be filled by
+// Matcher.Unmarshal from matches of re: every field with a pcre tag
+// must name a group of the pattern and have a supported type.
+func (re Regexp) CheckStruct(v interface{}) error {
+	t, err := structtype(v)
+	if err != nil {
+		return err
+	}
+	fields, err := structfields(t)
+	if err != nil {
+		return err
+	}
+	names := re.NamedGroups()
+	for _, f := range fields {
+		if _, ok := names[f.group]; !ok {
+			return errors.Errorf("field %s: no group named %q", f.field, f.group)
+		}
+	}
+	return nil
+}
+
+// Like Compile, but also checks with CheckStruct that matches can be
+// unmarshaled into the struct which v points to.  A mismatch is
+// reported as a CompileError at offset 0.
+func CompileStruct(pattern string, flags int, v interface{}) (Regexp, *CompileError) {
+	re, cerr := Compile(pattern, flags)
+	if cerr != nil {
+		return re, cerr
+	}
+	if err := re.CheckStruct(v); err != nil {
+		return Regexp{}, &CompileError{
+			Pattern: pattern,
+			Message: err.Error(),
+		}
+	}
+	return re, nil
+}
+
+// Compile the pattern for unmarshaling into the struct which v points
+// to.  If compilation or the check fails, panic.
+func MustCompileStruct(pattern string, flags int, v interface{}) (re Regexp) {
+	re, err := CompileStruct(pattern, flags, v)
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+
+// Stores the named groups of the last match in the struct which v
+// points to.  Fields are selected by `pcre:"name"` tags; the supported
+// types are string, []byte, the integer, float and bool types,
+// time.Time (parsed with the layout in a `layout:"..."` tag, or
+// RFC 3339), time.Duration, net.IP, types implementing
+// encoding.TextUnmarshaler, and pointers to all of these.  A pointer
+// field is set to nil if its group is not present; other fields are
+// set to their zero value.  Conversion errors mention the group.
+// Returns PCRE_ERROR_NOMATCH if the last match failed.
+func (m *Matcher) Unmarshal(v interface{}) error {
+	if err := m.re.CheckStruct(v); err != nil {
+		return err
+	}
+	if !m.matches {
+		return PCRE_ERROR_NOMATCH
+	}
+	fields, _ := structfields(reflect.TypeOf(v).Elem())
+	s := reflect.ValueOf(v).Elem()
+	names := m.re.NamedGroups()
+	for _, f := range fields {
+		group := names[f.group]
+		err := setfield(s.Field(f.index), m.Present(group), m.GroupString(group), f.layout)
+		if err != nil {
+			return errors.Wrapf(err, "group %q", f.group)
+		}
+	}
+	return nil
+}
+
+func setfield(f reflect.Value, present bool, s, layout string) error {
+	if !present {
+		f.Set(reflect.Zero(f.Type()))
+		return nil
+	}
+	if f.Kind() == reflect.Ptr {
+		p := reflect.New(f.Type().Elem())
+		if err := setvalue(p.Elem(), s, layout); err != nil {
+			return err
+		}
+		f.Set(p)
+		return nil
+	}
+	return setvalue(f, s, layout)
+}
+
+func setvalue(f reflect.Value, s, layout string) error {
+	switch f.Type() {
+	case timeType:
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+		return nil
+	case ipType:
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return errors.Errorf("invalid IP address %q", s)
+		}
+		f.Set(reflect.ValueOf(ip))
+		return nil
+	}
+	if u, ok := f.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Slice:
+		f.SetBytes([]byte(s))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		x, err := strconv.ParseFloat(s, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(x)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package pcre
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type record struct {
+	Host     string        `pcre:"host"`
+	IP       net.IP        `pcre:"ip"`
+	Port     uint16        `pcre:"port"`
+	Level    *int          `pcre:"level"`
+	Ratio    float64       `pcre:"ratio"`
+	Ok       bool          `pcre:"ok"`
+	Time     time.Time     `pcre:"time" layout:"2006-01-02 15:04:05"`
+	Took     time.Duration `pcre:"took"`
+	Msg      []byte        `pcre:"msg"`
+	Ignored  string
+	Skipped  string `pcre:"-"`
+	internal int
+}
+
+const recordpattern = `^(?<host>\S+) (?<ip>[\d.]+):(?<port>\d+)(?: L(?<level>-?\d+))? ` +
+	`(?<ratio>[\d.]+) (?<ok>\w+) \[(?<time>[^]]+)\] (?<took>\S+) (?<msg>.*)$`
+
+func TestUnmarshal(t *testing.T) {
+	re := MustCompileStruct(recordpattern, 0, &record{})
+	m, _ := re.MatcherString("web1 10.0.0.1:8080 L-3 0.5 true [2018-07-10 11:38:42] 1.5s hello", 0)
+	var r record
+	if err := m.Unmarshal(&r); err != nil {
+		t.Fatal(err)
+	}
+	switch {
+	case r.Host != "web1":
+		t.Error("Host", r.Host)
+	case !r.IP.Equal(net.IPv4(10, 0, 0, 1)):
+		t.Error("IP", r.IP)
+	case r.Port != 8080:
+		t.Error("Port", r.Port)
+	case r.Level == nil || *r.Level != -3:
+		t.Error("Level", r.Level)
+	case r.Ratio != 0.5 || !r.Ok:
+		t.Error("Ratio", r.Ratio, r.Ok)
+	case !r.Time.Equal(time.Date(2018, 7, 10, 11, 38, 42, 0, time.UTC)):
+		t.Error("Time", r.Time)
+	case r.Took != 1500*time.Millisecond:
+		t.Error("Took", r.Took)
+	case string(r.Msg) != "hello":
+		t.Error("Msg", string(r.Msg))
+	}
+	m.MatchString("web1 10.0.0.1:8080 0.5 true [2018-07-10 11:38:42] 1.5s hello", 0)
+	if err := m.Unmarshal(&r); err != nil || r.Level != nil {
+		t.Error("optional group", err, r.Level)
+	}
+	m.MatchString("web1 10.0.0.1:99999 0.5 true [2018-07-10 11:38:42] 1.5s hello", 0)
+	if err := m.Unmarshal(&r); err == nil || !strings.Contains(err.Error(), `group "port"`) {
+		t.Error("conversion error", err)
+	}
+	m.MatchString("nothing", 0)
+	if err := m.Unmarshal(&r); err != PCRE_ERROR_NOMATCH {
+		t.Error("no match", err)
+	}
+	if err := m.Unmarshal(r); err == nil {
+		t.Error("non-pointer accepted")
+	}
+}
+
+func TestCompileStruct(t *testing.T) {
+	_, err := CompileStruct(`(?<host>\S+)`, 0, &record{})
+	if err == nil || !strings.Contains(err.Message, `no group named "ip"`) {
+		t.Error("missing group", err)
+	}
+	var bad struct {
+		C chan int `pcre:"c"`
+	}
+	_, err = CompileStruct(`(?<c>.)`, 0, &bad)
+	if err == nil || !strings.Contains(err.Message, "unsupported type") {
+		t.Error("unsupported type", err)
+	}
+}